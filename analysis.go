@@ -0,0 +1,488 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/notnil/chess"
+)
+
+const (
+	// mateCP is the evaluation in centipawns of a forced mate. A mate
+	// in n moves is stored as mateCP - n so shorter mates rank higher.
+	mateCP = 10000
+
+	// maxEvalCP caps evaluations when working out how many centipawns
+	// a move lost, so a missed mate in a won position does not dwarf
+	// every other move of the game.
+	maxEvalCP = 1000
+
+	// Centipawn losses from which a move is judged an inaccuracy,
+	// a mistake or a blunder.
+	inaccuracyCPLoss = 50
+	mistakeCPLoss    = 100
+	blunderCPLoss    = 300
+
+	JudgmentInaccuracy = "inaccuracy"
+	JudgmentMistake    = "mistake"
+	JudgmentBlunder    = "blunder"
+)
+
+// positionEval is the engine evaluation of a position, from White's
+// point of view.
+type positionEval struct {
+	// CP is the evaluation in centipawns. Forced mates are
+	// converted to centipawns, see mateCP.
+	CP int `json:"cp"`
+
+	// Mate is the number of moves to a forced mate, positive when
+	// White mates. It is 0 when there is no forced mate.
+	Mate int `json:"mate,omitempty"`
+
+	// BestMove is the move the engine prefers in UCI notation,
+	// empty when the game is over in the position.
+	BestMove string `json:"best_move,omitempty"`
+}
+
+// gameAnalysis is the engine analysis of a game.
+type gameAnalysis struct {
+	GameID     string    `json:"game_id"`
+	Engine     string    `json:"engine"`
+	Depth      int       `json:"depth"`
+	AnalyzedAt time.Time `json:"analyzed_at"`
+
+	White string `json:"white"`
+	Black string `json:"black"`
+
+	// Moves are the moves played in UCI notation.
+	Moves []string `json:"moves"`
+
+	// Evals has the evaluation of every position of the game,
+	// starting with the one before the first move.
+	Evals []positionEval `json:"evals"`
+
+	// BlackMovesFirst is set for games set up from a position
+	// with Black to move.
+	BlackMovesFirst bool `json:"black_moves_first,omitempty"`
+}
+
+// moveJudgment is how a move of an analyzed game compares to the
+// best move the engine found.
+type moveJudgment struct {
+	// Ply is the number of the move in the game, starting at 1.
+	Ply   int
+	Color chess.Color
+
+	Move     string
+	BestMove string
+
+	// CPLoss is how many centipawns the move lost
+	// compared to the best move.
+	CPLoss int
+
+	// Judgment is empty for good moves.
+	Judgment string
+}
+
+// playerAnalysis sums up the moves of one player in analyzed games.
+type playerAnalysis struct {
+	Moves         int
+	CentipawnLoss int
+	Inaccuracies  int
+	Mistakes      int
+	Blunders      int
+
+	// BestMoves is how many moves were the engine's best move.
+	BestMoves int
+}
+
+// add adds the moves of other.
+func (p *playerAnalysis) add(other playerAnalysis) {
+	p.Moves += other.Moves
+	p.CentipawnLoss += other.CentipawnLoss
+	p.Inaccuracies += other.Inaccuracies
+	p.Mistakes += other.Mistakes
+	p.Blunders += other.Blunders
+	p.BestMoves += other.BestMoves
+}
+
+// ACPL returns the average centipawn loss per move.
+func (p playerAnalysis) ACPL() float64 {
+	if p.Moves == 0 {
+		return 0
+	}
+
+	return float64(p.CentipawnLoss) / float64(p.Moves)
+}
+
+// BestMoveRate returns the percentage of moves which
+// were the engine's best move.
+func (p playerAnalysis) BestMoveRate() float64 {
+	if p.Moves == 0 {
+		return 0
+	}
+
+	return 100 * float64(p.BestMoves) / float64(p.Moves)
+}
+
+// clampEval returns cp capped to maxEvalCP either way.
+func clampEval(cp int) int {
+	if cp > maxEvalCP {
+		return maxEvalCP
+	}
+	if cp < -maxEvalCP {
+		return -maxEvalCP
+	}
+
+	return cp
+}
+
+// judgeCPLoss returns the judgment of a move which lost cpLoss centipawns.
+func judgeCPLoss(cpLoss int) string {
+	if cpLoss >= blunderCPLoss {
+		return JudgmentBlunder
+	} else if cpLoss >= mistakeCPLoss {
+		return JudgmentMistake
+	} else if cpLoss >= inaccuracyCPLoss {
+		return JudgmentInaccuracy
+	}
+
+	return ""
+}
+
+// judgments returns the judgment of every move of the game.
+func (a gameAnalysis) judgments() []moveJudgment {
+	judgments := make([]moveJudgment, 0, len(a.Moves))
+	for i, move := range a.Moves {
+		if i+1 >= len(a.Evals) {
+			break
+		}
+
+		color := chess.White
+		if (i%2 == 1) != a.BlackMovesFirst {
+			color = chess.Black
+		}
+
+		// Evaluations are from White's point of view.
+		cpLoss := clampEval(a.Evals[i].CP) - clampEval(a.Evals[i+1].CP)
+		if color == chess.Black {
+			cpLoss = -cpLoss
+		}
+		if cpLoss < 0 {
+			cpLoss = 0
+		}
+
+		judgments = append(judgments, moveJudgment{
+			Ply:      i + 1,
+			Color:    color,
+			Move:     move,
+			BestMove: a.Evals[i].BestMove,
+			CPLoss:   cpLoss,
+			Judgment: judgeCPLoss(cpLoss),
+		})
+	}
+
+	return judgments
+}
+
+// playerAnalyses sums up the moves of White and Black.
+func (a gameAnalysis) playerAnalyses() (white, black playerAnalysis) {
+	for _, judgment := range a.judgments() {
+		p := &white
+		if judgment.Color == chess.Black {
+			p = &black
+		}
+
+		p.Moves++
+		p.CentipawnLoss += judgment.CPLoss
+		if judgment.Move == judgment.BestMove {
+			p.BestMoves++
+		}
+		switch judgment.Judgment {
+		case JudgmentInaccuracy:
+			p.Inaccuracies++
+		case JudgmentMistake:
+			p.Mistakes++
+		case JudgmentBlunder:
+			p.Blunders++
+		}
+	}
+
+	return white, black
+}
+
+// engineAnalyzer analyzes games with a UCI engine. The engine is
+// restarted for the next game when it fails.
+type engineAnalyzer struct {
+	path   string
+	depth  int
+	engine *uciEngine
+}
+
+// newEngineAnalyzer starts the UCI engine at path. Positions are
+// searched depth plies deep.
+func newEngineAnalyzer(ctx context.Context, path string, depth int) (*engineAnalyzer, error) {
+	engine, err := startUCIEngine(ctx, path)
+	if err != nil {
+		return nil, err
+	}
+
+	return &engineAnalyzer{
+		path:   path,
+		depth:  depth,
+		engine: engine,
+	}, nil
+}
+
+// close stops the engine.
+func (a *engineAnalyzer) close() error {
+	if a.engine == nil {
+		return nil
+	}
+
+	return a.engine.close()
+}
+
+// analyze evaluates every position of game.
+func (a *engineAnalyzer) analyze(ctx context.Context, game chessGame) (gameAnalysis, error) {
+	if a.engine == nil {
+		engine, err := startUCIEngine(ctx, a.path)
+		if err != nil {
+			return gameAnalysis{}, err
+		}
+		a.engine = engine
+	}
+
+	analysis, err := a.analyzeWithEngine(ctx, game)
+	if err != nil {
+		// The engine may still be searching or may have
+		// exited, start a new one for the next game.
+		a.engine.kill()
+		a.engine = nil
+		return gameAnalysis{}, err
+	}
+
+	return analysis, nil
+}
+
+func (a *engineAnalyzer) analyzeWithEngine(ctx context.Context, game chessGame) (gameAnalysis, error) {
+	positions := game.ChessGame.Positions()
+	moves := game.ChessGame.Moves()
+
+	analysis := gameAnalysis{
+		GameID:          game.URL,
+		Engine:          a.engine.name,
+		Depth:           a.depth,
+		White:           game.PgnParsed.White,
+		Black:           game.PgnParsed.Black,
+		Moves:           make([]string, len(moves)),
+		Evals:           make([]positionEval, len(positions)),
+		BlackMovesFirst: positions[0].Turn() == chess.Black,
+	}
+
+	for i, move := range moves {
+		analysis.Moves[i] = chess.UCINotation{}.Encode(positions[i], move)
+	}
+
+	err := a.engine.newGame(ctx)
+	if err != nil {
+		return gameAnalysis{}, fmt.Errorf("could not start a new game in engine: %w", err)
+	}
+
+	for i, pos := range positions {
+		analysis.Evals[i], err = a.evaluate(ctx, pos)
+		if err != nil {
+			return gameAnalysis{}, fmt.Errorf("could not evaluate position %d of game %s: %w", i, game.URL, err)
+		}
+	}
+
+	analysis.AnalyzedAt = time.Now()
+
+	return analysis, nil
+}
+
+// evaluate searches pos and returns its evaluation from
+// White's point of view.
+func (a *engineAnalyzer) evaluate(ctx context.Context, pos *chess.Position) (positionEval, error) {
+
+	// Engines are not asked about positions where the game is over.
+	switch pos.Status() {
+	case chess.Checkmate:
+		if pos.Turn() == chess.White {
+			return positionEval{CP: -mateCP}, nil
+		}
+		return positionEval{CP: mateCP}, nil
+	case chess.Stalemate:
+		return positionEval{}, nil
+	}
+
+	result, err := a.engine.search(ctx, pos, a.depth)
+	if err != nil {
+		return positionEval{}, err
+	}
+
+	eval := positionEval{
+		CP:       result.Score.CP,
+		Mate:     result.Score.Mate,
+		BestMove: result.BestMove,
+	}
+
+	if eval.Mate > 0 {
+		eval.CP = mateCP - eval.Mate
+	} else if eval.Mate < 0 {
+		eval.CP = -mateCP - eval.Mate
+	}
+
+	// Engines score positions for the side to move.
+	if pos.Turn() == chess.Black {
+		eval.CP = -eval.CP
+		eval.Mate = -eval.Mate
+	}
+
+	return eval, nil
+}
+
+// analysisSaveEvery is how many analyses are set between two
+// saves of the analysis store, see analysisStore.set.
+const analysisSaveEvery = 25
+
+// analysisStore keeps the engine analysis of games keyed by game ID.
+// Analyses are persisted as JSON to path.
+type analysisStore struct {
+	path string
+
+	mutex    sync.RWMutex
+	analyses map[string]gameAnalysis
+
+	// unsaved is how many analyses were set since the store was saved.
+	unsaved int
+}
+
+// analyses is the analysis store used by the handlers. It is initialized in setup.
+var analyses = &analysisStore{
+	analyses: make(map[string]gameAnalysis),
+}
+
+// newAnalysisStore returns an analysis store backed by the file in
+// path. If the file exists, all analyses in it are loaded.
+func newAnalysisStore(path string) (*analysisStore, error) {
+	s := &analysisStore{
+		path:     path,
+		analyses: make(map[string]gameAnalysis),
+	}
+
+	fileBytes, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("could not read analysis store %s: %w", path, err)
+	}
+
+	records := []gameAnalysis{}
+	err = json.Unmarshal(fileBytes, &records)
+	if err != nil {
+		return nil, fmt.Errorf("could not unmarshal analysis store %s: %w", path, err)
+	}
+
+	for _, record := range records {
+		s.analyses[record.GameID] = record
+	}
+
+	return s, nil
+}
+
+// get returns the analysis of the game with the passed ID,
+// nil if it has not been analyzed.
+func (s *analysisStore) get(id string) *gameAnalysis {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	analysis, ok := s.analyses[id]
+	if !ok {
+		return nil
+	}
+
+	return &analysis
+}
+
+// set adds analysis to the store, replacing any previous analysis
+// of the same game. The whole store is written every time it is
+// saved, so it is only saved every analysisSaveEvery analyses:
+// call save once done setting them.
+func (s *analysisStore) set(analysis gameAnalysis) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.analyses[analysis.GameID] = analysis
+	s.unsaved++
+
+	// Months already assembled are missing the analysis.
+	monthGroups.clear()
+
+	if s.unsaved < analysisSaveEvery {
+		return nil
+	}
+
+	return s.saveLocked()
+}
+
+// save writes the store to disk if analyses were set since it was last saved.
+func (s *analysisStore) save() error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.unsaved == 0 {
+		return nil
+	}
+
+	return s.saveLocked()
+}
+
+// saveLocked writes the store to disk. The caller must hold the lock.
+func (s *analysisStore) saveLocked() error {
+	if s.path == "" {
+		return nil
+	}
+
+	records := make([]gameAnalysis, 0, len(s.analyses))
+	for _, record := range s.analyses {
+		records = append(records, record)
+	}
+
+	sort.Slice(records, func(i, j int) bool { return records[i].GameID < records[j].GameID })
+
+	fileBytes, err := json.MarshalIndent(records, "", "  ")
+	if err != nil {
+		return fmt.Errorf("could not marshal analysis store: %w", err)
+	}
+
+	err = os.MkdirAll(filepath.Dir(s.path), 0755)
+	if err != nil {
+		return fmt.Errorf("could not create analysis store directory: %w", err)
+	}
+
+	// Write to a temporary file first so a crash never leaves
+	// a half written store behind.
+	tmpPath := s.path + ".tmp"
+	err = ioutil.WriteFile(tmpPath, fileBytes, 0644)
+	if err != nil {
+		return fmt.Errorf("could not write analysis store %s: %w", tmpPath, err)
+	}
+
+	err = os.Rename(tmpPath, s.path)
+	if err != nil {
+		return fmt.Errorf("could not rename analysis store %s: %w", tmpPath, err)
+	}
+
+	s.unsaved = 0
+
+	return nil
+}
@@ -0,0 +1,383 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fakeEngineEnv is set to the path of a script to run the test binary
+// as a fake UCI engine instead of running the tests. Each line of the
+// script answers the next go command with a score and a best move,
+// such as "cp 30 e2e4" or "mate 1 h5f7". The engine exits when the
+// script runs out, or right away if the script cannot be read.
+const fakeEngineEnv = "CHESS_CLUB_FAKE_ENGINE"
+
+func TestMain(m *testing.M) {
+	if script := os.Getenv(fakeEngineEnv); script != "" {
+		runFakeEngine(script)
+		os.Exit(0)
+	}
+
+	os.Exit(m.Run())
+}
+
+func runFakeEngine(script string) {
+	scriptBytes, err := ioutil.ReadFile(script)
+	if err != nil {
+		os.Exit(1)
+	}
+	answers := strings.Split(strings.TrimSpace(string(scriptBytes)), "\n")
+
+	scanner := bufio.NewScanner(os.Stdin)
+	for scanner.Scan() {
+		command := strings.Fields(scanner.Text())
+		if len(command) == 0 {
+			continue
+		}
+
+		switch command[0] {
+		case "uci":
+			fmt.Println("id name Fake Engine")
+			fmt.Println("id author chess-club tests")
+			fmt.Println("uciok")
+		case "isready":
+			fmt.Println("readyok")
+		case "go":
+			if len(answers) == 0 {
+				os.Exit(1)
+			}
+
+			fields := strings.Fields(answers[0])
+			answers = answers[1:]
+
+			fmt.Printf("info depth 1 seldepth 1 score %s %s nodes 20 pv %s\n", fields[0], fields[1], fields[2])
+			fmt.Printf("bestmove %s\n", fields[2])
+		case "quit":
+			return
+		}
+	}
+}
+
+// useFakeEngine writes script for the fake engine and returns the
+// path of the engine to analyze games with.
+func useFakeEngine(t *testing.T, script ...string) string {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "script")
+	err := ioutil.WriteFile(path, []byte(strings.Join(script, "\n")), 0644)
+	if err != nil {
+		t.Fatalf("could not write fake engine script: %s", err)
+	}
+
+	os.Setenv(fakeEngineEnv, path)
+	t.Cleanup(func() { os.Unsetenv(fakeEngineEnv) })
+
+	return os.Args[0]
+}
+
+const scholarsMatePgn = `[Date "2021.05.30"]
+[White "alice"]
+[Black "bob"]
+[Result "1-0"]
+
+1. e4 e5 2. Qh5 Nc6 3. Bc4 Nf6 4. Qxf7# 1-0`
+
+// scholarsMateScript scores the positions of scholarsMatePgn
+// for the side to move.
+var scholarsMateScript = []string{
+	"cp 30 e2e4",
+	"cp -30 e7e5",
+	"cp 30 g1f3",
+	"cp 10 b8c6",
+	"cp -20 h5e2",
+	"cp 80 g7g6",
+	"mate 1 h5f7",
+}
+
+// scholarsMateAnalysis is the analysis of scholarsMatePgn
+// with scholarsMateScript.
+var scholarsMateAnalysis = gameAnalysis{
+	GameID:     "pgn:scholars-mate",
+	Engine:     "Fake Engine",
+	Depth:      12,
+	AnalyzedAt: time.Date(2021, 5, 30, 10, 0, 0, 0, time.UTC),
+	White:      "alice",
+	Black:      "bob",
+	Moves:      []string{"e2e4", "e7e5", "d1h5", "b8c6", "f1c4", "g8f6", "h5f7"},
+
+	// Evaluations are from White's point of view, the last
+	// position is checkmate and is not sent to the engine.
+	Evals: []positionEval{
+		{CP: 30, BestMove: "e2e4"},
+		{CP: 30, BestMove: "e7e5"},
+		{CP: 30, BestMove: "g1f3"},
+		{CP: -10, BestMove: "b8c6"},
+		{CP: -20, BestMove: "h5e2"},
+		{CP: -80, BestMove: "g7g6"},
+		{CP: mateCP - 1, Mate: 1, BestMove: "h5f7"},
+		{CP: mateCP},
+	},
+}
+
+// useAnalyses replaces the analysis store with one holding
+// analyses until the test ends.
+func useAnalyses(t *testing.T, records ...gameAnalysis) {
+	t.Helper()
+
+	oldAnalyses := analyses
+	analyses = &analysisStore{
+		analyses: make(map[string]gameAnalysis),
+	}
+	for _, record := range records {
+		analyses.analyses[record.GameID] = record
+	}
+	monthGroups.clear()
+
+	t.Cleanup(func() {
+		analyses = oldAnalyses
+		monthGroups.clear()
+	})
+}
+
+func scholarsMateGame(t *testing.T) chessGame {
+	t.Helper()
+
+	game, err := getChessGame(scholarsMatePgn)
+	if err != nil {
+		t.Fatalf("could not parse pgn: %s", err)
+	}
+	game.URL = "pgn:scholars-mate"
+
+	return game
+}
+
+func TestEngineAnalyzerAnalyze(t *testing.T) {
+	enginePath := useFakeEngine(t, scholarsMateScript...)
+
+	analyzer, err := newEngineAnalyzer(context.Background(), enginePath, 12)
+	if err != nil {
+		t.Fatalf("newEngineAnalyzer() error = %s", err)
+	}
+	defer analyzer.close()
+
+	analysis, err := analyzer.analyze(context.Background(), scholarsMateGame(t))
+	if err != nil {
+		t.Fatalf("analyze() error = %s", err)
+	}
+
+	if analysis.Engine != "Fake Engine" || analysis.Depth != 12 {
+		t.Errorf("engine = %q at depth %d, want Fake Engine at depth 12", analysis.Engine, analysis.Depth)
+	}
+
+	if !reflect.DeepEqual(analysis.Moves, scholarsMateAnalysis.Moves) {
+		t.Errorf("moves = %v, want %v", analysis.Moves, scholarsMateAnalysis.Moves)
+	}
+
+	if !reflect.DeepEqual(analysis.Evals, scholarsMateAnalysis.Evals) {
+		t.Errorf("evals = %+v, want %+v", analysis.Evals, scholarsMateAnalysis.Evals)
+	}
+
+	white, black := analysis.playerAnalyses()
+
+	// Qh5 lost 40 centipawns, Bc4 60 and Nf6 let White mate.
+	// e4, e5, Nc6 and Qxf7# were the engine's best moves.
+	wantWhite := playerAnalysis{Moves: 4, CentipawnLoss: 100, Inaccuracies: 1, BestMoves: 2}
+	wantBlack := playerAnalysis{Moves: 3, CentipawnLoss: 1080, Blunders: 1, BestMoves: 2}
+	if white != wantWhite || black != wantBlack {
+		t.Errorf("playerAnalyses() = %+v, %+v, want %+v, %+v", white, black, wantWhite, wantBlack)
+	}
+
+	if white.ACPL() != 25 {
+		t.Errorf("White ACPL = %g, want 25", white.ACPL())
+	}
+	if white.BestMoveRate() != 50 {
+		t.Errorf("White best move rate = %g, want 50", white.BestMoveRate())
+	}
+}
+
+func TestEngineAnalyzerEngineExits(t *testing.T) {
+	// The engine exits after answering for two positions.
+	enginePath := useFakeEngine(t, scholarsMateScript[:2]...)
+
+	analyzer, err := newEngineAnalyzer(context.Background(), enginePath, 12)
+	if err != nil {
+		t.Fatalf("newEngineAnalyzer() error = %s", err)
+	}
+	defer analyzer.close()
+
+	_, err = analyzer.analyze(context.Background(), scholarsMateGame(t))
+	if err == nil || !strings.Contains(err.Error(), "engine exited") {
+		t.Fatalf("analyze() error = %v, want engine exited", err)
+	}
+
+	// A new engine is started for the next game.
+	_, err = analyzer.analyze(context.Background(), scholarsMateGame(t))
+	if err == nil || !strings.Contains(err.Error(), "position 2") {
+		t.Errorf("analyze() error = %v, want an error on position 2", err)
+	}
+}
+
+func TestNewEngineAnalyzerNotAnEngine(t *testing.T) {
+	os.Setenv(fakeEngineEnv, filepath.Join(t.TempDir(), "missing"))
+	defer os.Unsetenv(fakeEngineEnv)
+
+	_, err := newEngineAnalyzer(context.Background(), os.Args[0], 12)
+	if err == nil {
+		t.Fatalf("newEngineAnalyzer() succeeded with an engine which exits")
+	}
+
+	_, err = newEngineAnalyzer(context.Background(), filepath.Join(t.TempDir(), "missing"), 12)
+	if err == nil {
+		t.Fatalf("newEngineAnalyzer() succeeded with a missing engine")
+	}
+}
+
+func TestAnalysisStore(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "analysis.json")
+
+	s, err := newAnalysisStore(path)
+	if err != nil {
+		t.Fatalf("newAnalysisStore() error = %s", err)
+	}
+
+	analysis := gameAnalysis{
+		GameID: "pgn:scholars-mate",
+		Engine: "Fake Engine",
+		Moves:  []string{"e2e4"},
+		Evals:  []positionEval{{CP: 30, BestMove: "e2e4"}, {CP: 25, BestMove: "e7e5"}},
+	}
+	err = s.set(analysis)
+	if err != nil {
+		t.Fatalf("set() error = %s", err)
+	}
+
+	// Analyses are saved in batches.
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("set() saved the store after a single analysis")
+	}
+
+	err = s.save()
+	if err != nil {
+		t.Fatalf("save() error = %s", err)
+	}
+
+	s, err = newAnalysisStore(path)
+	if err != nil {
+		t.Fatalf("newAnalysisStore() error = %s", err)
+	}
+
+	got := s.get(analysis.GameID)
+	if got == nil || !reflect.DeepEqual(*got, analysis) {
+		t.Errorf("get() = %+v, want %+v", got, analysis)
+	}
+
+	if s.get("pgn:other") != nil {
+		t.Errorf("get() returned an analysis for a game which was not analyzed")
+	}
+}
+
+func TestAnalysisStoreSavesInBatches(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "analysis.json")
+
+	s, err := newAnalysisStore(path)
+	if err != nil {
+		t.Fatalf("newAnalysisStore() error = %s", err)
+	}
+
+	stored := func() int {
+		loaded, err := newAnalysisStore(path)
+		if err != nil {
+			t.Fatalf("newAnalysisStore() error = %s", err)
+		}
+		return len(loaded.analyses)
+	}
+
+	for i := 1; i <= analysisSaveEvery+3; i++ {
+		err := s.set(gameAnalysis{GameID: fmt.Sprintf("pgn:%d", i), Engine: "Fake Engine"})
+		if err != nil {
+			t.Fatalf("set() error = %s", err)
+		}
+
+		want := 0
+		if i >= analysisSaveEvery {
+			want = analysisSaveEvery
+		}
+		if got := stored(); got != want {
+			t.Fatalf("after %d analyses, %d are saved, want %d", i, got, want)
+		}
+	}
+
+	err = s.save()
+	if err != nil {
+		t.Fatalf("save() error = %s", err)
+	}
+	if got := stored(); got != analysisSaveEvery+3 {
+		t.Errorf("after save(), %d analyses are saved, want %d", got, analysisSaveEvery+3)
+	}
+
+	// Nothing left to save.
+	err = os.Remove(path)
+	if err != nil {
+		t.Fatalf("could not remove analysis store: %s", err)
+	}
+	err = s.save()
+	if err != nil {
+		t.Fatalf("save() error = %s", err)
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("save() wrote the store again with nothing to save")
+	}
+}
+
+func TestGetEvalChart(t *testing.T) {
+	game := scholarsMateGame(t)
+	game.Analysis = &scholarsMateAnalysis
+
+	chart := getGameData(game, 0).EvalChart
+	if chart == nil {
+		t.Fatalf("getGameData() has no evaluation chart for an analyzed game")
+	}
+
+	// Only Bc4 and Nf6 lost enough to be judged.
+	want := []evalChartMarker{
+		{X: 600.0 * 5 / 7, Y: 86.4, Ply: 5, Label: "3. Bc4?! -0.80", Judgment: JudgmentInaccuracy},
+		{X: 600.0 * 6 / 7, Y: 0, Ply: 6, Label: "3... Nf6?? #1", Judgment: JudgmentBlunder},
+	}
+	if len(chart.Markers) != len(want) {
+		t.Fatalf("markers = %+v, want %+v", chart.Markers, want)
+	}
+	for i, marker := range chart.Markers {
+		if marker.Ply != want[i].Ply || marker.Label != want[i].Label || marker.Judgment != want[i].Judgment ||
+			math.Abs(marker.X-want[i].X) > 0.01 || math.Abs(marker.Y-want[i].Y) > 0.01 {
+			t.Errorf("marker %d = %+v, want %+v", i, marker, want[i])
+		}
+	}
+
+	// The largest swings are marked, in the order they were played.
+	manyMistakes := gameAnalysis{
+		Moves: []string{"e2e4", "e7e5", "g1f3", "b8c6", "f1c4"},
+		Evals: []positionEval{{CP: 0}, {CP: -200}, {CP: 200}, {CP: 100}, {CP: 600}, {CP: 400}},
+	}
+	chart = getEvalChart(manyMistakes, nil)
+
+	plies := []int{}
+	for _, marker := range chart.Markers {
+		plies = append(plies, marker.Ply)
+	}
+	if !reflect.DeepEqual(plies, []int{1, 2, 4}) {
+		t.Errorf("marked plies = %v, want [1 2 4]", plies)
+	}
+
+	if getEvalChart(gameAnalysis{Evals: []positionEval{{CP: 30}}}, nil) != nil {
+		t.Errorf("getEvalChart() drew a chart without moves")
+	}
+}
@@ -0,0 +1,36 @@
+package main
+
+import (
+	"crypto/subtle"
+	"net/http"
+)
+
+// adminUsername is the username expected by requireAdmin.
+const adminUsername = "admin"
+
+// requireAdmin wraps inner so that it is only served to requests
+// authenticated with HTTP basic auth using the admin password set in
+// the config (CHESS_CLUB_ADMIN_PASSWORD environment variable).
+// If no password is set, the endpoint is disabled.
+func requireAdmin(inner http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+
+		password := appConfig.AdminPassword
+		if password == "" {
+			http.Error(w, "This endpoint is disabled because no admin password is configured", http.StatusForbidden)
+			return
+		}
+
+		username, givenPassword, ok := r.BasicAuth()
+		if !ok ||
+			subtle.ConstantTimeCompare([]byte(username), []byte(adminUsername)) != 1 ||
+			subtle.ConstantTimeCompare([]byte(givenPassword), []byte(password)) != 1 {
+
+			w.Header().Set("WWW-Authenticate", `Basic realm="chess-club"`)
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		inner.ServeHTTP(w, r)
+	})
+}
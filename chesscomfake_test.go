@@ -0,0 +1,225 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeChessComFixtures has the fixtures served by fakeChessCom:
+// <username>/games.json for current games and <username>/YYYY/MM.json
+// for monthly archives, in the chess.com API format.
+const fakeChessComFixtures = "testdata/chesscom"
+
+// malformedBody is a truncated JSON body.
+const malformedBody = `{"games": [{"url": "https://www.chess.com/game/live/1",`
+
+// fakeFault is served in place of a fixture.
+type fakeFault struct {
+	Status     int
+	RetryAfter string
+	Body       string
+
+	// Times is how many requests get the fault, 0 for all of them.
+	Times int
+}
+
+// fakeChessCom is an httptest server implementing the chess.com
+// published data endpoints used by the club from fixtures, with knobs
+// to add latency and serve errors or malformed bodies.
+type fakeChessCom struct {
+	server *httptest.Server
+	dir    string
+
+	mutex    sync.Mutex
+	latency  map[string]time.Duration
+	faults   map[string]*fakeFault
+	requests map[string]int
+
+	// cancelled counts the requests cancelled by the client
+	// while their response was delayed.
+	cancelled map[string]int
+}
+
+// newFakeChessCom starts a fake chess.com serving fixtures from dir
+// and points chessComClient at it. Members of the club are set to
+// members and the game and analysis stores are emptied. Everything is restored when
+// the test ends.
+func newFakeChessCom(t *testing.T, dir string, members ...string) *fakeChessCom {
+	t.Helper()
+
+	f := &fakeChessCom{
+		dir:       dir,
+		latency:   make(map[string]time.Duration),
+		faults:    make(map[string]*fakeFault),
+		requests:  make(map[string]int),
+		cancelled: make(map[string]int),
+	}
+	f.server = httptest.NewServer(http.HandlerFunc(f.serveHTTP))
+
+	oldBaseURL, oldClient, oldClub, oldStore, oldAnalyses := chessComBaseURL, chessComClient, club, store, analyses
+
+	chessComBaseURL = f.server.URL
+	chessComClient = newChessComClient(time.Second, 2, 4, nil)
+	club = clubConfig{Name: "Test Club", Members: members}
+	store = &gameStore{
+		games:     make(map[string]storedGame),
+		parsed:    make(map[string]chessGame),
+		positions: make(map[uint64][]positionHit),
+	}
+	analyses = &analysisStore{
+		analyses: make(map[string]gameAnalysis),
+	}
+	monthGroups.clear()
+
+	t.Cleanup(func() {
+		f.server.Close()
+		chessComBaseURL, chessComClient, club, store, analyses = oldBaseURL, oldClient, oldClub, oldStore, oldAnalyses
+		monthGroups.clear()
+	})
+
+	return f
+}
+
+// setLatency delays the responses to path, or to every path if empty.
+func (f *fakeChessCom) setLatency(path string, latency time.Duration) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	f.latency[path] = latency
+}
+
+// setFault serves fault for path instead of its fixture.
+func (f *fakeChessCom) setFault(path string, fault fakeFault) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	f.faults[path] = &fault
+}
+
+// requestCount returns how many requests were made for path.
+func (f *fakeChessCom) requestCount(path string) int {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	return f.requests[path]
+}
+
+// cancelledCount returns how many requests for path were cancelled
+// by the client while their response was delayed.
+func (f *fakeChessCom) cancelledCount(path string) int {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	return f.cancelled[path]
+}
+
+func (f *fakeChessCom) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	path := r.URL.Path
+
+	f.mutex.Lock()
+	f.requests[path]++
+	latency, ok := f.latency[path]
+	if !ok {
+		latency = f.latency[""]
+	}
+	fault := f.faults[path]
+	if fault != nil && fault.Times > 0 {
+		fault.Times--
+		if fault.Times == 0 {
+			delete(f.faults, path)
+		}
+	}
+	f.mutex.Unlock()
+
+	if latency > 0 {
+		select {
+		case <-time.After(latency):
+		case <-r.Context().Done():
+			f.mutex.Lock()
+			f.cancelled[path]++
+			f.mutex.Unlock()
+			return
+		}
+	}
+
+	if fault != nil {
+		if fault.RetryAfter != "" {
+			w.Header().Set("Retry-After", fault.RetryAfter)
+		}
+		status := fault.Status
+		if status == 0 {
+			status = http.StatusOK
+		}
+		w.WriteHeader(status)
+		fmt.Fprint(w, fault.Body)
+		return
+	}
+
+	// /pub/player/{username}/games[/archives|/YYYY/MM]
+	parts := strings.Split(strings.TrimPrefix(path, "/pub/player/"), "/")
+	if !strings.HasPrefix(path, "/pub/player/") || len(parts) < 2 || parts[1] != "games" {
+		http.NotFound(w, r)
+		return
+	}
+
+	userDir := filepath.Join(f.dir, strings.ToLower(parts[0]))
+	if _, err := os.Stat(userDir); err != nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	switch len(parts) {
+	case 2:
+		f.serveFixture(w, filepath.Join(userDir, "games.json"), `{"games": []}`)
+	case 3:
+		if parts[2] != "archives" {
+			http.NotFound(w, r)
+			return
+		}
+		f.serveArchives(w, parts[0], userDir)
+	case 4:
+		f.serveFixture(w, filepath.Join(userDir, parts[2], parts[3]+".json"), "")
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// serveFixture writes the fixture in path, or fallback if there is
+// none. A 404 is returned when there is neither.
+func (f *fakeChessCom) serveFixture(w http.ResponseWriter, path, fallback string) {
+	body, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) && fallback != "" {
+		body = []byte(fallback)
+	} else if err != nil {
+		http.Error(w, `{"code": 0, "message": "not found"}`, http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(body)
+}
+
+// serveArchives lists the monthly archive fixtures of username.
+func (f *fakeChessCom) serveArchives(w http.ResponseWriter, username, userDir string) {
+	files, _ := filepath.Glob(filepath.Join(userDir, "[0-9][0-9][0-9][0-9]", "[0-9][0-9].json"))
+	sort.Strings(files)
+
+	archives := []string{}
+	for _, file := range files {
+		year := filepath.Base(filepath.Dir(file))
+		month := strings.TrimSuffix(filepath.Base(file), ".json")
+		archives = append(archives, fmt.Sprintf("%q", fmt.Sprintf("%s/pub/player/%s/games/%s/%s", f.server.URL, username, year, month)))
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	fmt.Fprintf(w, `{"archives": [%s]}`, strings.Join(archives, ", "))
+}
@@ -1,17 +1,270 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"io/ioutil"
 	"net/http"
-	"strings"
 	"sync"
 	"time"
 
 	"github.com/sirupsen/logrus"
+	"golang.org/x/sync/singleflight"
 )
 
+// chessComBaseURL is the base URL of the chess.com published data API.
+var chessComBaseURL = "https://api.chess.com"
+
+// sharedFetchTimeout bounds a fetch shared by concurrent callers,
+// retries included.
+const sharedFetchTimeout = 30 * time.Second
+
+// chessComHTTPClient does the requests to the chess.com API.
+// Retries and rate limiting are handled by its chessComTransport.
+type chessComHTTPClient struct {
+	httpClient *http.Client
+
+	// cache keeps responses on disk between requests, nil disables it.
+	cache *httpCache
+
+	// inflight coalesces concurrent requests for the same URL.
+	inflight singleflight.Group
+
+	// shared has the fetch of each URL in inflight, see join.
+	mutex  sync.Mutex
+	shared map[string]*sharedFetch
+}
+
+// sharedFetch is the context of a fetch shared by the callers
+// waiting for it.
+type sharedFetch struct {
+	ctx     context.Context
+	cancel  context.CancelFunc
+	waiters int
+}
+
+// chessComClient is used for every request to the chess.com API.
+// It is replaced in setup with the configured timeout, retries,
+// concurrency and cache.
+var chessComClient = newChessComClient(5*time.Second, 2, 4, nil)
+
+func newChessComClient(timeout time.Duration, retries, concurrency int, cache *httpCache) *chessComHTTPClient {
+	return &chessComHTTPClient{
+		httpClient: &http.Client{
+			Transport: newChessComTransport(http.DefaultTransport, timeout, retries, concurrency),
+		},
+		cache:  cache,
+		shared: make(map[string]*sharedFetch),
+	}
+}
+
+// get does a GET request to url and returns the response body.
+// A *chessComStatusError is returned for any status other than 200.
+//
+// When chess.com cannot be reached, a stale cached copy is returned
+// instead of an error and recorded in the staleReport of ctx.
+//
+// Concurrent calls for the same url share a single fetch. The fetch
+// is not cancelled when the caller which started it goes away, so the
+// other callers still get the body. It is cancelled once every caller
+// has gone, and bounded by sharedFetchTimeout.
+func (c *chessComHTTPClient) get(ctx context.Context, url string) ([]byte, error) {
+	fetch := c.join(ctx, url)
+	defer c.leave(url, fetch)
+
+	resultChan := c.inflight.DoChan(url, func() (interface{}, error) {
+		defer c.finish(url, fetch)
+
+		return c.fetch(fetch.ctx, url)
+	})
+
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case result := <-resultChan:
+		if result.Shared {
+			chessComRequestsCoalescedTotal.WithLabelValues(chessComEndpoint(url)).Inc()
+		}
+
+		if result.Err != nil {
+			return nil, result.Err
+		}
+
+		fetched := result.Val.(fetchedBody)
+		observeChessComDataAge(url, fetched.fetchedAt)
+		if !fetched.staleSince.IsZero() {
+			recordStale(ctx, fetched.staleSince, fetched.staleReason)
+		}
+
+		return fetched.body, nil
+	}
+}
+
+// join returns the fetch of url shared by the callers waiting for it,
+// a new one if there is none, and counts ctx's caller as waiting.
+func (c *chessComHTTPClient) join(ctx context.Context, url string) *sharedFetch {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	fetch, ok := c.shared[url]
+	if !ok {
+		fetchCtx, cancel := context.WithTimeout(withRequestID(context.Background(), requestIDFromContext(ctx)), sharedFetchTimeout)
+		fetch = &sharedFetch{ctx: fetchCtx, cancel: cancel}
+		c.shared[url] = fetch
+	}
+	fetch.waiters++
+
+	return fetch
+}
+
+// leave is called when a caller stops waiting for fetch, because it
+// got the body or went away. The last one to leave cancels the fetch.
+func (c *chessComHTTPClient) leave(url string, fetch *sharedFetch) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	fetch.waiters--
+	if fetch.waiters > 0 {
+		return
+	}
+
+	fetch.cancel()
+	if c.shared[url] == fetch {
+		delete(c.shared, url)
+
+		// The next caller starts a new fetch
+		// rather than joining the cancelled one.
+		c.inflight.Forget(url)
+	}
+}
+
+// finish is called when fetch is done, so the next callers
+// start a new one.
+func (c *chessComHTTPClient) finish(url string, fetch *sharedFetch) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if c.shared[url] == fetch {
+		delete(c.shared, url)
+	}
+}
+
+// fetchedBody is a response body returned by fetch, fetched from
+// chess.com at fetchedAt. staleSince is set when it is a stale cached
+// copy served because chess.com failed.
+type fetchedBody struct {
+	body        []byte
+	fetchedAt   time.Time
+	staleSince  time.Time
+	staleReason string
+}
+
+// fetch gets url from the cache or from chess.com.
+//
+// Fresh responses are served from the cache. Stale ones are revalidated
+// with If-None-Match and If-Modified-Since, so unchanged archives are
+// answered with a 304 and no body. If chess.com fails, the stale
+// cached copy is returned when there is one.
+func (c *chessComHTTPClient) fetch(ctx context.Context, url string) (fetchedBody, error) {
+	now := time.Now()
+
+	cached, isCached := cachedResponse{}, false
+	if c.cache != nil {
+		cached, isCached = c.cache.load(url)
+		if isCached && c.cache.fresh(cached, now) {
+			c.cache.recordHit()
+			return fetchedBody{body: cached.Body, fetchedAt: cached.FetchedAt}, nil
+		}
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return fetchedBody{}, err
+	}
+
+	// serveStale returns the cached copy in place of the failure err.
+	serveStale := func(err error) (fetchedBody, error) {
+		if !isCached {
+			return fetchedBody{}, err
+		}
+
+		loggerFromContext(ctx).WithError(err).WithFields(logrus.Fields{
+			"url":       url,
+			"fetchedAt": cached.FetchedAt,
+		}).Warn("chess.com failed, serving stale cached response")
+
+		return fetchedBody{
+			body:        cached.Body,
+			fetchedAt:   cached.FetchedAt,
+			staleSince:  cached.FetchedAt,
+			staleReason: err.Error(),
+		}, nil
+	}
+
+	if isCached {
+		if cached.ETag != "" {
+			req.Header.Set("If-None-Match", cached.ETag)
+		}
+		if cached.LastModified != "" {
+			req.Header.Set("If-Modified-Since", cached.LastModified)
+		}
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return serveStale(err)
+	}
+
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotModified && isCached {
+		c.cache.recordRevalidation()
+
+		cached.FetchedAt = now
+		c.saveToCache(ctx, cached)
+
+		return fetchedBody{body: cached.Body, fetchedAt: now}, nil
+	}
+
+	if resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500 {
+		return serveStale(&chessComStatusError{URL: url, StatusCode: resp.StatusCode})
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return fetchedBody{}, &chessComStatusError{URL: url, StatusCode: resp.StatusCode}
+	}
+
+	// get the response body
+	respBody, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return serveStale(fmt.Errorf("could not read response body: %w", err))
+	}
+
+	if c.cache != nil {
+		c.cache.recordMiss()
+
+		c.saveToCache(ctx, cachedResponse{
+			URL:          url,
+			ETag:         resp.Header.Get("ETag"),
+			LastModified: resp.Header.Get("Last-Modified"),
+			FetchedAt:    now,
+			Body:         respBody,
+		})
+	}
+
+	return fetchedBody{body: respBody, fetchedAt: now}, nil
+}
+
+// saveToCache saves cached, logging rather than failing the request
+// when it cannot be written.
+func (c *chessComHTTPClient) saveToCache(ctx context.Context, cached cachedResponse) {
+	err := c.cache.save(cached)
+	if err != nil {
+		loggerFromContext(ctx).WithError(err).WithField("url", cached.URL).Warn("could not save chess.com response to cache")
+	}
+}
+
 // Chess.com response when getting games for
 // an individual user.
 type chessComCurrentUserGames struct {
@@ -68,26 +321,14 @@ type chessComFinishedGame struct {
 // Call chess.com API to get the games for the passed username.
 // This function will also go ahead and reag the PGN for the game
 // and populate ChessGame field on game struct.
-func getUserUnfinishedGames(username string) ([]chessGame, error) {
-
-	c := &http.Client{
-		Timeout: time.Second * 5,
-	}
+func getUserUnfinishedGames(ctx context.Context, username string) ([]chessGame, error) {
 
 	// Get games from chess.com API
-	resp, err := c.Get(fmt.Sprintf("https://api.chess.com/pub/player/%s/games", username))
+	respBody, err := chessComClient.get(ctx, fmt.Sprintf("%s/pub/player/%s/games", chessComBaseURL, username))
 	if err != nil {
 		return []chessGame{}, fmt.Errorf("could not get current games for username %s: %w", username, err)
 	}
 
-	defer resp.Body.Close()
-
-	// get the response body
-	respBody, err := ioutil.ReadAll(resp.Body)
-	if err != nil {
-		return []chessGame{}, fmt.Errorf("could not read response body for current games for username %s: %w", username, err)
-	}
-
 	// Unmarshal response body to struct above
 	games := chessComCurrentUserGames{}
 	err = json.Unmarshal(respBody, &games)
@@ -95,69 +336,53 @@ func getUserUnfinishedGames(username string) ([]chessGame, error) {
 		return []chessGame{}, fmt.Errorf("could not unmarshal response body for current games for username %s: %w", username, err)
 	}
 
-	chessGames := make([]chessGame, len(games.Games))
+	chessGames := make([]chessGame, 0, len(games.Games))
 	// Loop through all games and build a ChessGame from PGN.
+	// A game which cannot be read is left out, not the whole list.
 	for i := 0; i < len(games.Games); i++ {
-		pgnChessGame, err := getChessGame(games.Games[i].Pgn)
+		pgnChessGame, err := chessGameFromChessComCurrentGame(username, games.Games[i])
 		if err != nil {
-			return []chessGame{}, fmt.Errorf("could not read Pgn for game for username %s: %w", username, err)
+			loggerFromContext(ctx).WithError(err).WithField("url", games.Games[i].URL).Warn("could not read current game")
+			continue
 		}
 
-		pgnChessGame.URL = games.Games[i].URL
-
-		chessGames[i] = pgnChessGame
+		chessGames = append(chessGames, pgnChessGame)
 	}
 
 	return chessGames, nil
 }
 
-func getUserFinishedGamesForYearMonth(username string, year, month int) ([]chessGame, string, error) {
-	archives, err := getUserArchivalURLs(username)
+// getUserFinishedGamesForYearMonth returns the finished games of
+// username in the passed year and month.
+func getUserFinishedGamesForYearMonth(ctx context.Context, username string, year, month int) ([]chessGame, error) {
+	archives, err := getUserArchivalURLs(ctx, username)
 	if err != nil {
-		return []chessGame{}, "", fmt.Errorf("could not get user archival urls %s: %w", username, err)
+		return []chessGame{}, fmt.Errorf("could not get user archival urls %s: %w", username, err)
 	}
 
-	yearMonthStringToFind := fmt.Sprintf("%04d%02d", year, month)
-
-	urlForYearMonthToFind := ""
-	maxYearMonthPriorToFind := "190001"
 	for _, archiveURL := range archives.Archives {
-		urlSplit := strings.Split(archiveURL, "/")
-		if len(urlSplit) < 2 {
+		archiveYear, archiveMonth, ok := archiveYearMonth(archiveURL)
+		if !ok || archiveYear != year || archiveMonth != month {
 			continue
 		}
 
-		yearString := urlSplit[len(urlSplit)-2]
-		monthString := urlSplit[len(urlSplit)-1]
-
-		currYearMonthString := fmt.Sprintf("%04s%02s", yearString, monthString)
-
-		if yearMonthStringToFind == currYearMonthString {
-			urlForYearMonthToFind = archiveURL
-		}
-
-		if currYearMonthString < yearMonthStringToFind && currYearMonthString > maxYearMonthPriorToFind {
-			maxYearMonthPriorToFind = currYearMonthString
-		}
-	}
-
-	games := []chessGame{}
-	if urlForYearMonthToFind != "" {
-		games, err = getFinishedGamesWithURL(username, urlForYearMonthToFind)
+		games, err := getFinishedGamesWithURL(ctx, username, archiveURL)
 		if err != nil {
-			return []chessGame{}, "", fmt.Errorf("could not get finished games with url %s: %w", username, err)
+			return []chessGame{}, fmt.Errorf("could not get finished games with url %s: %w", username, err)
 		}
+
+		return games, nil
 	}
 
-	return games, maxYearMonthPriorToFind, nil
+	return []chessGame{}, nil
 }
 
 // Call chess.com API to get the finished games for the passed username.
 // This function will also go ahead and reag the PGN for the game
 // and populate ChessGame field on game struct.
-func getUserFinishedGames(username string) ([]chessGame, error) {
+func getUserFinishedGames(ctx context.Context, username string) ([]chessGame, error) {
 
-	archives, err := getUserArchivalURLs(username)
+	archives, err := getUserArchivalURLs(ctx, username)
 	if err != nil {
 		return []chessGame{}, fmt.Errorf("could not get user archival urls %s: %w", username, err)
 	}
@@ -174,21 +399,15 @@ func getUserFinishedGames(username string) ([]chessGame, error) {
 		go func(url string) {
 			defer wg.Done()
 
-			attempts := 5
-			for i := 0; i < attempts; i++ {
-
-				pgnChessGames, err := getFinishedGamesWithURL(username, url)
-				if err != nil {
-					logrus.WithError(err).WithField("attempt loop", i).Warn("could not get finished games with url")
-					continue
-				}
-
-				mutex.Lock()
-				chessGames = append(chessGames, pgnChessGames...)
-				mutex.Unlock()
-
-				break
+			pgnChessGames, err := getFinishedGamesWithURL(ctx, username, url)
+			if err != nil {
+				loggerFromContext(ctx).WithError(err).Warn("could not get finished games with url")
+				return
 			}
+
+			mutex.Lock()
+			chessGames = append(chessGames, pgnChessGames...)
+			mutex.Unlock()
 		}(archiveURL)
 	}
 
@@ -197,25 +416,14 @@ func getUserFinishedGames(username string) ([]chessGame, error) {
 	return chessGames, nil
 }
 
-func getUserArchivalURLs(username string) (archiveResponse, error) {
-	c := &http.Client{
-		Timeout: time.Second * 5,
-	}
+func getUserArchivalURLs(ctx context.Context, username string) (archiveResponse, error) {
 
 	// Get archival url games from chess.com API
-	res, err := c.Get(fmt.Sprintf("https://api.chess.com/pub/player/%s/games/archives", username))
+	resBody, err := chessComClient.get(ctx, fmt.Sprintf("%s/pub/player/%s/games/archives", chessComBaseURL, username))
 	if err != nil {
 		return archiveResponse{}, fmt.Errorf("could not get archives games for username %s: %w", username, err)
 	}
 
-	defer res.Body.Close()
-
-	// get the response body
-	resBody, err := ioutil.ReadAll(res.Body)
-	if err != nil {
-		return archiveResponse{}, fmt.Errorf("could not read response body for archives for username %s: %w", username, err)
-	}
-
 	// Unmarshal response body to struct above
 	archives := archiveResponse{}
 	err = json.Unmarshal(resBody, &archives)
@@ -226,24 +434,13 @@ func getUserArchivalURLs(username string) (archiveResponse, error) {
 	return archives, nil
 }
 
-func getFinishedGamesWithURL(username, url string) ([]chessGame, error) {
-	c2 := &http.Client{
-		Timeout: time.Second * 5,
-	}
+func getFinishedGamesWithURL(ctx context.Context, username, url string) ([]chessGame, error) {
 
-	resp, err := c2.Get(url)
+	respBody, err := chessComClient.get(ctx, url)
 	if err != nil {
 		return nil, fmt.Errorf("could not get finished games. url (%s) for username %s: %s", url, username, err)
 	}
 
-	defer resp.Body.Close()
-
-	// get the response body
-	respBody, err := ioutil.ReadAll(resp.Body)
-	if err != nil {
-		return nil, fmt.Errorf("could not read response body for finished games. url (%s) for username %s: %s", url, username, err)
-	}
-
 	gamesForUser := chessComFinishedUserGames{}
 	// Unmarshal response body to struct above
 	err = json.Unmarshal(respBody, &gamesForUser)
@@ -251,53 +448,57 @@ func getFinishedGamesWithURL(username, url string) ([]chessGame, error) {
 		return nil, fmt.Errorf("could not unmarshal response body for finished games. url (%s) for username %s: %s", url, username, err)
 	}
 
-	pngChessGames := make([]chessGame, len(gamesForUser.Games))
+	pngChessGames := make([]chessGame, 0, len(gamesForUser.Games))
 	// Loop through all games and build a ChessGame from PGN.
+	// A game which cannot be read is left out, not the whole list.
 	for i := 0; i < len(gamesForUser.Games); i++ {
-		pgnChessGame, err := getChessGame(gamesForUser.Games[i].Pgn)
+		pgnChessGame, err := chessGameFromChessComFinishedGame(username, &gamesForUser.Games[i])
 		if err != nil {
-			return nil, fmt.Errorf("could not read Pgn for game for username %s: %s", username, err)
-		}
-
-		// Set boolean fields for HTML rendering for black
-		if gamesForUser.Games[i].Black.Result == ChessComResultWin {
-			pgnChessGame.PgnParsed.BlackWon = true
-		} else if gamesForUser.Games[i].Black.Result == ChessComResultCheckmated {
-			pgnChessGame.PgnParsed.BlackWasCheckmated = true
-		} else if gamesForUser.Games[i].Black.Result == ChessComResultResigned {
-			pgnChessGame.PgnParsed.BlackResigned = true
-		} else if gamesForUser.Games[i].Black.Result == ChessComResultTimeout {
-			pgnChessGame.PgnParsed.BlackTimedOut = true
-		} else if gamesForUser.Games[i].Black.Result == ChessComResultAgreed {
-			pgnChessGame.PgnParsed.BlackAgreed = true
-		} else if gamesForUser.Games[i].Black.Result == ChessComResultInsufficient {
-			pgnChessGame.PgnParsed.BlackInsufficient = true
+			loggerFromContext(ctx).WithError(err).WithField("url", gamesForUser.Games[i].URL).Warn("could not read finished game")
+			continue
 		}
 
-		// Set boolean fields for HTML rendering for white
-		if gamesForUser.Games[i].White.Result == ChessComResultWin {
-			pgnChessGame.PgnParsed.WhiteWon = true
-		} else if gamesForUser.Games[i].White.Result == ChessComResultCheckmated {
-			pgnChessGame.PgnParsed.WhiteWasCheckmated = true
-		} else if gamesForUser.Games[i].White.Result == ChessComResultResigned {
-			pgnChessGame.PgnParsed.WhiteResigned = true
-		} else if gamesForUser.Games[i].White.Result == ChessComResultTimeout {
-			pgnChessGame.PgnParsed.WhiteTimedOut = true
-		} else if gamesForUser.Games[i].White.Result == ChessComResultAgreed {
-			pgnChessGame.PgnParsed.WhiteAgreed = true
-		} else if gamesForUser.Games[i].White.Result == ChessComResultInsufficient {
-			pgnChessGame.PgnParsed.WhiteInsufficient = true
-		}
+		pngChessGames = append(pngChessGames, pgnChessGame)
+	}
 
-		if pgnChessGame.PgnParsed.Result == PgnResultDraw {
-			pgnChessGame.PgnParsed.Draw = true
-		}
+	return pngChessGames, nil
+}
 
-		pgnChessGame.ChessComFinishedGame = &gamesForUser.Games[i]
-		pgnChessGame.URL = gamesForUser.Games[i].URL
+// setChessComResults sets the result fields of game from the
+// results reported by chess.com for finishedGame.
+func setChessComResults(game *chessGame, finishedGame *chessComFinishedGame) {
+	// Set boolean fields for HTML rendering for black
+	if finishedGame.Black.Result == ChessComResultWin {
+		game.PgnParsed.BlackWon = true
+	} else if finishedGame.Black.Result == ChessComResultCheckmated {
+		game.PgnParsed.BlackWasCheckmated = true
+	} else if finishedGame.Black.Result == ChessComResultResigned {
+		game.PgnParsed.BlackResigned = true
+	} else if finishedGame.Black.Result == ChessComResultTimeout {
+		game.PgnParsed.BlackTimedOut = true
+	} else if finishedGame.Black.Result == ChessComResultAgreed {
+		game.PgnParsed.BlackAgreed = true
+	} else if finishedGame.Black.Result == ChessComResultInsufficient || finishedGame.Black.Result == ChessComResultTimeVsInsufficient {
+		game.PgnParsed.BlackInsufficient = true
+	}
 
-		pngChessGames[i] = pgnChessGame
+	// Set boolean fields for HTML rendering for white
+	if finishedGame.White.Result == ChessComResultWin {
+		game.PgnParsed.WhiteWon = true
+	} else if finishedGame.White.Result == ChessComResultCheckmated {
+		game.PgnParsed.WhiteWasCheckmated = true
+	} else if finishedGame.White.Result == ChessComResultResigned {
+		game.PgnParsed.WhiteResigned = true
+	} else if finishedGame.White.Result == ChessComResultTimeout {
+		game.PgnParsed.WhiteTimedOut = true
+	} else if finishedGame.White.Result == ChessComResultAgreed {
+		game.PgnParsed.WhiteAgreed = true
+	} else if finishedGame.White.Result == ChessComResultInsufficient || finishedGame.White.Result == ChessComResultTimeVsInsufficient {
+		game.PgnParsed.WhiteInsufficient = true
 	}
 
-	return pngChessGames, nil
+	// chess.com knows how games ended even when the PGN does not say.
+	game.PgnParsed.EndedBy = terminationFromChessCom(finishedGame)
+
+	game.ChessComFinishedGame = finishedGame
 }
@@ -0,0 +1,208 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// retryBaseDelay is the delay before the first retry. It doubles
+	// on every attempt up to retryMaxDelay, with full jitter.
+	retryBaseDelay = 250 * time.Millisecond
+	retryMaxDelay  = 10 * time.Second
+
+	// maxRetryAfter caps how long a Retry-After header can make us wait.
+	maxRetryAfter = 60 * time.Second
+)
+
+// chessComStatusError is returned when chess.com answers with
+// a status code other than 200 OK.
+type chessComStatusError struct {
+	URL        string
+	StatusCode int
+}
+
+func (e *chessComStatusError) Error() string {
+	return fmt.Sprintf("chess.com returned status %d for %s", e.StatusCode, e.URL)
+}
+
+// chessComTransport is the http.RoundTripper used for every request to
+// chess.com. It caps the number of concurrent requests, gives each
+// attempt its own timeout and retries idempotent requests which failed
+// or were answered with 429 or 5xx, waiting with jittered exponential
+// backoff or as long as the Retry-After header asks for.
+type chessComTransport struct {
+	base           http.RoundTripper
+	attemptTimeout time.Duration
+	retries        int
+
+	// slots limits the number of requests in flight.
+	slots chan struct{}
+
+	randMutex sync.Mutex
+	rand      *rand.Rand
+}
+
+func newChessComTransport(base http.RoundTripper, attemptTimeout time.Duration, retries, concurrency int) *chessComTransport {
+	return &chessComTransport{
+		base:           base,
+		attemptTimeout: attemptTimeout,
+		retries:        retries,
+		slots:          make(chan struct{}, concurrency),
+		rand:           rand.New(rand.NewSource(time.Now().UnixNano())),
+	}
+}
+
+// RoundTrip implements http.RoundTripper.
+func (t *chessComTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	ctx := req.Context()
+
+	retries := t.retries
+	if req.Method != http.MethodGet && req.Method != http.MethodHead {
+		retries = 0
+	}
+
+	for attempt := 0; ; attempt++ {
+		resp, err := t.roundTripOnce(req)
+
+		retryable := err != nil || resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500
+		if !retryable || attempt >= retries || ctx.Err() != nil {
+			return resp, err
+		}
+
+		chessComRetriesTotal.WithLabelValues(chessComEndpoint(req.URL.String())).Inc()
+
+		delay := t.backoff(attempt)
+		if resp != nil {
+			if retryAfter, ok := parseRetryAfter(resp.Header.Get("Retry-After")); ok {
+				delay = retryAfter
+			}
+
+			// Drain and close the body so the connection can be reused.
+			io.Copy(io.Discard, resp.Body)
+			resp.Body.Close()
+		}
+
+		fields := logrus.Fields{
+			"url":     req.URL.String(),
+			"attempt": attempt,
+			"delay":   delay,
+		}
+		if resp != nil {
+			fields["status"] = resp.StatusCode
+		}
+		entry := loggerFromContext(ctx).WithFields(fields)
+		if err != nil {
+			entry = entry.WithError(err)
+		}
+		entry.Warn("chess.com request failed, retrying")
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
+
+// roundTripOnce does a single attempt, holding a concurrency slot
+// until the response body is closed.
+func (t *chessComTransport) roundTripOnce(req *http.Request) (resp *http.Response, err error) {
+	ctx := req.Context()
+
+	select {
+	case t.slots <- struct{}{}:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+
+	start := time.Now()
+	attemptCtx, cancel := context.WithTimeout(ctx, t.attemptTimeout)
+
+	resp, err = t.base.RoundTrip(req.Clone(attemptCtx))
+	if err == nil && (resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500) {
+		observeChessComRequest(req.URL.String(), time.Since(start), &chessComStatusError{URL: req.URL.String(), StatusCode: resp.StatusCode})
+	} else {
+		observeChessComRequest(req.URL.String(), time.Since(start), err)
+	}
+
+	if err != nil {
+		cancel()
+		<-t.slots
+		return nil, err
+	}
+
+	resp.Body = &releasingBody{
+		ReadCloser: resp.Body,
+		release: func() {
+			cancel()
+			<-t.slots
+		},
+	}
+
+	return resp, nil
+}
+
+// backoff returns the delay before retrying after attempt,
+// picked at random up to an exponentially growing maximum.
+func (t *chessComTransport) backoff(attempt int) time.Duration {
+	maxDelay := retryBaseDelay << uint(attempt)
+	if maxDelay > retryMaxDelay || maxDelay <= 0 {
+		maxDelay = retryMaxDelay
+	}
+
+	t.randMutex.Lock()
+	defer t.randMutex.Unlock()
+
+	return time.Duration(t.rand.Int63n(int64(maxDelay))) + time.Millisecond
+}
+
+// parseRetryAfter parses a Retry-After header, either in seconds or as
+// an HTTP date. The returned delay is capped at maxRetryAfter.
+func parseRetryAfter(header string) (time.Duration, bool) {
+	if header == "" {
+		return 0, false
+	}
+
+	delay := time.Duration(0)
+	if seconds, err := strconv.Atoi(header); err == nil {
+		delay = time.Duration(seconds) * time.Second
+	} else if date, err := http.ParseTime(header); err == nil {
+		delay = time.Until(date)
+	} else {
+		return 0, false
+	}
+
+	if delay < 0 {
+		delay = 0
+	}
+
+	if delay > maxRetryAfter {
+		delay = maxRetryAfter
+	}
+
+	return delay, true
+}
+
+// releasingBody calls release once when the body is closed.
+type releasingBody struct {
+	io.ReadCloser
+	once    sync.Once
+	release func()
+}
+
+func (b *releasingBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.once.Do(b.release)
+	return err
+}
@@ -0,0 +1,231 @@
+package main
+
+import (
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestParseRetryAfter(t *testing.T) {
+	tests := []struct {
+		name   string
+		header string
+		want   time.Duration
+		wantOK bool
+	}{
+		{name: "missing", header: ""},
+		{name: "not a delay", header: "soon"},
+		{name: "seconds", header: "3", want: 3 * time.Second, wantOK: true},
+		{name: "zero", header: "0", want: 0, wantOK: true},
+		{name: "negative seconds", header: "-5", want: 0, wantOK: true},
+		{name: "seconds over the cap", header: "120", want: maxRetryAfter, wantOK: true},
+		{name: "date in the past", header: time.Now().Add(-time.Hour).UTC().Format(http.TimeFormat), want: 0, wantOK: true},
+		{name: "date over the cap", header: time.Now().Add(time.Hour).UTC().Format(http.TimeFormat), want: maxRetryAfter, wantOK: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := parseRetryAfter(tt.header)
+			if got != tt.want || ok != tt.wantOK {
+				t.Errorf("parseRetryAfter(%q) = %s, %t, want %s, %t", tt.header, got, ok, tt.want, tt.wantOK)
+			}
+		})
+	}
+
+	// HTTP dates have a precision of a second.
+	header := time.Now().Add(30 * time.Second).UTC().Format(http.TimeFormat)
+	got, ok := parseRetryAfter(header)
+	if !ok || got < 28*time.Second || got > 30*time.Second {
+		t.Errorf("parseRetryAfter(%q) = %s, %t, want about 30s", header, got, ok)
+	}
+}
+
+func TestChessComTransportBackoff(t *testing.T) {
+	transport := newChessComTransport(nil, time.Second, 2, 1)
+
+	for attempt := 0; attempt < 70; attempt++ {
+		maxDelay := retryMaxDelay
+		if attempt < 10 && retryBaseDelay<<uint(attempt) < retryMaxDelay {
+			maxDelay = retryBaseDelay << uint(attempt)
+		}
+
+		for i := 0; i < 20; i++ {
+			delay := transport.backoff(attempt)
+			if delay <= 0 || delay > maxDelay+time.Millisecond {
+				t.Fatalf("backoff(%d) = %s, want between 0 and %s", attempt, delay, maxDelay)
+			}
+		}
+	}
+}
+
+// statusServer answers with statuses in order, then with 200 OK,
+// counting the requests it gets.
+type statusServer struct {
+	mutex      sync.Mutex
+	statuses   []int
+	retryAfter string
+	requests   int
+}
+
+func (s *statusServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mutex.Lock()
+	s.requests++
+	status := http.StatusOK
+	if len(s.statuses) > 0 {
+		status, s.statuses = s.statuses[0], s.statuses[1:]
+	}
+	s.mutex.Unlock()
+
+	if s.retryAfter != "" {
+		w.Header().Set("Retry-After", s.retryAfter)
+	}
+	w.WriteHeader(status)
+	io.WriteString(w, http.StatusText(status))
+}
+
+func TestChessComTransportRetries(t *testing.T) {
+	tests := []struct {
+		name         string
+		method       string
+		statuses     []int
+		retryAfter   string
+		wantStatus   int
+		wantRequests int
+	}{
+		{name: "success", method: http.MethodGet, wantStatus: 200, wantRequests: 1},
+		{name: "server error then success", method: http.MethodGet, statuses: []int{503}, wantStatus: 200, wantRequests: 2},
+		{name: "rate limited with retry after", method: http.MethodGet, statuses: []int{429, 429}, retryAfter: "0", wantStatus: 200, wantRequests: 3},
+		{name: "retries exhausted", method: http.MethodGet, statuses: []int{500, 502, 503, 504}, wantStatus: 503, wantRequests: 3},
+		{name: "not found is not retried", method: http.MethodGet, statuses: []int{404}, wantStatus: 404, wantRequests: 1},
+		{name: "bad request is not retried", method: http.MethodGet, statuses: []int{400}, wantStatus: 400, wantRequests: 1},
+		{name: "head is retried", method: http.MethodHead, statuses: []int{503}, wantStatus: 200, wantRequests: 2},
+		{name: "post is not retried", method: http.MethodPost, statuses: []int{503}, wantStatus: 503, wantRequests: 1},
+		{name: "put is not retried", method: http.MethodPut, statuses: []int{429}, retryAfter: "0", wantStatus: 429, wantRequests: 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := &statusServer{statuses: tt.statuses, retryAfter: tt.retryAfter}
+			ts := httptest.NewServer(server)
+			defer ts.Close()
+
+			client := &http.Client{Transport: newChessComTransport(http.DefaultTransport, time.Second, 2, 4)}
+
+			req, err := http.NewRequest(tt.method, ts.URL, strings.NewReader(""))
+			if err != nil {
+				t.Fatalf("could not create request: %s", err)
+			}
+
+			resp, err := client.Do(req)
+			if err != nil {
+				t.Fatalf("Do() error = %v", err)
+			}
+			ioutil.ReadAll(resp.Body)
+			resp.Body.Close()
+
+			if resp.StatusCode != tt.wantStatus {
+				t.Errorf("status = %d, want %d", resp.StatusCode, tt.wantStatus)
+			}
+			if server.requests != tt.wantRequests {
+				t.Errorf("server got %d requests, want %d", server.requests, tt.wantRequests)
+			}
+		})
+	}
+}
+
+func TestChessComTransportConcurrency(t *testing.T) {
+	const concurrency = 2
+
+	var mutex sync.Mutex
+	inFlight, maxInFlight, requests := 0, 0, 0
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mutex.Lock()
+		inFlight++
+		requests++
+		if inFlight > maxInFlight {
+			maxInFlight = inFlight
+		}
+		mutex.Unlock()
+
+		time.Sleep(20 * time.Millisecond)
+
+		mutex.Lock()
+		inFlight--
+		mutex.Unlock()
+	}))
+	defer ts.Close()
+
+	client := &http.Client{Transport: newChessComTransport(http.DefaultTransport, time.Second, 0, concurrency)}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			resp, err := client.Get(ts.URL)
+			if err != nil {
+				t.Errorf("Get() error = %v", err)
+				return
+			}
+			ioutil.ReadAll(resp.Body)
+			resp.Body.Close()
+		}()
+	}
+	wg.Wait()
+
+	if requests != 10 {
+		t.Errorf("server got %d requests, want 10", requests)
+	}
+	if maxInFlight > concurrency {
+		t.Errorf("%d requests were in flight at once, want at most %d", maxInFlight, concurrency)
+	}
+	if maxInFlight < concurrency {
+		t.Errorf("at most %d requests were in flight at once, want %d", maxInFlight, concurrency)
+	}
+}
+
+func TestChessComTransportSlotHeldUntilBodyClosed(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "ok")
+	}))
+	defer ts.Close()
+
+	client := &http.Client{Transport: newChessComTransport(http.DefaultTransport, time.Second, 0, 1)}
+
+	first, err := client.Get(ts.URL)
+	if err != nil {
+		t.Fatalf("Get() error = %v", err)
+	}
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+
+		resp, err := client.Get(ts.URL)
+		if err != nil {
+			t.Errorf("Get() error = %v", err)
+			return
+		}
+		resp.Body.Close()
+	}()
+
+	select {
+	case <-done:
+		t.Fatalf("second request went through while the first body was open")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	first.Body.Close()
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatalf("second request did not go through once the first body was closed")
+	}
+}
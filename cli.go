@@ -0,0 +1,474 @@
+package main
+
+import (
+	"context"
+	"encoding/csv"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"sort"
+	"strconv"
+	"strings"
+	"syscall"
+	"text/tabwriter"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+const usage = `usage: chess-club <command> [flags]
+
+Commands:
+  serve    start the HTTP server (default)
+  sync     fill the game store with club games from chess.com
+  stats    print standings, head-to-head records and how games ended
+  export   write club games to stdout as PGN or CSV
+  import   import PGN files or directories into the game store
+  analyze  analyze club games in the game store with a UCI engine
+
+Run "chess-club <command> -h" for the flags of each command.
+`
+
+// loadConfig parses args with flags, which must include the config
+// flags, and sets the application up. It exits on error.
+func loadConfig(flags *flag.FlagSet, cfgFlags *configFlags, args []string) config {
+	flags.Parse(args)
+
+	cfg, err := cfgFlags.resolve(flags)
+	if err != nil {
+		logrus.WithError(err).Fatal("invalid config")
+	}
+
+	err = setup(cfg)
+	if err != nil {
+		logrus.WithError(err).Fatal("could not set up")
+	}
+
+	return cfg
+}
+
+// runCommand runs the command named in args, serve if there is none.
+func runCommand(args []string) {
+	command := "serve"
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		command, args = args[0], args[1:]
+	}
+
+	switch command {
+	case "serve":
+		runServe(args)
+	case "sync":
+		runSync(args)
+	case "stats":
+		runStats(args)
+	case "export":
+		runExport(args)
+	case "import":
+		runImport(args)
+	case "analyze":
+		runAnalyze(args)
+	case "help":
+		fmt.Fprint(os.Stdout, usage)
+	default:
+		fmt.Fprintf(os.Stderr, "unknown command %q\n\n%s", command, usage)
+		os.Exit(2)
+	}
+}
+
+// period is a month (Month > 0), a whole season (Month == 0)
+// or all time (Year == 0). A season is a calendar year.
+type period struct {
+	Year  int
+	Month int
+}
+
+// parsePeriod builds a period from the -month (YYYY-MM) and -season
+// (YYYY) flags. The current season is used when neither is set.
+func parsePeriod(monthFlag, seasonFlag string) (period, error) {
+	if monthFlag != "" && seasonFlag != "" {
+		return period{}, fmt.Errorf("only one of -month and -season can be set")
+	}
+
+	if monthFlag != "" {
+		t, err := time.Parse("2006-01", monthFlag)
+		if err != nil {
+			return period{}, fmt.Errorf("invalid month %q, expected YYYY-MM", monthFlag)
+		}
+		return period{Year: t.Year(), Month: int(t.Month())}, nil
+	}
+
+	if seasonFlag != "" {
+		year, err := strconv.Atoi(seasonFlag)
+		if err != nil || year < 1900 {
+			return period{}, fmt.Errorf("invalid season %q, expected YYYY", seasonFlag)
+		}
+		return period{Year: year}, nil
+	}
+
+	return period{Year: time.Now().Year()}, nil
+}
+
+func (p period) contains(t time.Time) bool {
+	if p.Year == 0 {
+		return true
+	}
+
+	if t.Year() != p.Year {
+		return false
+	}
+
+	return p.Month == 0 || int(t.Month()) == p.Month
+}
+
+func (p period) String() string {
+	if p.Year == 0 {
+		return "All time"
+	}
+
+	if p.Month == 0 {
+		return fmt.Sprintf("%d season", p.Year)
+	}
+
+	return fmt.Sprintf("%s %d", time.Month(p.Month), p.Year)
+}
+
+// clubGamesForPeriod returns the club games in the game store played
+// during p, most recent first.
+func clubGamesForPeriod(p period) []chessGame {
+	games := []chessGame{}
+	for _, game := range store.allGames() {
+		if isClubGame(club.Members, game) && p.contains(game.PgnParsed.ParsedEndtime) {
+			games = append(games, game)
+		}
+	}
+
+	sort.Sort(chessGamesByEndTimeDesc(games))
+
+	return games
+}
+
+// runSync fetches finished games of every club member from chess.com
+// and adds the games played between members to the game store.
+func runSync(args []string) {
+	flags := flag.NewFlagSet("sync", flag.ExitOnError)
+	cfgFlags := addConfigFlags(flags)
+	monthFlag := flags.String("month", "", "only sync the passed month (YYYY-MM) instead of every archive")
+	loadConfig(flags, cfgFlags, args)
+
+	var p period
+	if *monthFlag != "" {
+		var err error
+		p, err = parsePeriod(*monthFlag, "")
+		if err != nil {
+			logrus.WithError(err).Fatal("invalid flags")
+		}
+	}
+
+	// Stop fetching on Ctrl+C, games already stored are kept.
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	total, err := syncClubGames(ctx, p)
+	if err != nil {
+		logrus.WithError(err).WithField("added", total).Fatal("sync failed")
+	}
+
+	logrus.WithField("added", total).Info("sync complete")
+}
+
+// syncClubGames adds the club games of every member played during p,
+// or in every archive if p is not set, to the game store. It returns
+// the number of games added, and stops at the first game store error.
+func syncClubGames(ctx context.Context, p period) (int, error) {
+	total := 0
+	for _, member := range club.Members {
+		if ctx.Err() != nil {
+			logrus.Warn("sync interrupted")
+			break
+		}
+
+		var games []chessGame
+		var err error
+		if p.Month > 0 {
+			games, err = getUserFinishedGamesForYearMonth(ctx, member, p.Year, p.Month)
+		} else {
+			games, err = getUserFinishedGames(ctx, member)
+		}
+		if err != nil {
+			logrus.WithError(err).WithField("member", member).Error("could not get finished games")
+			continue
+		}
+
+		records := chessComGameRecords(club.Members, games)
+
+		added, err := store.add(records...)
+		total += added
+		if err != nil {
+			return total, fmt.Errorf("could not store games of %s: %w", member, err)
+		}
+
+		logrus.WithFields(logrus.Fields{
+			"member": member,
+			"games":  len(records),
+			"added":  added,
+		}).Info("member synced")
+	}
+
+	return total, nil
+}
+
+// runStats prints the standings, head-to-head records and how games
+// ended for a month, a season or all time from the games in the game store.
+func runStats(args []string) {
+	flags := flag.NewFlagSet("stats", flag.ExitOnError)
+	cfgFlags := addConfigFlags(flags)
+	monthFlag := flags.String("month", "", "month to print stats for (YYYY-MM)")
+	seasonFlag := flags.String("season", "", "season to print stats for (YYYY), defaults to the current one")
+	allFlag := flags.Bool("all", false, "print stats for every game in the game store")
+	loadConfig(flags, cfgFlags, args)
+
+	p, err := parsePeriod(*monthFlag, *seasonFlag)
+	if err == nil && *allFlag {
+		if *monthFlag != "" || *seasonFlag != "" {
+			err = fmt.Errorf("-all cannot be set with -month or -season")
+		}
+		p = period{}
+	}
+	if err != nil {
+		logrus.WithError(err).Fatal("invalid flags")
+	}
+
+	games := clubGamesForPeriod(p)
+
+	printStats(os.Stdout, p, games)
+}
+
+// printStats writes the standings, head-to-head and termination
+// tables for games.
+func printStats(out io.Writer, p period, games []chessGame) {
+	fmt.Fprintf(out, "%s - %s (%d games)\n\n", club.Name, p, len(games))
+
+	userStatsMap := newUserStatsMap(club.Members)
+	for _, game := range games {
+		addGameToUserStats(userStatsMap, game)
+	}
+	standings := userStatsSlice(userStatsMap)
+
+	tw := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "Player\tWins\tLosses\tDraws\tPoints\tWin %\tWin Streak")
+	for _, stats := range standings {
+		fmt.Fprintf(tw, "%s\t%d\t%d\t%d\t%g\t%g\t%d\n", stats.User, stats.Wins, stats.Losses, stats.Draws, stats.Points, stats.WinPercentage, stats.WinStreak)
+	}
+	tw.Flush()
+
+	fmt.Fprintln(out, "\nHead to head (W-D-L)")
+
+	tw = tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "Player\tOpponent\tRecord")
+	for _, stats := range getHeadToHeadStats(club.Members, games) {
+		fmt.Fprintf(tw, "%s\t%s\t%d-%d-%d\n", stats.Player, stats.Opponent, stats.Wins, stats.Draws, stats.Losses)
+	}
+	tw.Flush()
+
+	fmt.Fprintln(out, "\nHow games ended")
+
+	tw = tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "Player\tWins\tLosses\tDraws")
+	for _, stats := range standings {
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", stats.User, stats.Terminations.WinSummary(), stats.Terminations.LossSummary(), stats.Terminations.DrawSummary())
+	}
+	tw.Flush()
+}
+
+// runExport writes the club games in the game store to stdout.
+func runExport(args []string) {
+	flags := flag.NewFlagSet("export", flag.ExitOnError)
+	cfgFlags := addConfigFlags(flags)
+	format := flags.String("format", "pgn", "output format: pgn or csv")
+	monthFlag := flags.String("month", "", "only export the passed month (YYYY-MM)")
+	seasonFlag := flags.String("season", "", "only export the passed season (YYYY), defaults to the current one")
+	loadConfig(flags, cfgFlags, args)
+
+	p, err := parsePeriod(*monthFlag, *seasonFlag)
+	if err != nil {
+		logrus.WithError(err).Fatal("invalid flags")
+	}
+
+	games := clubGamesForPeriod(p)
+
+	switch *format {
+	case "pgn":
+		err = exportPgn(os.Stdout, games)
+	case "csv":
+		err = exportCSV(os.Stdout, games)
+	default:
+		err = fmt.Errorf("unknown format %q", *format)
+	}
+	if err != nil {
+		logrus.WithError(err).Fatal("could not export games")
+	}
+}
+
+// exportPgn writes games to out as a multi-game PGN file.
+func exportPgn(out io.Writer, games []chessGame) error {
+	for _, game := range games {
+		_, err := fmt.Fprintf(out, "%s\n\n", game.ChessGame.String())
+		if err != nil {
+			return fmt.Errorf("could not write pgn: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// exportCSV writes one line per game to out in CSV format.
+func exportCSV(out io.Writer, games []chessGame) error {
+	w := csv.NewWriter(out)
+
+	err := w.Write([]string{"id", "source", "end_time", "white", "black", "result", "termination", "eco"})
+	if err != nil {
+		return fmt.Errorf("could not write csv: %w", err)
+	}
+
+	for _, game := range games {
+		err = w.Write([]string{
+			game.URL,
+			game.Source,
+			game.PgnParsed.ParsedEndtime.Format(time.RFC3339),
+			game.PgnParsed.White,
+			game.PgnParsed.Black,
+			game.PgnParsed.Result,
+			game.PgnParsed.Termination,
+			game.PgnParsed.ECO,
+		})
+		if err != nil {
+			return fmt.Errorf("could not write csv: %w", err)
+		}
+	}
+
+	w.Flush()
+
+	return w.Error()
+}
+
+// runImport imports the PGN files and directories passed as arguments
+// into the game store.
+func runImport(args []string) {
+	flags := flag.NewFlagSet("import", flag.ExitOnError)
+	cfgFlags := addConfigFlags(flags)
+	source := flags.String("source", GameSourcePgnImport, "source to tag the imported games with")
+	loadConfig(flags, cfgFlags, args)
+
+	if flags.NArg() == 0 {
+		fmt.Fprintln(os.Stderr, "usage: chess-club import [-source name] path...")
+		os.Exit(2)
+	}
+
+	for _, path := range flags.Args() {
+		result, err := importPgnPath(path, *source)
+		for _, importErr := range result.Errors {
+			logrus.WithField("path", path).Warn(importErr)
+		}
+		if err != nil {
+			logrus.WithError(err).WithField("path", path).Fatal("could not import pgn")
+		}
+
+		logrus.WithFields(logrus.Fields{
+			"path":       path,
+			"added":      result.Added,
+			"duplicates": result.Duplicates,
+			"errors":     len(result.Errors),
+		}).Info("pgn import complete")
+	}
+}
+
+// runAnalyze analyzes the finished club games in the game store with
+// the configured UCI engine and adds the results to the analysis store.
+// Games already analyzed are skipped unless -force is set.
+func runAnalyze(args []string) {
+	flags := flag.NewFlagSet("analyze", flag.ExitOnError)
+	cfgFlags := addConfigFlags(flags)
+	monthFlag := flags.String("month", "", "only analyze the passed month (YYYY-MM)")
+	seasonFlag := flags.String("season", "", "only analyze the passed season (YYYY), defaults to the current one")
+	force := flags.Bool("force", false, "analyze games again even if they already have been")
+	cfg := loadConfig(flags, cfgFlags, args)
+
+	if cfg.EnginePath == "" {
+		logrus.Fatal("no engine configured, set -engine or CHESS_CLUB_ENGINE_PATH")
+	}
+
+	p, err := parsePeriod(*monthFlag, *seasonFlag)
+	if err != nil {
+		logrus.WithError(err).Fatal("invalid flags")
+	}
+
+	// Stop analyzing on Ctrl+C, games already analyzed are kept.
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	total, err := analyzeClubGames(ctx, cfg, p, *force)
+	if err != nil {
+		logrus.WithError(err).WithField("analyzed", total).Fatal("analysis failed")
+	}
+
+	logrus.WithField("analyzed", total).Info("analysis complete")
+}
+
+// analyzeClubGames analyzes the club games played during p with the
+// configured engine. It returns the number of games analyzed. The
+// engine is stopped and the analyses are saved before it returns,
+// including when the analysis store fails or ctx is cancelled.
+func analyzeClubGames(ctx context.Context, cfg config, p period, force bool) (total int, err error) {
+	analyzer, err := newEngineAnalyzer(ctx, cfg.EnginePath, cfg.EngineDepth)
+	if err != nil {
+		return 0, fmt.Errorf("could not start engine: %w", err)
+	}
+	defer analyzer.close()
+
+	for _, game := range clubGamesForPeriod(p) {
+		if ctx.Err() != nil {
+			logrus.Warn("analysis interrupted")
+			break
+		}
+
+		// In progress games and games rebuilt from their final
+		// position have nothing to analyze.
+		if game.PgnParsed.Result == PgnResultInProgress || len(game.ChessGame.Moves()) == 0 {
+			continue
+		}
+
+		if !force && analyses.get(game.URL) != nil {
+			continue
+		}
+
+		analysis, analyzeErr := analyzer.analyze(ctx, game)
+		if analyzeErr != nil {
+			logrus.WithError(analyzeErr).WithField("game", game.URL).Error("could not analyze game")
+			continue
+		}
+
+		err = analyses.set(analysis)
+		if err != nil {
+			err = fmt.Errorf("could not store analysis of %s: %w", game.URL, err)
+			break
+		}
+		total++
+
+		white, black := analysis.playerAnalyses()
+		logrus.WithFields(logrus.Fields{
+			"game":       game.URL,
+			"white_acpl": fmt.Sprintf("%.1f", white.ACPL()),
+			"black_acpl": fmt.Sprintf("%.1f", black.ACPL()),
+		}).Info("game analyzed")
+	}
+
+	// Analyses are saved in batches, save the last ones,
+	// including when the analysis was interrupted.
+	if saveErr := analyses.save(); saveErr != nil && err == nil {
+		err = fmt.Errorf("could not store analyses: %w", saveErr)
+	}
+
+	return total, err
+}
@@ -0,0 +1,277 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParsePeriod(t *testing.T) {
+	tests := []struct {
+		name    string
+		month   string
+		season  string
+		want    period
+		wantErr bool
+	}{
+		{name: "default season", want: period{Year: time.Now().Year()}},
+		{name: "month", month: "2021-05", want: period{Year: 2021, Month: 5}},
+		{name: "season", season: "2020", want: period{Year: 2020}},
+		{name: "month and season", month: "2021-05", season: "2021", wantErr: true},
+		{name: "month out of range", month: "2021-13", wantErr: true},
+		{name: "month name", month: "May", wantErr: true},
+		{name: "month without year", month: "05", wantErr: true},
+		{name: "season not a year", season: "twenty", wantErr: true},
+		{name: "season too early", season: "1850", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parsePeriod(tt.month, tt.season)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parsePeriod(%q, %q) error = %v, wantErr %t", tt.month, tt.season, err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("parsePeriod(%q, %q) = %+v, want %+v", tt.month, tt.season, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLoadClubConfig(t *testing.T) {
+	tests := []struct {
+		name    string
+		file    string
+		want    clubConfig
+		wantErr string
+	}{
+		{
+			name: "valid",
+			file: `{"name": "Test Club", "members": ["alice", "bob"]}`,
+			want: clubConfig{Name: "Test Club", Members: []string{"alice", "bob"}},
+		},
+		{name: "not json", file: `name: Test Club`, wantErr: "could not unmarshal club file"},
+		{name: "one member", file: `{"name": "Test Club", "members": ["alice"]}`, wantErr: "at least two members"},
+		{name: "missing", wantErr: "could not read club file"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "club.json")
+			if tt.file != "" {
+				err := ioutil.WriteFile(path, []byte(tt.file), 0644)
+				if err != nil {
+					t.Fatalf("could not write club file: %s", err)
+				}
+			}
+
+			got, err := loadClubConfig(path)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("loadClubConfig() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("loadClubConfig() error = %v", err)
+			}
+			if got.Name != tt.want.Name || strings.Join(got.Members, ",") != strings.Join(tt.want.Members, ",") {
+				t.Errorf("loadClubConfig() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+// syncFixtureGames syncs the games of every fixture archive
+// into the game store and returns the club games, most recent first.
+func syncFixtureGames(t *testing.T) []chessGame {
+	t.Helper()
+
+	newFakeChessCom(t, fakeChessComFixtures, "alice", "bob", "carol")
+
+	added, err := syncClubGames(context.Background(), period{})
+	if err != nil {
+		t.Fatalf("syncClubGames() error = %v", err)
+	}
+	if added != 4 {
+		t.Fatalf("syncClubGames() added %d games, want 4", added)
+	}
+
+	// Syncing again adds nothing.
+	added, err = syncClubGames(context.Background(), period{})
+	if err != nil || added != 0 {
+		t.Fatalf("syncClubGames() again = %d, %v, want 0, nil", added, err)
+	}
+
+	return clubGamesForPeriod(period{})
+}
+
+func TestExportCSV(t *testing.T) {
+	games := syncFixtureGames(t)
+
+	out := &bytes.Buffer{}
+	err := exportCSV(out, games)
+	if err != nil {
+		t.Fatalf("exportCSV() error = %v", err)
+	}
+
+	rows, err := csv.NewReader(out).ReadAll()
+	if err != nil {
+		t.Fatalf("could not read exported csv: %s", err)
+	}
+
+	want := [][]string{
+		{"id", "source", "end_time", "white", "black", "result", "termination", "eco"},
+		{"https://www.chess.com/game/live/1002", "chess.com", "2021-05-12T20:05:00Z", "bob", "carol", "1/2-1/2", "Game drawn by agreement", "D02"},
+		{"https://www.chess.com/game/live/1001", "chess.com", "2021-05-03T19:30:00Z", "alice", "bob", "1-0", "alice won by checkmate", "C50"},
+		{"https://www.chess.com/game/live/1004", "chess.com", "2021-04-08T21:15:00Z", "carol", "alice", "1-0", "carol won by resignation", "C42"},
+		{"https://www.chess.com/game/live/1007", "chess.com", "2020-12-28T22:40:00Z", "bob", "alice", "0-1", "alice won on time", "B20"},
+	}
+
+	if len(rows) != len(want) {
+		t.Fatalf("exportCSV() wrote %d rows, want %d", len(rows), len(want))
+	}
+	for i := range want {
+		if strings.Join(rows[i], ",") != strings.Join(want[i], ",") {
+			t.Errorf("row %d = %q, want %q", i, rows[i], want[i])
+		}
+	}
+}
+
+func TestExportPgn(t *testing.T) {
+	games := syncFixtureGames(t)
+
+	out := &bytes.Buffer{}
+	err := exportPgn(out, games)
+	if err != nil {
+		t.Fatalf("exportPgn() error = %v", err)
+	}
+
+	// The export can be imported back.
+	exported, err := splitPgnGames(out)
+	if err != nil {
+		t.Fatalf("splitPgnGames() error = %v", err)
+	}
+	if len(exported) != len(games) {
+		t.Fatalf("exportPgn() wrote %d games, want %d", len(exported), len(games))
+	}
+
+	for i, pgn := range exported {
+		game, err := getChessGame(pgn)
+		if err != nil {
+			t.Fatalf("exported game %d cannot be parsed: %s", i, err)
+		}
+
+		want := games[i].PgnParsed
+		got := game.PgnParsed
+		if got.White != want.White || got.Black != want.Black || got.Result != want.Result || got.ECO != want.ECO {
+			t.Errorf("exported game %d is %s-%s %s %s, want %s-%s %s %s", i, got.White, got.Black, got.Result, got.ECO, want.White, want.Black, want.Result, want.ECO)
+		}
+		if len(game.ChessGame.Moves()) != len(games[i].ChessGame.Moves()) {
+			t.Errorf("exported game %d has %d moves, want %d", i, len(game.ChessGame.Moves()), len(games[i].ChessGame.Moves()))
+		}
+	}
+}
+
+func TestGetHeadToHeadStats(t *testing.T) {
+	games := syncFixtureGames(t)
+
+	want := map[string][3]int{
+		"alice-bob":   {2, 0, 0},
+		"alice-carol": {0, 0, 1},
+		"bob-alice":   {0, 0, 2},
+		"bob-carol":   {0, 1, 0},
+		"carol-alice": {1, 0, 0},
+		"carol-bob":   {0, 1, 0},
+	}
+
+	stats := getHeadToHeadStats(club.Members, games)
+	if len(stats) != len(want) {
+		t.Errorf("getHeadToHeadStats() returned %d pairs, want %d", len(stats), len(want))
+	}
+
+	total := 0
+	for _, s := range stats {
+		key := s.Player + "-" + s.Opponent
+		if got := [3]int{s.Wins, s.Draws, s.Losses}; got != want[key] {
+			t.Errorf("%s W-D-L = %v, want %v", key, got, want[key])
+		}
+		total += s.Wins + s.Draws + s.Losses
+	}
+
+	// Each game counts once for each player.
+	if total != 2*len(games) {
+		t.Errorf("head to head records add up to %d results, want %d", total, 2*len(games))
+	}
+}
+
+func TestPrintStats(t *testing.T) {
+	games := syncFixtureGames(t)
+
+	out := &bytes.Buffer{}
+	printStats(out, period{}, games)
+
+	assertGolden(t, "stats_all.txt", out.Bytes())
+}
+
+func TestAnalyzeClubGames(t *testing.T) {
+	dir := t.TempDir()
+
+	// A file where the analysis store directory should be.
+	blocker := filepath.Join(dir, "blocker")
+	err := ioutil.WriteFile(blocker, nil, 0644)
+	if err != nil {
+		t.Fatalf("could not write file: %s", err)
+	}
+
+	tests := []struct {
+		name    string
+		path    string
+		wantErr string
+	}{
+		{name: "saved", path: filepath.Join(dir, "analysis.json")},
+		{name: "store cannot be saved", path: filepath.Join(blocker, "analysis.json"), wantErr: "could not store analyses"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			newFakeChessCom(t, fakeChessComFixtures, "alice", "bob")
+			analyses = &analysisStore{path: tt.path, analyses: make(map[string]gameAnalysis)}
+
+			_, err := store.add(storedGame{ID: "pgn:scholars-mate", Source: GameSourcePgnImport, Pgn: scholarsMatePgn})
+			if err != nil {
+				t.Fatalf("could not add game to the store: %s", err)
+			}
+
+			cfg := config{EnginePath: useFakeEngine(t, scholarsMateScript...), EngineDepth: 12}
+			total, err := analyzeClubGames(context.Background(), cfg, period{}, false)
+
+			if total != 1 {
+				t.Errorf("analyzeClubGames() analyzed %d games, want 1", total)
+			}
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("analyzeClubGames() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("analyzeClubGames() error = %v", err)
+			}
+
+			// The last batch is saved before returning.
+			saved, err := newAnalysisStore(tt.path)
+			if err != nil {
+				t.Fatalf("newAnalysisStore() error = %v", err)
+			}
+			if saved.get("pgn:scholars-mate") == nil {
+				t.Errorf("analysis was not saved")
+			}
+		})
+	}
+}
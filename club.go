@@ -0,0 +1,48 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+)
+
+// clubConfig describes the chess club: its name and the chess.com
+// usernames of its members. Only games between members are shown.
+type clubConfig struct {
+	Name    string   `json:"name"`
+	Members []string `json:"members"`
+}
+
+// club is the club used by the handlers and commands.
+// It can be replaced by loading a club file with loadClubConfig.
+var club = clubConfig{
+	Name: "AJC Chess Club",
+	Members: []string{
+		"PipoGambit",
+		"dalmu7",
+		"elcubanoaj",
+		"cdalmeida",
+		"maximuni",
+	},
+}
+
+// loadClubConfig reads a club file in JSON format, e.g.
+// {"name": "AJC Chess Club", "members": ["PipoGambit", "dalmu7"]}
+func loadClubConfig(path string) (clubConfig, error) {
+	fileBytes, err := ioutil.ReadFile(path)
+	if err != nil {
+		return clubConfig{}, fmt.Errorf("could not read club file %s: %w", path, err)
+	}
+
+	config := clubConfig{}
+	err = json.Unmarshal(fileBytes, &config)
+	if err != nil {
+		return clubConfig{}, fmt.Errorf("could not unmarshal club file %s: %w", path, err)
+	}
+
+	if len(config.Members) < 2 {
+		return clubConfig{}, fmt.Errorf("club file %s must have at least two members", path)
+	}
+
+	return config, nil
+}
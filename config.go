@@ -0,0 +1,376 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// redacted replaces secrets when the config is displayed.
+const redacted = "<redacted>"
+
+// duration is a time.Duration which is read from and written
+// to JSON as a string such as "15s".
+type duration time.Duration
+
+func (d duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
+
+func (d *duration) UnmarshalJSON(b []byte) error {
+	var s string
+	err := json.Unmarshal(b, &s)
+	if err != nil {
+		return fmt.Errorf("duration must be a string such as \"15s\": %w", err)
+	}
+
+	parsed, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+
+	*d = duration(parsed)
+	return nil
+}
+
+func (d duration) String() string { return time.Duration(d).String() }
+
+func (d *duration) Set(s string) error {
+	parsed, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+
+	*d = duration(parsed)
+	return nil
+}
+
+// config has every setting of the application. Settings are read,
+// from lowest to highest precedence, from the defaults, the config
+// file, CHESS_CLUB_* environment variables and command line flags.
+type config struct {
+	ListenAddr   string   `json:"listen_addr"`
+	ReadTimeout  duration `json:"read_timeout"`
+	WriteTimeout duration `json:"write_timeout"`
+	IdleTimeout  duration `json:"idle_timeout"`
+
+	// RequestBudget is the overall time a request to the server has
+	// to fetch everything it needs from chess.com.
+	RequestBudget duration `json:"request_budget"`
+
+	UpstreamTimeout duration `json:"upstream_timeout"`
+	UpstreamRetries int      `json:"upstream_retries"`
+
+	// UpstreamConcurrency caps the requests in flight to chess.com.
+	UpstreamConcurrency int `json:"upstream_concurrency"`
+
+	CacheDir string `json:"cache_dir"`
+
+	// StorePath is the game store file, <cache-dir>/games.json if empty.
+	StorePath string `json:"store_path"`
+
+	LogLevel  string `json:"log_level"`
+	LogFormat string `json:"log_format"`
+	ClubFile  string `json:"club_file"`
+
+	// EnginePath is the UCI engine used to analyze games,
+	// looked up in PATH if it has no slash.
+	EnginePath  string `json:"engine_path"`
+	EngineDepth int    `json:"engine_depth"`
+
+	// Secrets, never displayed. See redact.
+	AdminPassword string `json:"admin_password"`
+}
+
+// appConfig is the config in use. It is set by setup.
+var appConfig = defaultConfig()
+
+func defaultConfig() config {
+	cacheDir := ".chess-club"
+	home, err := os.UserHomeDir()
+	if err == nil {
+		cacheDir = filepath.Join(home, ".chess-club")
+	}
+
+	return config{
+		ListenAddr:      ":8889",
+		ReadTimeout:     duration(15 * time.Second),
+		WriteTimeout:    duration(60 * time.Second),
+		IdleTimeout:     duration(60 * time.Second),
+		RequestBudget:   duration(25 * time.Second),
+		UpstreamTimeout: duration(5 * time.Second),
+		UpstreamRetries: 2,
+		// chess.com asks clients to be gentle with parallel requests
+		UpstreamConcurrency: 4,
+		CacheDir:            cacheDir,
+		LogLevel:            "info",
+		LogFormat:           "text",
+		EngineDepth:         14,
+	}
+}
+
+// configFlags binds the config to command line flags.
+type configFlags struct {
+	cfg  config
+	path string
+}
+
+// addConfigFlags registers the config flags in flags.
+func addConfigFlags(flags *flag.FlagSet) *configFlags {
+	c := &configFlags{
+		cfg: defaultConfig(),
+	}
+
+	flags.StringVar(&c.path, "config", os.Getenv("CHESS_CLUB_CONFIG"), "path to a JSON config file")
+	flags.StringVar(&c.cfg.ListenAddr, "listen", c.cfg.ListenAddr, "address to listen on")
+	flags.Var(&c.cfg.ReadTimeout, "read-timeout", "HTTP server read timeout")
+	flags.Var(&c.cfg.WriteTimeout, "write-timeout", "HTTP server write timeout")
+	flags.Var(&c.cfg.IdleTimeout, "idle-timeout", "HTTP server idle timeout")
+	flags.Var(&c.cfg.RequestBudget, "request-budget", "overall time a request has to fetch from chess.com")
+	flags.Var(&c.cfg.UpstreamTimeout, "upstream-timeout", "timeout of each chess.com request")
+	flags.IntVar(&c.cfg.UpstreamRetries, "upstream-retries", c.cfg.UpstreamRetries, "number of times a failed chess.com request is retried")
+	flags.IntVar(&c.cfg.UpstreamConcurrency, "upstream-concurrency", c.cfg.UpstreamConcurrency, "maximum number of concurrent chess.com requests")
+	flags.StringVar(&c.cfg.CacheDir, "cache-dir", c.cfg.CacheDir, "directory for the game store and caches")
+	flags.StringVar(&c.cfg.StorePath, "store", c.cfg.StorePath, "path to the game store file (defaults to games.json in the cache directory)")
+	flags.StringVar(&c.cfg.LogLevel, "log-level", c.cfg.LogLevel, "log level: debug, info, warn or error")
+	flags.StringVar(&c.cfg.LogFormat, "log-format", c.cfg.LogFormat, "log format: text or json")
+	flags.StringVar(&c.cfg.ClubFile, "club", c.cfg.ClubFile, "path to a JSON club file (defaults to the built-in club)")
+	flags.StringVar(&c.cfg.EnginePath, "engine", c.cfg.EnginePath, "path to a UCI engine used to analyze games")
+	flags.IntVar(&c.cfg.EngineDepth, "engine-depth", c.cfg.EngineDepth, "depth in plies the engine searches each position to")
+
+	return c
+}
+
+// resolve builds the config once flags have been parsed, applying
+// the config file and environment variables under the flags that
+// were set explicitly.
+func (c *configFlags) resolve(flags *flag.FlagSet) (config, error) {
+
+	// Remember the flags which were set so they can be applied last.
+	setFlags := make(map[string]string)
+	flags.Visit(func(f *flag.Flag) {
+		setFlags[f.Name] = f.Value.String()
+	})
+
+	c.cfg = defaultConfig()
+
+	if c.path != "" {
+		fileBytes, err := ioutil.ReadFile(c.path)
+		if err != nil {
+			return config{}, fmt.Errorf("could not read config file %s: %w", c.path, err)
+		}
+
+		err = json.Unmarshal(fileBytes, &c.cfg)
+		if err != nil {
+			return config{}, fmt.Errorf("could not unmarshal config file %s: %w", c.path, err)
+		}
+	}
+
+	err := c.cfg.applyEnv()
+	if err != nil {
+		return config{}, err
+	}
+
+	for name, value := range setFlags {
+		err := flags.Set(name, value)
+		if err != nil {
+			return config{}, fmt.Errorf("invalid value for flag -%s: %w", name, err)
+		}
+	}
+
+	err = c.cfg.validate()
+	if err != nil {
+		return config{}, err
+	}
+
+	return c.cfg, nil
+}
+
+// applyEnv overrides the config with the CHESS_CLUB_* environment variables.
+func (cfg *config) applyEnv() error {
+	stringFields := map[string]*string{
+		"CHESS_CLUB_LISTEN_ADDR":    &cfg.ListenAddr,
+		"CHESS_CLUB_CACHE_DIR":      &cfg.CacheDir,
+		"CHESS_CLUB_STORE":          &cfg.StorePath,
+		"CHESS_CLUB_LOG_LEVEL":      &cfg.LogLevel,
+		"CHESS_CLUB_LOG_FORMAT":     &cfg.LogFormat,
+		"CHESS_CLUB_CLUB_FILE":      &cfg.ClubFile,
+		"CHESS_CLUB_ENGINE_PATH":    &cfg.EnginePath,
+		"CHESS_CLUB_ADMIN_PASSWORD": &cfg.AdminPassword,
+	}
+	for name, field := range stringFields {
+		if value, ok := os.LookupEnv(name); ok {
+			*field = value
+		}
+	}
+
+	durationFields := map[string]*duration{
+		"CHESS_CLUB_READ_TIMEOUT":     &cfg.ReadTimeout,
+		"CHESS_CLUB_WRITE_TIMEOUT":    &cfg.WriteTimeout,
+		"CHESS_CLUB_IDLE_TIMEOUT":     &cfg.IdleTimeout,
+		"CHESS_CLUB_REQUEST_BUDGET":   &cfg.RequestBudget,
+		"CHESS_CLUB_UPSTREAM_TIMEOUT": &cfg.UpstreamTimeout,
+	}
+	for name, field := range durationFields {
+		if value, ok := os.LookupEnv(name); ok {
+			err := field.Set(value)
+			if err != nil {
+				return fmt.Errorf("invalid value for %s: %w", name, err)
+			}
+		}
+	}
+
+	intFields := map[string]*int{
+		"CHESS_CLUB_UPSTREAM_RETRIES":     &cfg.UpstreamRetries,
+		"CHESS_CLUB_UPSTREAM_CONCURRENCY": &cfg.UpstreamConcurrency,
+		"CHESS_CLUB_ENGINE_DEPTH":         &cfg.EngineDepth,
+	}
+	for name, field := range intFields {
+		if value, ok := os.LookupEnv(name); ok {
+			parsed, err := strconv.Atoi(value)
+			if err != nil {
+				return fmt.Errorf("invalid value for %s: %w", name, err)
+			}
+			*field = parsed
+		}
+	}
+
+	return nil
+}
+
+// validate returns an error describing the first invalid setting.
+func (cfg config) validate() error {
+	_, _, err := net.SplitHostPort(cfg.ListenAddr)
+	if err != nil {
+		return fmt.Errorf("invalid listen address %q: %w", cfg.ListenAddr, err)
+	}
+
+	timeouts := map[string]duration{
+		"read timeout":     cfg.ReadTimeout,
+		"write timeout":    cfg.WriteTimeout,
+		"idle timeout":     cfg.IdleTimeout,
+		"request budget":   cfg.RequestBudget,
+		"upstream timeout": cfg.UpstreamTimeout,
+	}
+	for name, timeout := range timeouts {
+		if timeout < 0 {
+			return fmt.Errorf("%s must not be negative", name)
+		}
+	}
+
+	if cfg.UpstreamTimeout == 0 {
+		return fmt.Errorf("upstream timeout must be set")
+	}
+
+	if cfg.RequestBudget == 0 {
+		return fmt.Errorf("request budget must be set")
+	}
+
+	if cfg.UpstreamRetries < 0 || cfg.UpstreamRetries > 10 {
+		return fmt.Errorf("upstream retries must be between 0 and 10, got %d", cfg.UpstreamRetries)
+	}
+
+	if cfg.UpstreamConcurrency < 1 || cfg.UpstreamConcurrency > 32 {
+		return fmt.Errorf("upstream concurrency must be between 1 and 32, got %d", cfg.UpstreamConcurrency)
+	}
+
+	if cfg.CacheDir == "" {
+		return fmt.Errorf("cache directory must be set")
+	}
+
+	if cfg.EngineDepth < 1 || cfg.EngineDepth > 40 {
+		return fmt.Errorf("engine depth must be between 1 and 40, got %d", cfg.EngineDepth)
+	}
+
+	_, err = logrus.ParseLevel(cfg.LogLevel)
+	if err != nil {
+		return fmt.Errorf("invalid log level %q", cfg.LogLevel)
+	}
+
+	if cfg.LogFormat != "text" && cfg.LogFormat != "json" {
+		return fmt.Errorf("invalid log format %q, expected text or json", cfg.LogFormat)
+	}
+
+	return nil
+}
+
+// redact returns a copy of the config safe to display.
+func (cfg config) redact() config {
+	if cfg.AdminPassword != "" {
+		cfg.AdminPassword = redacted
+	}
+
+	return cfg
+}
+
+// gameStorePath returns the path of the game store file.
+func (cfg config) gameStorePath() string {
+	if cfg.StorePath != "" {
+		return cfg.StorePath
+	}
+
+	return filepath.Join(cfg.CacheDir, "games.json")
+}
+
+// analysisStorePath returns the path of the engine analysis store file.
+func (cfg config) analysisStorePath() string {
+	return filepath.Join(cfg.CacheDir, "analysis.json")
+}
+
+// httpCacheDir returns the directory of the chess.com response cache.
+func (cfg config) httpCacheDir() string {
+	return filepath.Join(cfg.CacheDir, "http")
+}
+
+// setup applies cfg: it configures logging and the chess.com client
+// and loads the club, the game store and the analysis store.
+func setup(cfg config) error {
+	level, _ := logrus.ParseLevel(cfg.LogLevel)
+	logrus.SetLevel(level)
+
+	if cfg.LogFormat == "json" {
+		logrus.SetFormatter(&logrus.JSONFormatter{})
+	} else {
+		logrus.SetFormatter(&logrus.TextFormatter{})
+	}
+
+	if cfg.ClubFile != "" {
+		clubConfig, err := loadClubConfig(cfg.ClubFile)
+		if err != nil {
+			return err
+		}
+		club = clubConfig
+	}
+
+	cache, err := newHTTPCache(cfg.httpCacheDir())
+	if err != nil {
+		return err
+	}
+
+	chessComClient = newChessComClient(time.Duration(cfg.UpstreamTimeout), cfg.UpstreamRetries, cfg.UpstreamConcurrency, cache)
+
+	// Loading the game store classifies the openings of its games.
+	loadECO()
+
+	store, err = newGameStore(cfg.gameStorePath())
+	if err != nil {
+		return err
+	}
+
+	analyses, err = newAnalysisStore(cfg.analysisStorePath())
+	if err != nil {
+		return err
+	}
+
+	appConfig = cfg
+
+	return nil
+}
@@ -0,0 +1,303 @@
+package main
+
+import (
+	"flag"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// setConfigEnv clears every CHESS_CLUB_* environment variable and
+// sets env instead. The environment is restored when the test ends.
+func setConfigEnv(t *testing.T, env map[string]string) {
+	t.Helper()
+
+	old := make(map[string]string)
+	for _, kv := range os.Environ() {
+		if strings.HasPrefix(kv, "CHESS_CLUB_") {
+			parts := strings.SplitN(kv, "=", 2)
+			old[parts[0]] = parts[1]
+			os.Unsetenv(parts[0])
+		}
+	}
+
+	for name, value := range env {
+		os.Setenv(name, value)
+	}
+
+	t.Cleanup(func() {
+		for name := range env {
+			os.Unsetenv(name)
+		}
+		for name, value := range old {
+			os.Setenv(name, value)
+		}
+	})
+}
+
+// resolveTestConfig parses args as the flags of a command with the
+// config file holding file, if not empty, and resolves the config.
+func resolveTestConfig(t *testing.T, file string, args ...string) (config, error) {
+	t.Helper()
+
+	if file != "" {
+		path := filepath.Join(t.TempDir(), "config.json")
+		if err := ioutil.WriteFile(path, []byte(file), 0644); err != nil {
+			t.Fatalf("could not write config file: %s", err)
+		}
+		args = append([]string{"-config", path}, args...)
+	}
+
+	flags := flag.NewFlagSet("test", flag.ContinueOnError)
+	flags.SetOutput(ioutil.Discard)
+	cfgFlags := addConfigFlags(flags)
+	if err := flags.Parse(args); err != nil {
+		return config{}, err
+	}
+
+	return cfgFlags.resolve(flags)
+}
+
+func TestConfigPrecedence(t *testing.T) {
+	defaults := defaultConfig()
+
+	tests := []struct {
+		name  string
+		file  string
+		env   map[string]string
+		args  []string
+		check func(config) []string
+	}{
+		{
+			name: "defaults",
+			check: func(cfg config) []string {
+				return []string{
+					cfg.ListenAddr, ":8889",
+					cfg.UpstreamTimeout.String(), "5s",
+					cfg.gameStorePath(), filepath.Join(defaults.CacheDir, "games.json"),
+				}
+			},
+		},
+		{
+			name: "file over defaults",
+			file: `{"listen_addr": ":9000", "upstream_timeout": "7s", "upstream_retries": 4}`,
+			check: func(cfg config) []string {
+				return []string{
+					cfg.ListenAddr, ":9000",
+					cfg.UpstreamTimeout.String(), "7s",
+					strconv.Itoa(cfg.UpstreamRetries), "4",
+					cfg.LogLevel, "info",
+				}
+			},
+		},
+		{
+			name: "environment over file",
+			file: `{"listen_addr": ":9000", "upstream_retries": 4, "log_level": "debug"}`,
+			env: map[string]string{
+				"CHESS_CLUB_LISTEN_ADDR":      ":9001",
+				"CHESS_CLUB_UPSTREAM_RETRIES": "5",
+				"CHESS_CLUB_REQUEST_BUDGET":   "40s",
+			},
+			check: func(cfg config) []string {
+				return []string{
+					cfg.ListenAddr, ":9001",
+					strconv.Itoa(cfg.UpstreamRetries), "5",
+					cfg.RequestBudget.String(), "40s",
+					cfg.LogLevel, "debug",
+				}
+			},
+		},
+		{
+			name: "flags over environment",
+			file: `{"listen_addr": ":9000"}`,
+			env: map[string]string{
+				"CHESS_CLUB_LISTEN_ADDR":      ":9001",
+				"CHESS_CLUB_UPSTREAM_RETRIES": "5",
+				"CHESS_CLUB_READ_TIMEOUT":     "20s",
+			},
+			args: []string{"-listen", ":9002", "-read-timeout", "30s"},
+			check: func(cfg config) []string {
+				return []string{
+					cfg.ListenAddr, ":9002",
+					cfg.ReadTimeout.String(), "30s",
+					strconv.Itoa(cfg.UpstreamRetries), "5",
+				}
+			},
+		},
+		{
+			name: "flag set to its default still wins",
+			env:  map[string]string{"CHESS_CLUB_UPSTREAM_RETRIES": "5"},
+			args: []string{"-upstream-retries", "2"},
+			check: func(cfg config) []string {
+				return []string{strconv.Itoa(cfg.UpstreamRetries), "2"}
+			},
+		},
+		{
+			name: "store in the cache directory",
+			env:  map[string]string{"CHESS_CLUB_CACHE_DIR": "/var/lib/chess-club"},
+			check: func(cfg config) []string {
+				return []string{cfg.gameStorePath(), filepath.Join("/var/lib/chess-club", "games.json")}
+			},
+		},
+		{
+			name: "store from the file",
+			file: `{"store_path": "/data/file.json"}`,
+			check: func(cfg config) []string {
+				return []string{cfg.gameStorePath(), "/data/file.json"}
+			},
+		},
+		{
+			name: "store from the environment",
+			file: `{"store_path": "/data/file.json"}`,
+			env:  map[string]string{"CHESS_CLUB_STORE": "/data/env.json"},
+			check: func(cfg config) []string {
+				return []string{cfg.gameStorePath(), "/data/env.json"}
+			},
+		},
+		{
+			name: "store from the flag",
+			env:  map[string]string{"CHESS_CLUB_STORE": "/data/env.json"},
+			args: []string{"-store", "/data/flag.json"},
+			check: func(cfg config) []string {
+				return []string{cfg.gameStorePath(), "/data/flag.json"}
+			},
+		},
+		{
+			name: "admin password from the environment",
+			env:  map[string]string{"CHESS_CLUB_ADMIN_PASSWORD": "secret"},
+			check: func(cfg config) []string {
+				return []string{
+					cfg.AdminPassword, "secret",
+					cfg.redact().AdminPassword, redacted,
+				}
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setConfigEnv(t, tt.env)
+
+			cfg, err := resolveTestConfig(t, tt.file, tt.args...)
+			if err != nil {
+				t.Fatalf("resolve() error = %v", err)
+			}
+
+			pairs := tt.check(cfg)
+			for i := 0; i < len(pairs); i += 2 {
+				if pairs[i] != pairs[i+1] {
+					t.Errorf("setting %d = %q, want %q", i/2+1, pairs[i], pairs[i+1])
+				}
+			}
+		})
+	}
+}
+
+func TestConfigResolveErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		file    string
+		env     map[string]string
+		args    []string
+		wantErr string
+	}{
+		{
+			name:    "missing file",
+			args:    []string{"-config", filepath.Join(os.TempDir(), "does-not-exist", "config.json")},
+			wantErr: "could not read config file",
+		},
+		{
+			name:    "malformed file",
+			file:    `{"listen_addr": `,
+			wantErr: "could not unmarshal config file",
+		},
+		{
+			name:    "duration in the file is not a string",
+			file:    `{"read_timeout": 15}`,
+			wantErr: "could not unmarshal config file",
+		},
+		{
+			name:    "invalid duration in the environment",
+			env:     map[string]string{"CHESS_CLUB_UPSTREAM_TIMEOUT": "soon"},
+			wantErr: "CHESS_CLUB_UPSTREAM_TIMEOUT",
+		},
+		{
+			name:    "invalid number in the environment",
+			env:     map[string]string{"CHESS_CLUB_ENGINE_DEPTH": "deep"},
+			wantErr: "CHESS_CLUB_ENGINE_DEPTH",
+		},
+		{
+			name:    "invalid value once resolved",
+			env:     map[string]string{"CHESS_CLUB_UPSTREAM_CONCURRENCY": "0"},
+			wantErr: "upstream concurrency",
+		},
+		{
+			name:    "flag fixes an invalid environment value",
+			env:     map[string]string{"CHESS_CLUB_UPSTREAM_CONCURRENCY": "0"},
+			args:    []string{"-upstream-concurrency", "2"},
+			wantErr: "",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setConfigEnv(t, tt.env)
+
+			_, err := resolveTestConfig(t, tt.file, tt.args...)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("resolve() error = %v", err)
+				}
+				return
+			}
+
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("resolve() error = %v, want it to contain %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestConfigValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		change  func(*config)
+		wantErr string
+	}{
+		{name: "defaults", change: func(cfg *config) {}},
+		{name: "listen address without port", change: func(cfg *config) { cfg.ListenAddr = "localhost" }, wantErr: "invalid listen address"},
+		{name: "negative timeout", change: func(cfg *config) { cfg.IdleTimeout = duration(-time.Second) }, wantErr: "idle timeout must not be negative"},
+		{name: "no upstream timeout", change: func(cfg *config) { cfg.UpstreamTimeout = 0 }, wantErr: "upstream timeout must be set"},
+		{name: "no request budget", change: func(cfg *config) { cfg.RequestBudget = 0 }, wantErr: "request budget must be set"},
+		{name: "no retries", change: func(cfg *config) { cfg.UpstreamRetries = 0 }},
+		{name: "too many retries", change: func(cfg *config) { cfg.UpstreamRetries = 11 }, wantErr: "upstream retries"},
+		{name: "too much concurrency", change: func(cfg *config) { cfg.UpstreamConcurrency = 33 }, wantErr: "upstream concurrency"},
+		{name: "no cache directory", change: func(cfg *config) { cfg.CacheDir = "" }, wantErr: "cache directory must be set"},
+		{name: "engine depth", change: func(cfg *config) { cfg.EngineDepth = 0 }, wantErr: "engine depth"},
+		{name: "log level", change: func(cfg *config) { cfg.LogLevel = "loud" }, wantErr: "invalid log level"},
+		{name: "log format", change: func(cfg *config) { cfg.LogFormat = "xml" }, wantErr: "invalid log format"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := defaultConfig()
+			tt.change(&cfg)
+
+			err := cfg.validate()
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("validate() error = %v", err)
+				}
+				return
+			}
+
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("validate() error = %v, want it to contain %q", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"strings"
+	"sync"
+
+	"github.com/notnil/chess"
+	"github.com/notnil/chess/opening"
+)
+
+// ecoOpening is an opening of the Encyclopaedia of Chess Openings.
+type ecoOpening struct {
+	Code string
+	Name string
+
+	// plies is the number of moves of the line of the opening.
+	plies int
+}
+
+// before returns whether o is preferred to other when both
+// lines reach the same position: the shortest line wins.
+func (o ecoOpening) before(other ecoOpening) bool {
+	if o.plies != other.plies {
+		return o.plies < other.plies
+	}
+	if o.Code != other.Code {
+		return o.Code < other.Code
+	}
+	return o.Name < other.Name
+}
+
+var (
+	// ecoPositions are the openings of the ECO classification embedded
+	// in notnil/chess keyed by the position they end with, so openings
+	// are found even when the game transposed into them.
+	// ecoMaxPlies is the length of the longest line.
+	ecoPositions map[string]ecoOpening
+	ecoMaxPlies  int
+	ecoOnce      sync.Once
+)
+
+// ecoPositionKey returns the FEN of pos without the en passant
+// square and the move counters, which depend on the move order.
+func ecoPositionKey(pos *chess.Position) string {
+	fields := strings.Fields(pos.String())
+	if len(fields) > 3 {
+		fields = fields[:3]
+	}
+
+	return strings.Join(fields, " ")
+}
+
+// loadECO fills ecoPositions the first time it is called. It takes a
+// while as the line of every opening is played out, so setup calls it
+// before any request or the game store needs to classify a game.
+func loadECO() {
+	ecoOnce.Do(loadECOPositions)
+}
+
+// loadECOPositions fills ecoPositions, see loadECO.
+func loadECOPositions() {
+	ecoPositions = make(map[string]ecoOpening)
+
+	for _, o := range opening.NewBookECO().Possible(nil) {
+		// Lines are written in UCI notation: 1.e2e4 e7e5 2.g1f3
+		pos := chess.StartingPosition()
+		plies := 0
+		for _, field := range strings.Fields(o.PGN()) {
+			field = field[strings.LastIndex(field, ".")+1:]
+			if field == "" {
+				continue
+			}
+
+			move, err := chess.UCINotation{}.Decode(pos, field)
+			if err != nil {
+				pos = nil
+				break
+			}
+			pos = pos.Update(move)
+			plies++
+		}
+		if pos == nil {
+			continue
+		}
+
+		// Some names end with their code, such as "Semi-Slav Defense; D43".
+		name := strings.TrimSuffix(o.Title(), "; "+o.Code())
+
+		candidate := ecoOpening{Code: o.Code(), Name: name, plies: plies}
+
+		key := ecoPositionKey(pos)
+		if existing, ok := ecoPositions[key]; ok && !candidate.before(existing) {
+			continue
+		}
+		ecoPositions[key] = candidate
+
+		if plies > ecoMaxPlies {
+			ecoMaxPlies = plies
+		}
+	}
+}
+
+// classifyOpening returns the opening of the deepest position of game
+// found in the ECO classification, false if the game did not start
+// from the starting position or left the book right away.
+func classifyOpening(game *chess.Game) (ecoOpening, bool) {
+	// Already loaded by setup, unless called without it as in tests.
+	loadECO()
+
+	positions := game.Positions()
+	if ecoPositionKey(positions[0]) != ecoPositionKey(chess.StartingPosition()) {
+		return ecoOpening{}, false
+	}
+
+	found, ok := ecoOpening{}, false
+	for ply := 1; ply < len(positions) && ply <= ecoMaxPlies; ply++ {
+		if o, exists := ecoPositions[ecoPositionKey(positions[ply])]; exists {
+			found, ok = o, true
+		}
+	}
+
+	return found, ok
+}
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestClassifyOpening(t *testing.T) {
+	tests := []struct {
+		name     string
+		pgn      string
+		wantCode string
+		wantName string
+		wantOK   bool
+	}{
+		{
+			name:     "deepest line",
+			pgn:      "1. d4 Nf6 2. c4 e6 3. Nc3 Bb4 4. a3 *",
+			wantCode: "E24",
+			wantName: "Saemisch Variation, Nimzo-Indian",
+			wantOK:   true,
+		},
+		{
+			name:     "transposition",
+			pgn:      "1. c4 Nf6 2. d4 e6 3. Nc3 Bb4 4. a3 *",
+			wantCode: "E24",
+			wantName: "Saemisch Variation, Nimzo-Indian",
+			wantOK:   true,
+		},
+		{
+			name:     "left the book",
+			pgn:      "1. a3 h5 2. h4 *",
+			wantCode: "A00",
+			wantName: "Anderssen's Opening",
+			wantOK:   true,
+		},
+		{
+			name: "set up position",
+			pgn: `[FEN "6k1/5ppp/8/8/8/8/5PPP/3R2K1 w - - 0 1"]
+[SetUp "1"]
+
+1. Rd8# 1-0`,
+		},
+		{
+			name: "no moves",
+			pgn:  "*",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			game, err := getChessGame(tt.pgn)
+			if err != nil {
+				t.Fatalf("could not parse pgn: %s", err)
+			}
+
+			got, ok := classifyOpening(game.ChessGame)
+			if ok != tt.wantOK || got.Code != tt.wantCode || got.Name != tt.wantName {
+				t.Errorf("classifyOpening() = %q %q %t, want %q %q %t", got.Code, got.Name, ok, tt.wantCode, tt.wantName, tt.wantOK)
+			}
+		})
+	}
+}
+
+func TestGetChessGameOpening(t *testing.T) {
+	tests := []struct {
+		name        string
+		pgn         string
+		wantECO     string
+		wantOpening string
+	}{
+		{
+			name:        "no ECO tag",
+			pgn:         "1. e4 e5 2. Nf3 Nc6 3. Bb5 *",
+			wantECO:     "C60",
+			wantOpening: "Ruy Lopez; Spanish Opening",
+		},
+		{
+			name: "chess.com tags",
+			pgn: `[ECO "C60"]
+[ECOUrl "https://www.chess.com/openings/Ruy-Lopez-Opening"]
+
+1. e4 e5 2. Nf3 Nc6 3. Bb5 *`,
+			wantECO:     "C60",
+			wantOpening: "Ruy Lopez Opening",
+		},
+		{
+			name:        "ECO tag only",
+			pgn:         "[ECO \"C60\"]\n\n1. e4 e5 2. Nf3 Nc6 3. Bb5 *",
+			wantECO:     "C60",
+			wantOpening: "Ruy Lopez; Spanish Opening",
+		},
+		{
+			name:        "ECO tag of another opening",
+			pgn:         "[ECO \"B00\"]\n\n1. e4 e5 2. Nf3 Nc6 3. Bb5 *",
+			wantECO:     "B00",
+			wantOpening: "",
+		},
+		{
+			name:        "Opening tag only",
+			pgn:         "[Opening \"Spanish Game\"]\n\n1. e4 e5 2. Nf3 Nc6 3. Bb5 *",
+			wantECO:     "C60",
+			wantOpening: "Spanish Game",
+		},
+		{
+			name:        "ECO and Opening tags",
+			pgn:         "[ECO \"C60\"]\n[Opening \"Spanish Game\"]\n\n1. e4 e5 2. Nf3 Nc6 3. Bb5 *",
+			wantECO:     "C60",
+			wantOpening: "Spanish Game",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			game, err := getChessGame(tt.pgn)
+			if err != nil {
+				t.Fatalf("could not parse pgn: %s", err)
+			}
+
+			if game.PgnParsed.ECO != tt.wantECO || game.PgnParsed.Opening != tt.wantOpening {
+				t.Errorf("opening = %q %q, want %q %q", game.PgnParsed.ECO, game.PgnParsed.Opening, tt.wantECO, tt.wantOpening)
+			}
+		})
+	}
+}
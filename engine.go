@@ -0,0 +1,241 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"os/exec"
+	"strings"
+	"time"
+
+	"github.com/notnil/chess"
+	"github.com/notnil/chess/uci"
+)
+
+const (
+	// engineStartTimeout is how long an engine has to answer
+	// the uci and isready commands.
+	engineStartTimeout = 10 * time.Second
+
+	// engineSearchTimeout bounds the search of a single position
+	// so a stuck engine does not stall the analysis forever.
+	engineSearchTimeout = time.Minute
+)
+
+// uciEngine is a UCI engine process. Unlike uci.Engine, every command
+// can be cancelled and an engine which exits is reported as an error
+// instead of blocking forever.
+type uciEngine struct {
+	cmd   *exec.Cmd
+	stdin io.WriteCloser
+
+	// lines has what the engine writes, it is closed when
+	// the engine exits.
+	lines chan string
+
+	name string
+}
+
+// engineSearch is the result of searching a position.
+type engineSearch struct {
+	// Score is from the point of view of the side to move.
+	Score uci.Score
+
+	// BestMove is in UCI notation.
+	BestMove string
+}
+
+// startUCIEngine starts the engine at path and waits for it to be ready.
+func startUCIEngine(ctx context.Context, path string) (*uciEngine, error) {
+	cmd := exec.Command(path)
+
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, fmt.Errorf("could not get engine stdin: %w", err)
+	}
+
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, fmt.Errorf("could not get engine stdout: %w", err)
+	}
+
+	err = cmd.Start()
+	if err != nil {
+		return nil, fmt.Errorf("could not start engine %s: %w", path, err)
+	}
+
+	e := &uciEngine{
+		cmd:   cmd,
+		stdin: stdin,
+		lines: make(chan string),
+	}
+
+	go func() {
+		defer close(e.lines)
+
+		scanner := bufio.NewScanner(stdout)
+		for scanner.Scan() {
+			e.lines <- scanner.Text()
+		}
+	}()
+
+	startCtx, cancel := context.WithTimeout(ctx, engineStartTimeout)
+	defer cancel()
+
+	err = e.send("uci")
+	if err == nil {
+		err = e.readUntil(startCtx, "uciok", func(line string) {
+			if strings.HasPrefix(line, "id name ") {
+				e.name = strings.TrimPrefix(line, "id name ")
+			}
+		})
+	}
+	if err == nil {
+		err = e.waitReady(startCtx)
+	}
+	if err != nil {
+		e.kill()
+		return nil, fmt.Errorf("%s did not answer as a UCI engine: %w", path, err)
+	}
+
+	return e, nil
+}
+
+// send writes cmd to the engine.
+func (e *uciEngine) send(cmd string) error {
+	_, err := fmt.Fprintln(e.stdin, cmd)
+	if err != nil {
+		return fmt.Errorf("could not send %q to engine: %w", cmd, err)
+	}
+
+	return nil
+}
+
+// readUntil reads what the engine writes up to a line starting with
+// prefix, passing every line to handle if set.
+func (e *uciEngine) readUntil(ctx context.Context, prefix string, handle func(line string)) error {
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case line, ok := <-e.lines:
+			if !ok {
+				return fmt.Errorf("engine exited")
+			}
+
+			if handle != nil {
+				handle(line)
+			}
+
+			if strings.HasPrefix(line, prefix) {
+				return nil
+			}
+		}
+	}
+}
+
+// waitReady waits for the engine to be ready for the next command.
+func (e *uciEngine) waitReady(ctx context.Context) error {
+	err := e.send("isready")
+	if err != nil {
+		return err
+	}
+
+	return e.readUntil(ctx, "readyok", nil)
+}
+
+// newGame tells the engine the next positions are from another game.
+func (e *uciEngine) newGame(ctx context.Context) error {
+	err := e.send("ucinewgame")
+	if err != nil {
+		return err
+	}
+
+	return e.waitReady(ctx)
+}
+
+// search searches pos depth plies deep.
+func (e *uciEngine) search(ctx context.Context, pos *chess.Position, depth int) (engineSearch, error) {
+	ctx, cancel := context.WithTimeout(ctx, engineSearchTimeout)
+	defer cancel()
+
+	err := e.send("position fen " + pos.String())
+	if err == nil {
+		err = e.send(fmt.Sprintf("go depth %d", depth))
+	}
+	if err != nil {
+		return engineSearch{}, err
+	}
+
+	result := engineSearch{}
+	bestMoveLine := ""
+	err = e.readUntil(ctx, "bestmove", func(line string) {
+		if strings.HasPrefix(line, "bestmove") {
+			bestMoveLine = line
+			return
+		}
+
+		// The last score reported is the one of the deepest search.
+		if !strings.HasPrefix(line, "info") || !strings.Contains(line, " score ") {
+			return
+		}
+
+		info := uci.Info{}
+		if info.UnmarshalText([]byte(line)) == nil {
+			result.Score = info.Score
+		}
+	})
+	if err != nil {
+		return engineSearch{}, fmt.Errorf("could not search position %s: %w", pos, err)
+	}
+
+	fields := strings.Fields(bestMoveLine)
+	if len(fields) < 2 || fields[1] == "(none)" {
+		return engineSearch{}, fmt.Errorf("engine returned no best move for position %s", pos)
+	}
+	result.BestMove = fields[1]
+
+	return result, nil
+}
+
+// close asks the engine to quit, killing it if it does not.
+func (e *uciEngine) close() error {
+	e.send("quit")
+
+	return e.stop(engineStartTimeout)
+}
+
+// kill stops the engine right away.
+func (e *uciEngine) kill() {
+	e.stop(0)
+}
+
+// stop closes the engine stdin and gives it grace to exit
+// before killing it.
+func (e *uciEngine) stop(grace time.Duration) error {
+	e.stdin.Close()
+
+	// Drain what the engine still writes so the goroutine
+	// reading it can return.
+	go func() {
+		for range e.lines {
+		}
+	}()
+
+	done := make(chan error, 1)
+	go func() {
+		done <- e.cmd.Wait()
+	}()
+
+	select {
+	case err := <-done:
+		return err
+	case <-time.After(grace):
+	}
+
+	e.cmd.Process.Kill()
+	<-done
+
+	return fmt.Errorf("engine did not quit")
+}
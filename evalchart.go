@@ -0,0 +1,114 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+const (
+	// Size of the evaluation chart on the game page.
+	evalChartWidth  = 600
+	evalChartHeight = 160
+
+	// evalChartSwings is how many of the moves which lost the
+	// most are marked on the evaluation chart.
+	evalChartSwings = 3
+)
+
+// evalChartMarker marks a move on the evaluation chart.
+type evalChartMarker struct {
+	X, Y float64
+
+	// Ply is the number of the move, the marker links
+	// to the position after it.
+	Ply      int
+	Label    string
+	Judgment string
+}
+
+// evalChart is the evaluation of every position of a game drawn as
+// an svg line, White's advantage going up.
+type evalChart struct {
+	Width  int
+	Height int
+
+	// Middle is the height of an even position.
+	Middle float64
+
+	// Line and Area are svg points: the evaluation line, and
+	// the area between it and the bottom of the chart which
+	// is White's share.
+	Line string
+	Area string
+
+	Markers []evalChartMarker
+}
+
+// evalChartY returns the height on the chart of an evaluation in
+// centipawns. Evaluations past maxEvalCP are drawn at the edges.
+func evalChartY(cp int) float64 {
+	half := float64(evalChartHeight) / 2
+
+	return half - float64(clampEval(cp))/maxEvalCP*half
+}
+
+// getEvalChart draws the evaluations of analysis. moves are the
+// moves of the game on the game page, one per ply, used to label
+// the largest swings.
+func getEvalChart(analysis gameAnalysis, moves []*annotatedMove) *evalChart {
+	if len(analysis.Evals) < 2 {
+		return nil
+	}
+
+	chart := &evalChart{
+		Width:  evalChartWidth,
+		Height: evalChartHeight,
+		Middle: evalChartY(0),
+	}
+
+	step := float64(evalChartWidth) / float64(len(analysis.Evals)-1)
+	x := func(ply int) float64 {
+		return float64(ply) * step
+	}
+
+	points := make([]string, len(analysis.Evals))
+	for ply, eval := range analysis.Evals {
+		points[ply] = fmt.Sprintf("%.1f,%.1f", x(ply), evalChartY(eval.CP))
+	}
+
+	chart.Line = strings.Join(points, " ")
+	chart.Area = fmt.Sprintf("0,%d %s %.1f,%d", evalChartHeight, chart.Line, x(len(analysis.Evals)-1), evalChartHeight)
+
+	// Mark the moves which lost the most, in the order they were played.
+	swings := []moveJudgment{}
+	for _, judgment := range analysis.judgments() {
+		if judgment.Judgment != "" {
+			swings = append(swings, judgment)
+		}
+	}
+
+	sort.SliceStable(swings, func(i, j int) bool { return swings[i].CPLoss > swings[j].CPLoss })
+	if len(swings) > evalChartSwings {
+		swings = swings[:evalChartSwings]
+	}
+	sort.Slice(swings, func(i, j int) bool { return swings[i].Ply < swings[j].Ply })
+
+	for _, swing := range swings {
+		label := swing.Move
+		if swing.Ply <= len(moves) {
+			move := moves[swing.Ply-1]
+			label = fmt.Sprintf("%s %s%s %s", move.Number, move.SAN, move.Symbol, move.Eval)
+		}
+
+		chart.Markers = append(chart.Markers, evalChartMarker{
+			X:        x(swing.Ply),
+			Y:        evalChartY(analysis.Evals[swing.Ply].CP),
+			Ply:      swing.Ply,
+			Label:    label,
+			Judgment: swing.Judgment,
+		})
+	}
+
+	return chart
+}
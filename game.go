@@ -2,11 +2,10 @@ package main
 
 import (
 	"bytes"
+	"context"
 	"encoding/base64"
 	"fmt"
 	"image/color"
-	"log"
-	"math"
 	"sort"
 	"strconv"
 	"strings"
@@ -29,6 +28,12 @@ const (
 	ChessComResultTimeout      = "timeout"
 	ChessComResultAgreed       = "agreed"
 	ChessComResultInsufficient = "insufficient"
+
+	ChessComResultAbandoned          = "abandoned"
+	ChessComResultRepetition         = "repetition"
+	ChessComResultStalemate          = "stalemate"
+	ChessComResultFiftyMove          = "50move"
+	ChessComResultTimeVsInsufficient = "timevsinsufficient"
 )
 
 type chessGamesByEndTimeDesc []chessGame
@@ -45,6 +50,17 @@ type chessGame struct {
 	PgnParsed            pgnParsed   `json:"-"`
 	URL                  string      `json:"-"`
 	Image                string      `json:"-"`
+
+	// Source is where the game came from (chess.com, a PGN import...)
+	Source string `json:"-"`
+
+	// PgnError is set when the PGN could not be parsed and the game
+	// was built from the position reported by chess.com.
+	PgnError string `json:"-"`
+
+	// Analysis is the engine analysis of the game, nil if it has
+	// not been analyzed.
+	Analysis *gameAnalysis `json:"-"`
 }
 
 type pgnParsed struct {
@@ -59,6 +75,7 @@ type pgnParsed struct {
 	Timezone        string
 	ECO             string
 	ECOUrl          string
+	Opening         string
 	UTCDate         string
 	UTCTime         string
 	WhiteElo        string
@@ -85,6 +102,10 @@ type pgnParsed struct {
 	WhiteInsufficient  bool
 	BlackInsufficient  bool
 	Draw               bool
+
+	// EndedBy is how the game ended, one of the Termination
+	// constants, empty for games in progress.
+	EndedBy string
 }
 
 type archiveResponse struct {
@@ -129,6 +150,8 @@ func getChessGame(pgnString string) (chessGame, error) {
 			parsedPgn.ECO = val
 		} else if key == "ECOUrl" {
 			parsedPgn.ECOUrl = val
+		} else if key == "Opening" {
+			parsedPgn.Opening = val
 		} else if key == "UTCDate" {
 			parsedPgn.UTCDate = val
 		} else if key == "UTCTime" {
@@ -152,6 +175,24 @@ func getChessGame(pgnString string) (chessGame, error) {
 		}
 	}
 
+	// chess.com only links to the page of the opening.
+	if parsedPgn.Opening == "" {
+		parsedPgn.Opening = openingNameFromURL(parsedPgn.ECOUrl)
+	}
+
+	// Games without ECO tags, such as over the board games, are
+	// classified from their moves. Tags in the PGN are kept, only
+	// the missing ones are filled in.
+	if parsedPgn.ECO == "" || parsedPgn.Opening == "" {
+		eco, ok := classifyOpening(parsedChessGame)
+		if ok && parsedPgn.ECO == "" {
+			parsedPgn.ECO = eco.Code
+		}
+		if ok && parsedPgn.Opening == "" && parsedPgn.ECO == eco.Code {
+			parsedPgn.Opening = eco.Name
+		}
+	}
+
 	if parsedPgn.EndDate != "" && parsedPgn.EndTime != "" {
 		format := "2006.01.02 15:04:05"
 		parsedEndTime, err := time.Parse(format, parsedPgn.EndDate+" "+parsedPgn.EndTime)
@@ -160,12 +201,25 @@ func getChessGame(pgnString string) (chessGame, error) {
 		}
 	}
 
+	// PGNs which do not come from chess.com (over the board games for
+	// instance) usually only have a Date tag, so fall back to it.
+	if parsedPgn.ParsedEndtime.IsZero() && parsedPgn.Date != "" {
+		parsedDate, err := time.Parse("2006.01.02", parsedPgn.Date)
+		if err == nil {
+			parsedPgn.ParsedEndtime = parsedDate
+		}
+	}
+
 	if parsedPgn.Result == PgnResultWhiteWin {
 		parsedPgn.WhiteWon = true
 	} else if parsedPgn.Result == PgnResultBlackWin {
 		parsedPgn.BlackWon = true
+	} else if parsedPgn.Result == PgnResultDraw {
+		parsedPgn.Draw = true
 	}
 
+	parsedPgn.EndedBy = terminationFromPgn(parsedChessGame, parsedPgn)
+
 	game := chessGame{
 		ChessGame: parsedChessGame,
 		PgnParsed: parsedPgn,
@@ -180,6 +234,10 @@ type gameGroup struct {
 	ChessGames     []chessGame
 	UserStatistics []userStats
 
+	// HasAnalysis is set when at least one of the games
+	// has been analyzed by an engine.
+	HasAnalysis bool
+
 	OverallNoGamesFound bool
 }
 
@@ -196,79 +254,139 @@ func (a gameGroupsByYearMonthDesc) Less(i, j int) bool {
 	return a[i].Year > a[j].Year
 }
 
-func getUnfinishedGamesForUsers(users []string) []gameGroup {
+// getUnfinishedGamesForUsers returns the current games between users
+// along with the status of the fetch for each user.
+func getUnfinishedGamesForUsers(ctx context.Context, users []string) ([]gameGroup, []memberStatus) {
 	// Loop through all users that are in the chess club
 	// and get all their current games.
 	// This will include games against players not in the club
 	// which will be filtered out later.
 	allGames := []chessGame{}
-	for _, user := range users {
-		games, err := getUserUnfinishedGames(user)
+	statuses := make([]memberStatus, len(users))
+	for i, user := range users {
+		userCtx, report := withStaleReport(ctx)
+		games, err := getUserUnfinishedGames(userCtx, user)
+		statuses[i] = getMemberStatus(user, report, err)
 		if err != nil {
+			loggerFromContext(ctx).WithError(err).WithField("user", user).Warn("could not get unfinished games")
 			continue
 		}
 		allGames = append(allGames, games...)
 	}
 
-	return groupGamesForUsersByMonth(users, allGames)
+	return groupGamesForUsersByMonth(ctx, users, allGames), statuses
 }
 
-func getFinishedGamesForUsersForYearMonth(users []string, year, month int) (*gameGroup, int, int) {
-	// Loop through all users that are in the chess club
-	// and get all their finished games.
-	// This will include games against players not in the club
-	// which will be filtered out later.
+// getFinishedGamesForUsersForYearMonth returns the games played between
+// users in the passed year and month, along with the status of the
+// fetch for each user. Only the chess.com archives index says are
+// needed are fetched. If onlineOnly is set, over the board games are
+// left out. Months assembled in the last monthGroupCacheTTL are reused.
+func getFinishedGamesForUsersForYearMonth(ctx context.Context, index *monthIndex, users []string, year, month int, onlineOnly bool) monthGroupResult {
+	key := monthGroupKey(users, year, month, onlineOnly)
+	if result, ok := monthGroups.get(key); ok {
+		return result
+	}
+
+	result := assembleFinishedGamesForUsersForYearMonth(ctx, index, users, year, month, onlineOnly)
+
+	// A cancelled request or a failed member may have left games out,
+	// do not keep the result for the next requests.
+	if ctx.Err() == nil && !hasFailedMembers(result.memberStatuses) {
+		monthGroups.set(key, result)
+	}
+
+	return result
+}
+
+// assembleFinishedGamesForUsersForYearMonth builds what
+// getFinishedGamesForUsersForYearMonth returns from chess.com
+// and the game store.
+func assembleFinishedGamesForUsersForYearMonth(ctx context.Context, index *monthIndex, users []string, year, month int, onlineOnly bool) monthGroupResult {
+	yearMonth := yearMonthString(year, month)
+
+	// Members whose archive is not fetched keep the status
+	// of their archive listing.
+	statuses := make([]memberStatus, len(users))
+	copy(statuses, index.memberStatuses)
+
+	userIndexes := make(map[string]int)
+	for i, user := range users {
+		userIndexes[user] = i
+	}
+
+	// Get the finished games of the members index says have games
+	// this month. This will include games against players not in
+	// the club which will be filtered out later.
 	allGames := []chessGame{}
-	nextYearMonthMap := make(map[string]int)
 
 	wg := sync.WaitGroup{}
 	mutex := sync.Mutex{}
-	for _, user := range users {
-		wg.Add(1)
+	fetchMembers := func(members []string) (failed []string) {
+		for _, member := range members {
+			wg.Add(1)
+
+			go func(u string) {
+				defer wg.Done()
+				userCtx, report := withStaleReport(ctx)
+				games, err := getFinishedGamesWithURL(userCtx, u, index.archiveURL(u, yearMonth))
+
+				mutex.Lock()
+				defer mutex.Unlock()
+
+				statuses[userIndexes[u]] = getMemberStatus(u, report, err)
+				if err != nil {
+					loggerFromContext(ctx).WithError(err).WithField("user", u).Warn("could not get finished games for year month")
+					failed = append(failed, u)
+					return
+				}
+				allGames = append(allGames, games...)
+			}(member)
+		}
 
-		go func(u string) {
-			defer wg.Done()
-			games, nextYearMonth, err := getUserFinishedGamesForYearMonth(u, year, month)
-			if err != nil {
+		wg.Wait()
 
-				log.Printf("%s\n", err)
-				return
-			}
-			mutex.Lock()
-			allGames = append(allGames, games...)
-			nextYearMonthMap[nextYearMonth]++
-			mutex.Unlock()
-		}(user)
+		return failed
 	}
 
-	wg.Wait()
-
-	maxYearMonth := "190001"
-	for yearMonth, count := range nextYearMonthMap {
-		if count > 1 && yearMonth > maxYearMonth {
-			maxYearMonth = yearMonth
+	members, spare := index.membersToFetch(users, yearMonth)
+	failed := fetchMembers(members)
+	if len(failed) > 0 && spare != "" {
+		// The spare member's archive has their games with
+		// the members which could not be fetched.
+		if len(fetchMembers([]string{spare})) == 0 && len(failed) == 1 {
+			// Every game of a single failed member is in the archive
+			// of a member who was fetched, so none is missing. The
+			// member is reported stale if the spare member was.
+			recovered := statuses[userIndexes[spare]]
+			recovered.User = failed[0]
+			statuses[userIndexes[failed[0]]] = recovered
 		}
 	}
 
-	nextYear := 0
-	nextMonth := 0
+	// Include games in the game store such as PGN imports.
+	for _, game := range store.gamesForYearMonth(year, month) {
+		if onlineOnly && game.Source == GameSourceOTB {
+			continue
+		}
+		allGames = append(allGames, game)
+	}
 
-	if maxYearMonth != "190001" {
-		nextYear, _ = strconv.Atoi(maxYearMonth[:4])
-		nextMonth, _ = strconv.Atoi(maxYearMonth[4:])
+	result := monthGroupResult{
+		memberStatuses: statuses,
 	}
 
-	gameGroups := groupGamesForUsersByMonth(users, allGames)
-	if len(gameGroups) == 0 {
-		return nil, nextYear, nextMonth
+	gameGroups := groupGamesForUsersByMonth(ctx, users, allGames)
+	if len(gameGroups) > 0 {
+		result.group = &gameGroups[0]
 	}
 
-	return &gameGroups[0], nextYear, nextMonth
+	return result
 }
 
 // getAllFinishedGamesForUsers does what it's name says.
 // Use with caution. Can take a long time to return.
-func getAllFinishedGamesForUsers(users []string) []gameGroup {
+func getAllFinishedGamesForUsers(ctx context.Context, users []string) []gameGroup {
 	// Loop through all users that are in the chess club
 	// and get all their finished games.
 	// This will include games against players not in the club
@@ -282,10 +400,10 @@ func getAllFinishedGamesForUsers(users []string) []gameGroup {
 
 		go func(u string) {
 			defer wg.Done()
-			games, err := getUserFinishedGames(u)
+			games, err := getUserFinishedGames(ctx, u)
 			if err != nil {
 
-				log.Printf("%s\n", err)
+				loggerFromContext(ctx).WithError(err).WithField("user", u).Warn("could not get finished games")
 				return
 			}
 			mutex.Lock()
@@ -296,10 +414,10 @@ func getAllFinishedGamesForUsers(users []string) []gameGroup {
 
 	wg.Wait()
 
-	return groupGamesForUsersByMonth(users, allGames)
+	return groupGamesForUsersByMonth(ctx, users, allGames)
 }
 
-func groupGamesForUsersByMonth(users []string, allGames []chessGame) []gameGroup {
+func groupGamesForUsersByMonth(ctx context.Context, users []string, allGames []chessGame) []gameGroup {
 
 	// Build a game ID map to keep track of games we have already seen.
 	// We only want to include unique games once.
@@ -320,27 +438,9 @@ func groupGamesForUsersByMonth(users []string, allGames []chessGame) []gameGroup
 		gameIDMap[game.URL] = struct{}{}
 
 		// OK, so we have not seen this game before.
-		// Now let's check if it's a game between 2 users of the club.
-		// Loop through all the users in the club and match
-		// see if Black AND White is a user in the club.
-		usernamesFound := 0
-		for _, user := range users {
-			if strings.EqualFold(game.PgnParsed.Black, user) {
-				usernamesFound++
-			}
-
-			if strings.EqualFold(game.PgnParsed.White, user) {
-				usernamesFound++
-			}
-
-			if usernamesFound == 2 {
-				break
-			}
-		}
-
 		// If both Black and white are users in the club,
 		// then keep this game
-		if usernamesFound == 2 {
+		if isClubGame(users, game) {
 			selectGames = append(selectGames, game)
 		}
 
@@ -359,9 +459,11 @@ func groupGamesForUsersByMonth(users []string, allGames []chessGame) []gameGroup
 
 		game.Image, err = getGameImage(game)
 		if err != nil {
-			log.Printf("could not get game image: %s\n", err)
+			loggerFromContext(ctx).WithError(err).WithField("url", game.URL).Warn("could not get game image")
 		}
 
+		game.Analysis = analyses.get(game.URL)
+
 		month := game.PgnParsed.ParsedEndtime.Month()
 		year := game.PgnParsed.ParsedEndtime.Year()
 
@@ -370,12 +472,7 @@ func groupGamesForUsersByMonth(users []string, allGames []chessGame) []gameGroup
 		if !ok {
 
 			// Initialize userStats map to be returned
-			userStatsMap := make(map[string]userStats)
-			for _, user := range users {
-				userStatsMap[strings.ToLower(user)] = userStats{
-					User: user,
-				}
-			}
+			userStatsMap := newUserStatsMap(users)
 
 			group = gameGroupWithStatsMap{
 				gameGroup: gameGroup{
@@ -385,45 +482,14 @@ func groupGamesForUsersByMonth(users []string, allGames []chessGame) []gameGroup
 				userStatsMap: userStatsMap,
 			}
 		}
-		userStatsMap := group.userStatsMap
-
-		// Get usernames
-		white := game.PgnParsed.White
-		black := game.PgnParsed.Black
-
-		whiteStats := userStatsMap[strings.ToLower(white)]
-		blackStats := userStatsMap[strings.ToLower(black)]
-
-		if game.PgnParsed.Result == PgnResultWhiteWin {
-			whiteStats.Wins++
-			whiteStats.Points += 1
-			blackStats.Losses++
 
-			if whiteStats.Losses == 0 {
-				whiteStats.WinStreak++
-			}
-
-		} else if game.PgnParsed.Result == PgnResultBlackWin {
-			whiteStats.Losses++
-			blackStats.Wins++
-			blackStats.Points += 1
-
-			if blackStats.Losses == 0 {
-				blackStats.WinStreak++
-			}
+		addGameToUserStats(group.userStatsMap, game)
 
-		} else if game.PgnParsed.Result == PgnResultDraw {
-			whiteStats.Draws++
-			whiteStats.Points += 0.5
-			blackStats.Draws++
-			blackStats.Points += 0.5
+		if game.Analysis != nil {
+			group.HasAnalysis = true
 		}
 
-		userStatsMap[strings.ToLower(white)] = whiteStats
-		userStatsMap[strings.ToLower(black)] = blackStats
-
 		group.ChessGames = append(group.ChessGames, game)
-		group.userStatsMap = userStatsMap
 		gameGroupMap[key] = group
 	}
 
@@ -431,23 +497,7 @@ func groupGamesForUsersByMonth(users []string, allGames []chessGame) []gameGroup
 	groupIndex := 0
 	for _, group := range gameGroupMap {
 
-		statsSlice := make([]userStats, 0)
-		for _, stats := range group.userStatsMap {
-
-			totalGamesPlayed := float64(stats.Wins) + float64(stats.Losses) + float64(stats.Draws)
-
-			if totalGamesPlayed == 0 {
-				continue
-			}
-
-			wins := float64(stats.Wins)
-
-			stats.WinPercentage = math.Round(100*(wins/totalGamesPlayed)*100.0) / 100
-
-			statsSlice = append(statsSlice, stats)
-		}
-
-		sort.Sort(userStatsByWinPercDesc(statsSlice))
+		statsSlice := userStatsSlice(group.userStatsMap)
 
 		group.UserStatistics = statsSlice
 		gameGroupSlice[groupIndex] = group.gameGroup
@@ -460,9 +510,50 @@ func groupGamesForUsersByMonth(users []string, allGames []chessGame) []gameGroup
 	return gameGroupSlice
 }
 
+// isClubGame returns whether both Black and White are users in the club.
+func isClubGame(users []string, game chessGame) bool {
+
+	// Loop through all the users in the club and match
+	// see if Black AND White is a user in the club.
+	usernamesFound := 0
+	for _, user := range users {
+		if strings.EqualFold(game.PgnParsed.Black, user) {
+			usernamesFound++
+		}
+
+		if strings.EqualFold(game.PgnParsed.White, user) {
+			usernamesFound++
+		}
+
+		if usernamesFound == 2 {
+			break
+		}
+	}
+
+	return usernamesFound == 2
+}
+
 // getGameImage takes a game and returns the Image with a base64
 // encoding of the svg file
 func getGameImage(g chessGame) (string, error) {
+	svgBytes, err := getPositionSVG(g, len(g.ChessGame.Moves()))
+	if err != nil {
+		return "", err
+	}
+
+	// Base64 encode the SVG image to be able to embed in HTML file
+	svgBase64 := base64.StdEncoding.EncodeToString(svgBytes)
+
+	return svgBase64, nil
+}
+
+// getPositionSVG returns an svg image of the board of g after ply
+// moves, 0 being the position the game started from.
+func getPositionSVG(g chessGame, ply int) ([]byte, error) {
+	positions := g.ChessGame.Positions()
+	if ply < 0 || ply >= len(positions) {
+		return nil, fmt.Errorf("game has no position after %d moves", ply)
+	}
 
 	// Mark will be used to represent the last move made.
 	// By default, there will be no markings.
@@ -471,8 +562,8 @@ func getGameImage(g chessGame) (string, error) {
 
 	// If at least one move has been made, mark the last move
 	moves := g.ChessGame.Moves()
-	if len(moves) > 0 {
-		lastMove := moves[len(moves)-1]
+	if ply > 0 && ply <= len(moves) {
+		lastMove := moves[ply-1]
 		mark = image.MarkSquares(yellow, lastMove.S1(), lastMove.S2())
 	}
 
@@ -480,15 +571,11 @@ func getGameImage(g chessGame) (string, error) {
 	svgBuffer := bytes.Buffer{}
 
 	// Write board SVG to buffer
-	board := g.ChessGame.Position().Board()
+	board := positions[ply].Board()
 	err := image.SVG(&svgBuffer, board, mark)
 	if err != nil {
-		return "", fmt.Errorf("could not get svg file: %w", err)
+		return nil, fmt.Errorf("could not get svg file: %w", err)
 	}
 
-	// Base64 encode the SVG image to be able to embed in HTML file
-	svgBytes := svgBuffer.Bytes()
-	svgBase64 := base64.StdEncoding.EncodeToString(svgBytes)
-
-	return svgBase64, nil
+	return svgBuffer.Bytes(), nil
 }
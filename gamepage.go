@@ -0,0 +1,166 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/notnil/chess"
+)
+
+// annotatedMove is a move on the game page.
+type annotatedMove struct {
+	// Ply is the number of the move in the game, starting at 1.
+	Ply int
+
+	// Number is the move number as written before the move,
+	// such as "12." for White and "12..." for Black.
+	Number string
+	SAN    string
+
+	// Current is set for the move which led to the
+	// position shown on the board.
+	Current bool
+
+	// Eval is the evaluation after the move, empty
+	// if the game has not been analyzed.
+	Eval string
+
+	// Judgment is set for inaccuracies, mistakes and blunders,
+	// along with Symbol and the move the engine preferred.
+	Judgment string
+	Symbol   string
+	BestMove string
+}
+
+// gameMoveRow is a full move, White's and Black's.
+// Either can be nil at the start and end of a game.
+type gameMoveRow struct {
+	Number int
+	White  *annotatedMove
+	Black  *annotatedMove
+}
+
+// Cells returns White's and Black's moves.
+func (r gameMoveRow) Cells() []*annotatedMove {
+	return []*annotatedMove{r.White, r.Black}
+}
+
+// gameData has all the data needed to build out the game page.
+type gameData struct {
+	// Game.Image is the board after Ply moves,
+	// LastPly is the number of moves of the game.
+	Game    chessGame
+	Ply     int
+	LastPly int
+	Moves   []gameMoveRow
+
+	// Month is the month cursor of the game, passed along with its
+	// id so games which are not in the game store can be found.
+	Month string
+
+	// EvalChart is nil when the game has not been analyzed.
+	EvalChart *evalChart
+
+	// Highlights are the tactics found without an engine.
+	Highlights []gameHighlight
+
+	// White and Black sum up the moves of each player
+	// when the game has been analyzed.
+	White playerAnalysis
+	Black playerAnalysis
+}
+
+// judgmentSymbols are the annotation symbols of each judgment.
+var judgmentSymbols = map[string]string{
+	JudgmentInaccuracy: "?!",
+	JudgmentMistake:    "?",
+	JudgmentBlunder:    "??",
+}
+
+// formatEval returns eval the way it is shown on the game page:
+// in pawns, or as the number of moves to mate.
+func formatEval(eval positionEval) string {
+	if eval.Mate != 0 {
+		return fmt.Sprintf("#%d", eval.Mate)
+	}
+
+	if eval.CP == mateCP || eval.CP == -mateCP {
+		return "#"
+	}
+
+	return fmt.Sprintf("%+.2f", float64(eval.CP)/100)
+}
+
+// getGameData builds the game page data of game with the board after
+// ply moves and its tactical highlights, annotating its moves with
+// game.Analysis when it has been analyzed.
+func getGameData(game chessGame, ply int) gameData {
+	data := gameData{
+		Game:       game,
+		Ply:        ply,
+		Month:      monthCursor(game.PgnParsed.ParsedEndtime),
+		Highlights: getGameHighlights(game),
+	}
+
+	positions := game.ChessGame.Positions()
+	moves := game.ChessGame.Moves()
+	data.LastPly = len(moves)
+
+	var judgments []moveJudgment
+	if game.Analysis != nil && len(game.Analysis.Moves) == len(moves) {
+		judgments = game.Analysis.judgments()
+		data.White, data.Black = game.Analysis.playerAnalyses()
+	}
+
+	annotatedMoves := make([]*annotatedMove, len(moves))
+	moveNumber := fullMoveNumber(positions[0])
+	for i, move := range moves {
+		pos := positions[i]
+
+		annotated := &annotatedMove{
+			Ply:     i + 1,
+			Number:  fmt.Sprintf("%d.", moveNumber),
+			SAN:     chess.AlgebraicNotation{}.Encode(pos, move),
+			Current: i+1 == ply,
+		}
+		if pos.Turn() == chess.Black {
+			annotated.Number = fmt.Sprintf("%d...", moveNumber)
+		}
+		annotatedMoves[i] = annotated
+
+		if i < len(judgments) {
+			annotated.Eval = formatEval(game.Analysis.Evals[i+1])
+
+			judgment := judgments[i]
+			if judgment.Judgment != "" {
+				annotated.Judgment = judgment.Judgment
+				annotated.Symbol = judgmentSymbols[judgment.Judgment]
+
+				bestMove, err := chess.UCINotation{}.Decode(pos, judgment.BestMove)
+				if err == nil {
+					annotated.BestMove = chess.AlgebraicNotation{}.Encode(pos, bestMove)
+				}
+			}
+		}
+
+		if pos.Turn() == chess.White {
+			data.Moves = append(data.Moves, gameMoveRow{
+				Number: moveNumber,
+				White:  annotated,
+			})
+		} else {
+			// Games set up with Black to move start
+			// with a row without White's move.
+			if len(data.Moves) == 0 {
+				data.Moves = append(data.Moves, gameMoveRow{Number: moveNumber})
+			}
+			data.Moves[len(data.Moves)-1].Black = annotated
+			moveNumber++
+		}
+	}
+
+	if judgments != nil {
+		data.EvalChart = getEvalChart(*game.Analysis, annotatedMoves)
+	}
+
+	return data
+}
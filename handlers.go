@@ -1,29 +1,27 @@
 package main
 
 import (
+	"encoding/base64"
 	"encoding/json"
 	"fmt"
 	"net/http"
 	"strconv"
+	"strings"
 	"time"
 
-	"github.com/sirupsen/logrus"
-)
-
-var (
-	usernames = []string{
-		"PipoGambit",
-		"dalmu7",
-		"elcubanoaj",
-		"cdalmeida",
-		"maximuni",
-	}
+	"github.com/notnil/chess"
 )
 
 func healthCheckHandler(w http.ResponseWriter, r *http.Request) {
 	w.WriteHeader(http.StatusOK)
 }
 
+// getGamesForMonthHTML returns a page of finished games: the first
+// month at or before the cursor with games between club members.
+// The cursor is a YYYY-MM month passed in the cursor query param,
+// or in the year and month ones. The current month is used when
+// there is none. The cursor of the next page is returned along with
+// the HTML, empty when there are no more months.
 func getGamesForMonthHTML(w http.ResponseWriter, r *http.Request) {
 
 	// Parse form to get query params
@@ -33,117 +31,462 @@ func getGamesForMonthHTML(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Get monthString
-	monthString := r.FormValue("month")
-	if monthString == "" {
-		http.Error(w, "Invalid month query param passed in request", http.StatusBadRequest)
-		return
+	firstPage := false
+	year, month := 0, 0
+	if cursor := r.FormValue("cursor"); cursor != "" {
+		year, month, err = parseMonthCursor(cursor)
+		if err != nil {
+			http.Error(w, "Invalid cursor query param passed in request", http.StatusBadRequest)
+			return
+		}
+	} else if r.FormValue("year") != "" || r.FormValue("month") != "" {
+		year, err = strconv.Atoi(r.FormValue("year"))
+		if err != nil || year < 1 {
+			http.Error(w, "Invalid year query param passed in request", http.StatusBadRequest)
+			return
+		}
+
+		month, err = strconv.Atoi(r.FormValue("month"))
+		if err != nil || month < 1 || month > 12 {
+			http.Error(w, "Invalid month query param passed in request", http.StatusBadRequest)
+			return
+		}
+	} else {
+		now := time.Now()
+		year, month = now.Year(), int(now.Month())
+		firstPage = true
 	}
 
-	// Get yearString
-	yearString := r.FormValue("year")
-	if yearString == "" {
-		http.Error(w, "Invalid year query param passed in request", http.StatusBadRequest)
+	// online=true leaves over the board games out of the standings
+	onlineOnly := r.FormValue("online") == "true"
+
+	// standings=accuracy orders the standings by the engine analysis
+	// of the games instead of by win percentage
+	standings := r.FormValue("standings")
+	if standings != "" && standings != StandingsWinPercentage && standings != StandingsAccuracy {
+		http.Error(w, "Invalid standings query param passed in request", http.StatusBadRequest)
 		return
 	}
 
-	// Convert monthString to int
-	month, err := strconv.Atoi(monthString)
+	page := getMonthGamesPage(r.Context(), club.Members, year, month, onlineOnly)
+
+	finishedGameGroups := []gameGroup{}
+	if page.group != nil {
+		group := *page.group
+		if standings == StandingsAccuracy {
+			group.UserStatistics = sortUserStatsByAccuracy(group.UserStatistics)
+		}
+		finishedGameGroups = append(finishedGameGroups, group)
+	}
+
+	if firstPage && page.group == nil && page.nextCursor == "" {
+		finishedGameGroups = append(finishedGameGroups, gameGroup{
+			OverallNoGamesFound: true,
+		})
+	}
+
+	// Finally, get HTML page to display the selectGames
+	htmlBytes, err := getGamesForMonthHTMLBytes(finishedGameGroups, page.memberStatuses)
 	if err != nil {
-		http.Error(w, "Invalid month query param passed in request", http.StatusBadRequest)
+		http.Error(w, fmt.Sprintf("There was an error processing your request: %s", err), http.StatusInternalServerError)
 		return
 	}
 
-	// Convert yearString to int
-	year, err := strconv.Atoi(yearString)
+	// next_year and next_month are kept for clients of the
+	// year and month query params.
+	nextYear, nextMonth := 0, 0
+	if page.nextCursor != "" {
+		nextYear, nextMonth, _ = parseYearMonthString(page.nextCursor)
+	}
+
+	ret := struct {
+		HTML       string         `json:"html"`
+		NextCursor string         `json:"next_cursor"`
+		NextYear   int            `json:"next_year"`
+		NextMonth  int            `json:"next_month"`
+		Members    []memberStatus `json:"members"`
+	}{
+		HTML:       string(htmlBytes),
+		NextCursor: formatMonthCursor(page.nextCursor),
+		NextYear:   nextYear,
+		NextMonth:  nextMonth,
+		Members:    page.memberStatuses,
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+
+	if err := json.NewEncoder(w).Encode(ret); err != nil {
+		loggerFromContext(r.Context()).WithError(err).Warn("Error encoding result")
+	}
+}
+
+func getHomepage(w http.ResponseWriter, r *http.Request) {
+
+	unfinishedGameGroups, memberStatuses := getUnfinishedGamesForUsers(r.Context(), club.Members)
+
+	// Finally, get HTML page to display the selectGames
+	htmlBytes, err := getIndexHTMLBytes(unfinishedGameGroups, memberStatuses)
 	if err != nil {
-		http.Error(w, "Invalid year query param passed in request", http.StatusBadRequest)
+		http.Error(w, fmt.Sprintf("There was an error processing your request: %s", err), http.StatusInternalServerError)
 		return
 	}
 
-	if month < 1 && month > 12 {
-		http.Error(w, "Invalid year query param passed in request", http.StatusBadRequest)
+	// Write HTML page back to caller
+	w.Write(htmlBytes)
+}
+
+// importGamesHandler imports the games in the PGN files uploaded
+// in the "pgn" form field. The PGN can also be sent as the raw
+// request body.
+func importGamesHandler(w http.ResponseWriter, r *http.Request) {
+
+	// Each import reads one uploaded file, or the request body.
+	imports := []func() (importResult, error){}
+
+	if strings.HasPrefix(r.Header.Get("Content-Type"), "multipart/form-data") {
+		err := r.ParseMultipartForm(32 << 20)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Invalid upload: %s", err), http.StatusBadRequest)
+			return
+		}
+
+		for _, fileHeader := range r.MultipartForm.File["pgn"] {
+			fileHeader := fileHeader
+			imports = append(imports, func() (importResult, error) {
+				return importPgnFile(fileHeader, GameSourcePgnImport)
+			})
+		}
+	} else {
+		imports = append(imports, func() (importResult, error) {
+			return importPgnGames(r.Body, GameSourcePgnImport)
+		})
+	}
+
+	if len(imports) == 0 {
+		http.Error(w, "No PGN file uploaded", http.StatusBadRequest)
 		return
 	}
 
-	finishedGameGroup, nextYear, nextMonth := getFinishedGamesForUsersForYearMonth(usernames, year, month)
+	total := importResult{
+		Errors: []string{},
+	}
+	for _, importGames := range imports {
+		result, err := importGames()
+		total.Added += result.Added
+		total.Duplicates += result.Duplicates
+		total.Errors = append(total.Errors, result.Errors...)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("There was an error processing your request: %s", err), http.StatusInternalServerError)
+			return
+		}
+	}
 
-	finalFinishedGameGroups := []gameGroup{}
-	if finishedGameGroup != nil {
-		finalFinishedGameGroups = append(finalFinishedGameGroups, *finishedGameGroup)
+	if err := json.NewEncoder(w).Encode(total); err != nil {
+		loggerFromContext(r.Context()).WithError(err).Warn("Error encoding result")
 	}
+}
 
-	if nextYear > 0 && nextMonth > 0 {
+func getOTBGameForm(w http.ResponseWriter, r *http.Request) {
 
-		yearFound := 0
-		monthFound := 0
-		if finishedGameGroup != nil {
-			yearFound = finishedGameGroup.Year
-			monthFound = int(finishedGameGroup.Month)
+	htmlBytes, err := getOTBFormHTMLBytes(otbFormData{
+		Members: club.Members,
+	})
+	if err != nil {
+		http.Error(w, fmt.Sprintf("There was an error processing your request: %s", err), http.StatusInternalServerError)
+		return
+	}
+
+	w.Write(htmlBytes)
+}
+
+// createOTBGameHandler records an over the board game. It accepts
+// either a JSON body or the form rendered by getOTBGameForm.
+func createOTBGameHandler(w http.ResponseWriter, r *http.Request) {
+
+	if strings.HasPrefix(r.Header.Get("Content-Type"), "application/json") {
+		game := otbGame{}
+		err := json.NewDecoder(r.Body).Decode(&game)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Invalid request body: %s", err), http.StatusBadRequest)
+			return
 		}
 
-		if year != yearFound || month != monthFound {
-			finalFinishedGameGroups = append(finalFinishedGameGroups, gameGroup{
-				Year:  year,
-				Month: time.Month(month),
-			})
+		record, err := addOTBGame(game, club.Members)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
 		}
 
-		year, month = getPreviousMonth(year, month)
+		w.WriteHeader(http.StatusCreated)
+		if err := json.NewEncoder(w).Encode(record); err != nil {
+			loggerFromContext(r.Context()).WithError(err).Warn("Error encoding result")
+		}
+		return
+	}
 
-		for nextYear != year || nextMonth != month {
+	// Parse form to get the game fields
+	err := r.ParseForm()
+	if err != nil {
+		http.Error(w, fmt.Sprintf("There was an error processing your request: %s", err), http.StatusInternalServerError)
+		return
+	}
 
-			finalFinishedGameGroups = append(finalFinishedGameGroups, gameGroup{
-				Year:  year,
-				Month: time.Month(month),
-			})
-			year, month = getPreviousMonth(year, month)
-		}
+	game := otbGame{
+		White:  r.FormValue("white"),
+		Black:  r.FormValue("black"),
+		Date:   r.FormValue("date"),
+		Result: r.FormValue("result"),
+		Moves:  r.FormValue("moves"),
 	}
 
-	if finishedGameGroup == nil && nextYear == 0 && nextMonth == 0 {
-		finalFinishedGameGroups = append(finalFinishedGameGroups, gameGroup{
-			OverallNoGamesFound: true,
-		})
+	data := otbFormData{
+		Members: club.Members,
+		Game:    game,
 	}
 
-	// Finally, get HTML page to display the selectGames
-	htmlBytes, err := getGamesForMonthHTMLBytes(finalFinishedGameGroups)
+	status := http.StatusCreated
+	_, err = addOTBGame(game, club.Members)
+	if err != nil {
+		data.Error = err.Error()
+		status = http.StatusBadRequest
+	} else {
+		data.Saved = true
+	}
+
+	htmlBytes, err := getOTBFormHTMLBytes(data)
 	if err != nil {
 		http.Error(w, fmt.Sprintf("There was an error processing your request: %s", err), http.StatusInternalServerError)
 		return
 	}
 
-	ret := struct {
-		HTML      string `json:"html"`
-		NextYear  int    `json:"next_year"`
-		NextMonth int    `json:"next_month"`
-	}{
-		HTML:      string(htmlBytes),
-		NextYear:  nextYear,
-		NextMonth: nextMonth,
+	w.WriteHeader(status)
+	w.Write(htmlBytes)
+}
+
+// getConfigHandler returns the config in use with secrets redacted.
+func getConfigHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	if err := json.NewEncoder(w).Encode(appConfig.redact()); err != nil {
+		loggerFromContext(r.Context()).WithError(err).Warn("Error encoding result")
 	}
+}
 
-	if err := json.NewEncoder(w).Encode(ret); err != nil {
-		logrus.WithError(err).Warn("Error encoding result")
+// getDiagnosticsHTML shows the games whose PGN could not be parsed.
+func getDiagnosticsHTML(w http.ResponseWriter, r *http.Request) {
+
+	htmlBytes, err := getDiagnosticsHTMLBytes(diagnosticsData{
+		ParseFailures: parseFailures.recent(),
+	})
+	if err != nil {
+		http.Error(w, fmt.Sprintf("There was an error processing your request: %s", err), http.StatusInternalServerError)
+		return
+	}
+
+	w.Write(htmlBytes)
+}
+
+// getOpeningsHTML shows the openings played in the club games of the
+// game store. The opening tree is browsed from the moves, in algebraic
+// notation, passed space separated in the line query param.
+func getOpeningsHTML(w http.ResponseWriter, r *http.Request) {
+
+	report := getOpeningsReport(club.Members, store.allGames())
+
+	line := report.Tree.find(strings.Fields(r.FormValue("line")))
+	if line == nil {
+		http.Error(w, "No club game went through this line", http.StatusNotFound)
+		return
+	}
+
+	htmlBytes, err := getOpeningsHTMLBytes(openingsData{
+		Report: report,
+		Line:   line,
+	})
+	if err != nil {
+		http.Error(w, fmt.Sprintf("There was an error processing your request: %s", err), http.StatusInternalServerError)
+		return
 	}
+
+	w.Write(htmlBytes)
 }
 
-func getHomepage(w http.ResponseWriter, r *http.Request) {
+// getSearchHTML searches the club games of the game store for the
+// position of the fen query param, or the one reached by playing the
+// moves of the moves query param from the starting position.
+func getSearchHTML(w http.ResponseWriter, r *http.Request) {
 
-	unfinishedGameGroups := getUnfinishedGamesForUsers(usernames)
+	data := searchData{
+		FEN:   strings.TrimSpace(r.FormValue("fen")),
+		Moves: strings.TrimSpace(r.FormValue("moves")),
+	}
 
-	// Finally, get HTML page to display the selectGames
-	htmlBytes, err := getIndexHTMLBytes(unfinishedGameGroups)
+	var pos *chess.Position
+	var err error
+	if data.FEN != "" && data.Moves != "" {
+		err = fmt.Errorf("search by position or by moves, not both")
+	} else if data.FEN != "" {
+		pos, err = positionFromFEN(data.FEN)
+	} else if data.Moves != "" {
+		pos, err = positionFromMoves(data.Moves)
+	}
+
+	status := http.StatusOK
+	if err != nil {
+		data.Error = err.Error()
+		status = http.StatusBadRequest
+	} else if pos != nil {
+		data.Searched = true
+		data.Matches = store.searchPosition(club.Members, pos)
+	}
+
+	htmlBytes, err := getSearchHTMLBytes(data)
 	if err != nil {
 		http.Error(w, fmt.Sprintf("There was an error processing your request: %s", err), http.StatusInternalServerError)
 		return
 	}
 
-	// Write HTML page back to caller
+	w.WriteHeader(status)
 	w.Write(htmlBytes)
 }
 
+// getTerminationsHTML shows how the club games of the game store
+// ended, for every game played.
+func getTerminationsHTML(w http.ResponseWriter, r *http.Request) {
+
+	p := period{}
+	htmlBytes, err := getTerminationsHTMLBytes(getTerminationsData(club.Members, p, clubGamesForPeriod(p)))
+	if err != nil {
+		http.Error(w, fmt.Sprintf("There was an error processing your request: %s", err), http.StatusInternalServerError)
+		return
+	}
+
+	w.Write(htmlBytes)
+}
+
+// getRequestedGame returns the game whose ID is passed in the id
+// query param. Games which are not in the game store, such as the
+// chess.com games which have not been synced, are looked for in the
+// games of the month passed in the month query param.
+func getRequestedGame(r *http.Request) (chessGame, bool) {
+	id := r.FormValue("id")
+	if game, ok := store.get(id); ok {
+		return game, true
+	}
+
+	year, month, err := parseMonthCursor(r.FormValue("month"))
+	if err != nil {
+		return chessGame{}, false
+	}
+
+	index := getMonthIndex(r.Context(), club.Members, false)
+	result := getFinishedGamesForUsersForYearMonth(r.Context(), index, club.Members, year, month, false)
+	if result.group == nil {
+		return chessGame{}, false
+	}
+
+	for _, game := range result.group.ChessGames {
+		if game.URL == id {
+			return game, true
+		}
+	}
+
+	return chessGame{}, false
+}
+
+// gamePly returns the number of moves passed in the ply query param,
+// the number of moves of game when there is none.
+func gamePly(r *http.Request, game chessGame) (int, error) {
+	moves := len(game.ChessGame.Moves())
+	if r.FormValue("ply") == "" {
+		return moves, nil
+	}
+
+	ply, err := strconv.Atoi(r.FormValue("ply"))
+	if err != nil || ply < 0 || ply > moves {
+		return 0, fmt.Errorf("ply must be between 0 and %d", moves)
+	}
+
+	return ply, nil
+}
+
+// getGameHTML shows the game whose ID is passed in the id query
+// param, see getRequestedGame, along with its engine analysis. The board
+// shows the position after the number of moves in the ply query
+// param, the final position if it is not set.
+func getGameHTML(w http.ResponseWriter, r *http.Request) {
+
+	game, ok := getRequestedGame(r)
+	if !ok {
+		http.Error(w, "Game not found", http.StatusNotFound)
+		return
+	}
+
+	ply, err := gamePly(r, game)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Invalid ply query param passed in request: %s", err), http.StatusBadRequest)
+		return
+	}
+
+	svgBytes, err := getPositionSVG(game, ply)
+	if err != nil {
+		loggerFromContext(r.Context()).WithError(err).WithField("url", game.URL).Warn("could not get game image")
+	}
+	game.Image = base64.StdEncoding.EncodeToString(svgBytes)
+
+	game.Analysis = analyses.get(game.URL)
+
+	htmlBytes, err := getGameHTMLBytes(getGameData(game, ply))
+	if err != nil {
+		http.Error(w, fmt.Sprintf("There was an error processing your request: %s", err), http.StatusInternalServerError)
+		return
+	}
+
+	w.Write(htmlBytes)
+}
+
+// getGamePositionImage returns an svg image of the board of the game
+// whose ID is passed in the id query param, see getRequestedGame,
+// after the number of moves in the ply query param.
+func getGamePositionImage(w http.ResponseWriter, r *http.Request) {
+
+	game, ok := getRequestedGame(r)
+	if !ok {
+		http.Error(w, "Game not found", http.StatusNotFound)
+		return
+	}
+
+	ply, err := gamePly(r, game)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Invalid ply query param passed in request: %s", err), http.StatusBadRequest)
+		return
+	}
+
+	svgBytes, err := getPositionSVG(game, ply)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("There was an error processing your request: %s", err), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "image/svg+xml")
+	w.Write(svgBytes)
+}
+
+// getCacheStatsHandler returns the counters and size of the chess.com
+// response cache as JSON.
+func getCacheStatsHandler(w http.ResponseWriter, r *http.Request) {
+	stats := httpCacheStats{}
+	if chessComClient.cache != nil {
+		stats = chessComClient.cache.stats()
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+
+	if err := json.NewEncoder(w).Encode(stats); err != nil {
+		loggerFromContext(r.Context()).WithError(err).Warn("Error encoding result")
+	}
+}
+
 func getFaviconHandler(w http.ResponseWriter, r *http.Request) {
 	w.Write(faviconFile)
 }
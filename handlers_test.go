@@ -0,0 +1,597 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// monthGamesResponse is the JSON returned by getGamesForMonthHTML.
+type monthGamesResponse struct {
+	HTML       string         `json:"html"`
+	NextCursor string         `json:"next_cursor"`
+	Members    []memberStatus `json:"members"`
+}
+
+func getMonthGames(t *testing.T, query string) monthGamesResponse {
+	t.Helper()
+
+	rec := httptest.NewRecorder()
+	getGamesForMonthHTML(rec, httptest.NewRequest(http.MethodGet, "/monthgames?"+query, nil))
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("GET /monthgames?%s = %d: %s", query, rec.Code, rec.Body.String())
+	}
+
+	resp := monthGamesResponse{}
+	err := json.Unmarshal(rec.Body.Bytes(), &resp)
+	if err != nil {
+		t.Fatalf("could not unmarshal /monthgames response: %s", err)
+	}
+
+	return resp
+}
+
+func getHomepageBody(t *testing.T) string {
+	t.Helper()
+
+	rec := httptest.NewRecorder()
+	getHomepage(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("GET / = %d: %s", rec.Code, rec.Body.String())
+	}
+
+	return rec.Body.String()
+}
+
+func memberStatusOf(statuses []memberStatus, user string) string {
+	for _, status := range statuses {
+		if status.User == user {
+			return status.Status
+		}
+	}
+
+	return ""
+}
+
+func TestGetHomepage(t *testing.T) {
+	newFakeChessCom(t, fakeChessComFixtures, "alice", "bob", "carol")
+
+	body := getHomepageBody(t)
+
+	if !strings.Contains(body, "bob &#9823;") || !strings.Contains(body, "&#9817; alice") {
+		t.Errorf("homepage does not show the game between alice and bob")
+	}
+	if strings.Contains(body, "zed") {
+		t.Errorf("homepage shows a game against a player outside the club")
+	}
+	if strings.Contains(body, "w3-pale-yellow") {
+		t.Errorf("homepage shows the member status banner although every fetch succeeded")
+	}
+}
+
+func TestGetHomepageMemberFailure(t *testing.T) {
+	fake := newFakeChessCom(t, fakeChessComFixtures, "alice", "bob", "carol")
+	fake.setFault("/pub/player/bob/games", fakeFault{Status: http.StatusInternalServerError})
+
+	body := getHomepageBody(t)
+
+	if !strings.Contains(body, "<b>bob</b>: games missing") {
+		t.Errorf("homepage does not report bob's failed fetch")
+	}
+
+	// alice's current games still have her game against bob.
+	if !strings.Contains(body, "&#9817; alice") {
+		t.Errorf("homepage does not show the game between alice and bob")
+	}
+
+	// The request is retried twice before giving up.
+	if got := fake.requestCount("/pub/player/bob/games"); got != 3 {
+		t.Errorf("bob's games were requested %d times, want 3", got)
+	}
+}
+
+func TestGetGamesForMonthHTMLPages(t *testing.T) {
+	newFakeChessCom(t, fakeChessComFixtures, "alice", "bob", "carol")
+
+	// Months with archives of a single member (2021-03, 2021-02 and
+	// 2021-01) cannot have club games and are skipped.
+	pages := []struct {
+		cursor     string
+		month      string
+		nextCursor string
+		contains   []string
+	}{
+		{
+			cursor:     "",
+			month:      "May 2021",
+			nextCursor: "2021-04",
+			contains:   []string{"<td>alice</td>\n            <td>1</td>", "<td>carol</td>\n            <td>0</td>\n            <td>0</td>\n            <td>1</td>"},
+		},
+		{
+			cursor:     "2021-04",
+			month:      "April 2021",
+			nextCursor: "2020-12",
+			contains:   []string{"<td>carol</td>\n            <td>1</td>"},
+		},
+		{
+			cursor:     "2020-12",
+			month:      "December 2020",
+			nextCursor: "",
+			contains:   []string{"<td>alice</td>\n            <td>1</td>"},
+		},
+	}
+
+	for _, page := range pages {
+		resp := getMonthGames(t, "cursor="+page.cursor)
+
+		if !strings.Contains(resp.HTML, "<h2>"+page.month+"</h2>") {
+			t.Errorf("cursor %q: page is not %s", page.cursor, page.month)
+		}
+		if resp.NextCursor != page.nextCursor {
+			t.Errorf("cursor %q: next cursor = %q, want %q", page.cursor, resp.NextCursor, page.nextCursor)
+		}
+		for _, s := range page.contains {
+			if !strings.Contains(resp.HTML, s) {
+				t.Errorf("cursor %q: page does not contain %q", page.cursor, s)
+			}
+		}
+		if strings.Contains(resp.HTML, "zed") {
+			t.Errorf("cursor %q: page shows a game against a player outside the club", page.cursor)
+		}
+		if hasMemberProblems(resp.Members) {
+			t.Errorf("cursor %q: member statuses = %+v, want all ok", page.cursor, resp.Members)
+		}
+	}
+}
+
+func TestGetGamesForMonthHTMLNoGames(t *testing.T) {
+	newFakeChessCom(t, t.TempDir(), "alice", "bob")
+
+	resp := getMonthGames(t, "")
+
+	if !strings.Contains(resp.HTML, "No games have been completed.") {
+		t.Errorf("page does not say no games have been completed: %s", resp.HTML)
+	}
+	if resp.NextCursor != "" {
+		t.Errorf("next cursor = %q, want none", resp.NextCursor)
+	}
+}
+
+func TestGetGamesForMonthHTMLInvalidParams(t *testing.T) {
+	newFakeChessCom(t, fakeChessComFixtures, "alice", "bob", "carol")
+
+	for _, query := range []string{"cursor=2021-13", "cursor=May", "year=2021&month=0", "year=2021&month=13", "year=x&month=5"} {
+		rec := httptest.NewRecorder()
+		getGamesForMonthHTML(rec, httptest.NewRequest(http.MethodGet, "/monthgames?"+query, nil))
+
+		if rec.Code != http.StatusBadRequest {
+			t.Errorf("GET /monthgames?%s = %d, want %d", query, rec.Code, http.StatusBadRequest)
+		}
+	}
+}
+
+func TestGetGamesForMonthHTMLUpstreamFaults(t *testing.T) {
+	tests := []struct {
+		name  string
+		path  string
+		fault fakeFault
+
+		// wantRequests is how many requests path is expected to get.
+		wantRequests int
+	}{
+		{
+			name:         "rate limited then served",
+			path:         "/pub/player/alice/games/2021/05",
+			fault:        fakeFault{Status: http.StatusTooManyRequests, RetryAfter: "0", Times: 2},
+			wantRequests: 3,
+		},
+		{
+			name:         "server error then served",
+			path:         "/pub/player/alice/games/2021/05",
+			fault:        fakeFault{Status: http.StatusBadGateway, RetryAfter: "0", Times: 1},
+			wantRequests: 2,
+		},
+		{
+			// carol, who is not fetched otherwise, is fetched in
+			// place of bob so none of his games are missing.
+			name:         "server error",
+			path:         "/pub/player/bob/games/2021/05",
+			fault:        fakeFault{Status: http.StatusServiceUnavailable, RetryAfter: "0"},
+			wantRequests: 3,
+		},
+		{
+			name:         "malformed archive",
+			path:         "/pub/player/alice/games/2021/05",
+			fault:        fakeFault{Body: malformedBody},
+			wantRequests: 1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake := newFakeChessCom(t, fakeChessComFixtures, "alice", "bob", "carol")
+			fake.setFault(tt.path, tt.fault)
+
+			resp := getMonthGames(t, "cursor=2021-05")
+
+			if !strings.Contains(resp.HTML, "<h2>May 2021</h2>") {
+				t.Fatalf("page is not May 2021: %s", resp.HTML)
+			}
+
+			// Every May game between members is in two archives,
+			// so a single failure never loses one.
+			for _, s := range []string{"&#9817; alice", "&#9817; bob"} {
+				if !strings.Contains(resp.HTML, s) {
+					t.Errorf("page does not contain %q", s)
+				}
+			}
+
+			// A single failure never leaves a member's games missing.
+			for _, member := range []string{"alice", "bob", "carol"} {
+				if got := memberStatusOf(resp.Members, member); got != MemberStatusOK {
+					t.Errorf("status of %s = %q, want %q", member, got, MemberStatusOK)
+				}
+			}
+
+			if got := fake.requestCount(tt.path); got != tt.wantRequests {
+				t.Errorf("%s was requested %d times, want %d", tt.path, got, tt.wantRequests)
+			}
+		})
+	}
+}
+
+func TestGetGamesForMonthHTMLRecoveredMember(t *testing.T) {
+	fake := newFakeChessCom(t, fakeChessComFixtures, "alice", "bob", "carol")
+
+	// April 2021 is empty: alice's archive cannot be fetched and
+	// carol's, fetched in its place, has no games.
+	const path = "/pub/player/alice/games/2021/04"
+	fake.setFault(path, fakeFault{Status: http.StatusInternalServerError})
+	fake.setFault("/pub/player/carol/games/2021/04", fakeFault{Body: `{"games": []}`})
+
+	resp := getMonthGames(t, "cursor=2021-04")
+
+	// No game is missing, so the empty month is skipped.
+	if !strings.Contains(resp.HTML, "<h2>December 2020</h2>") {
+		t.Errorf("page is not December 2020: %s", resp.HTML)
+	}
+	for _, member := range []string{"alice", "bob", "carol"} {
+		if got := memberStatusOf(resp.Members, member); got != MemberStatusOK {
+			t.Errorf("status of %s = %q, want %q", member, got, MemberStatusOK)
+		}
+	}
+
+	// The month is cached like any other.
+	requests := fake.requestCount(path)
+	getMonthGames(t, "cursor=2021-04")
+
+	if got := fake.requestCount(path); got != requests {
+		t.Errorf("%s was requested again for a cached month", path)
+	}
+}
+
+func TestGetGamesForMonthHTMLMalformedArchiveListing(t *testing.T) {
+	fake := newFakeChessCom(t, fakeChessComFixtures, "alice", "bob", "carol")
+	fake.setFault("/pub/player/bob/games/archives", fakeFault{Body: malformedBody})
+
+	resp := getMonthGames(t, "cursor=2021-05")
+
+	if got := memberStatusOf(resp.Members, "bob"); got != MemberStatusFailed {
+		t.Errorf("status of bob = %q, want %q", got, MemberStatusFailed)
+	}
+
+	// bob's games with alice are still found in alice's archive.
+	if !strings.Contains(resp.HTML, "&#9817; alice") {
+		t.Errorf("page does not show the game between alice and bob")
+	}
+
+	if !strings.Contains(resp.HTML, "<b>bob</b>: games missing") {
+		t.Errorf("page does not report bob's failed fetch")
+	}
+}
+
+func TestGetGamesForMonthHTMLSlowUpstream(t *testing.T) {
+	fake := newFakeChessCom(t, fakeChessComFixtures, "alice", "bob", "carol")
+	chessComClient = newChessComClient(50*time.Millisecond, 0, 4, nil)
+	fake.setLatency("/pub/player/carol/games/archives", 200*time.Millisecond)
+
+	resp := getMonthGames(t, "cursor=2021-05")
+
+	if got := memberStatusOf(resp.Members, "carol"); got != MemberStatusFailed {
+		t.Errorf("status of carol = %q, want %q", got, MemberStatusFailed)
+	}
+
+	// alice and bob both have the game between them.
+	if !strings.Contains(resp.HTML, "&#9817; alice") {
+		t.Errorf("page does not show the game between alice and bob")
+	}
+}
+
+func TestGetGameHTML(t *testing.T) {
+	newFakeChessCom(t, fakeChessComFixtures, "alice", "bob", "carol")
+
+	_, err := store.add(storedGame{ID: "pgn:scholars-mate", Source: GameSourcePgnImport, Pgn: scholarsMatePgn})
+	if err != nil {
+		t.Fatalf("could not add game to the store: %s", err)
+	}
+	analyses.analyses[scholarsMateAnalysis.GameID] = scholarsMateAnalysis
+
+	rec := httptest.NewRecorder()
+	getGameHTML(rec, httptest.NewRequest(http.MethodGet, "/game?id=pgn:scholars-mate", nil))
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("GET /game = %d: %s", rec.Code, rec.Body.String())
+	}
+	if !strings.Contains(rec.Body.String(), "Nf6??") {
+		t.Errorf("game page does not flag Nf6 as a blunder")
+	}
+
+	// The month page links to the analysis.
+	resp := getMonthGames(t, "cursor=2021-05")
+	if !strings.Contains(resp.HTML, `href="game?id=pgn%3ascholars-mate&month=2021-05"`) {
+		t.Errorf("month page does not link to the game analysis")
+	}
+
+	// Standings can be ordered by accuracy, carol has no analyzed games.
+	resp = getMonthGames(t, "cursor=2021-05&standings=accuracy")
+	alice, bob, carol := strings.Index(resp.HTML, "<td>alice</td>"), strings.Index(resp.HTML, "<td>bob</td>"), strings.Index(resp.HTML, "<td>carol</td>")
+	if alice == -1 || !(alice < bob && bob < carol) {
+		t.Errorf("standings ordered by accuracy are not alice, bob, carol")
+	}
+
+	rec = httptest.NewRecorder()
+	getGamesForMonthHTML(rec, httptest.NewRequest(http.MethodGet, "/monthgames?cursor=2021-05&standings=elo", nil))
+
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("GET /monthgames with an unknown standings order = %d, want %d", rec.Code, http.StatusBadRequest)
+	}
+
+	// Replaying the game marks the move on the board.
+	rec = httptest.NewRecorder()
+	getGameHTML(rec, httptest.NewRequest(http.MethodGet, "/game?id=pgn:scholars-mate&ply=3", nil))
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("GET /game at ply 3 = %d: %s", rec.Code, rec.Body.String())
+	}
+	if !strings.Contains(rec.Body.String(), `<td class="current"><a href="game?id=pgn%3ascholars-mate&month=2021-05&ply=3">Qh5</a>`) {
+		t.Errorf("game page at ply 3 does not mark Qh5 as the current move")
+	}
+
+	for _, query := range []string{"ply=-1", "ply=8", "ply=e4"} {
+		rec = httptest.NewRecorder()
+		getGameHTML(rec, httptest.NewRequest(http.MethodGet, "/game?id=pgn:scholars-mate&"+query, nil))
+
+		if rec.Code != http.StatusBadRequest {
+			t.Errorf("GET /game with %s = %d, want %d", query, rec.Code, http.StatusBadRequest)
+		}
+	}
+
+	rec = httptest.NewRecorder()
+	getGameHTML(rec, httptest.NewRequest(http.MethodGet, "/game?id=pgn:missing", nil))
+
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("GET /game for a missing game = %d, want %d", rec.Code, http.StatusNotFound)
+	}
+}
+
+func TestGetGameHTMLForChessComGame(t *testing.T) {
+	newFakeChessCom(t, fakeChessComFixtures, "alice", "bob", "carol")
+
+	// Every game on the month page links to its game page.
+	resp := getMonthGames(t, "cursor=2021-05")
+	if games, links := strings.Count(resp.HTML, "w3-third"), strings.Count(resp.HTML, `href="game?id=`); links != games {
+		t.Errorf("month page links %d of its %d games", links, games)
+	}
+	if !strings.Contains(resp.HTML, `href="game?id=https%3a%2f%2fwww.chess.com%2fgame%2flive%2f1001&month=2021-05"`) {
+		t.Errorf("month page does not link to a game fetched from chess.com")
+	}
+
+	// Viewing games does not write to the game store.
+	if games := store.allGames(); len(games) != 0 {
+		t.Errorf("game store has %d games after viewing a month, want 0", len(games))
+	}
+
+	rec := httptest.NewRecorder()
+	getGameHTML(rec, httptest.NewRequest(http.MethodGet, "/game?id=https://www.chess.com/game/live/1001&month=2021-05", nil))
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("GET /game for a chess.com game = %d: %s", rec.Code, rec.Body.String())
+	}
+	if !strings.Contains(rec.Body.String(), `href="game?id=https%3a%2f%2fwww.chess.com%2fgame%2flive%2f1001&month=2021-05&ply=0"`) {
+		t.Errorf("game page does not link its moves with the month of the game")
+	}
+
+	rec = httptest.NewRecorder()
+	getGamePositionImage(rec, httptest.NewRequest(http.MethodGet, "/game/position?id=https://www.chess.com/game/live/1001&month=2021-05&ply=2", nil))
+
+	if rec.Code != http.StatusOK {
+		t.Errorf("GET /game/position for a chess.com game = %d: %s", rec.Code, rec.Body.String())
+	}
+
+	for _, query := range []string{"", "&month=2021-04", "&month=May"} {
+		rec = httptest.NewRecorder()
+		getGameHTML(rec, httptest.NewRequest(http.MethodGet, "/game?id=https://www.chess.com/game/live/1001"+query, nil))
+
+		if rec.Code != http.StatusNotFound {
+			t.Errorf("GET /game for a chess.com game with %q = %d, want %d", query, rec.Code, http.StatusNotFound)
+		}
+	}
+}
+
+func TestGetOpeningsHTML(t *testing.T) {
+	newFakeChessCom(t, fakeChessComFixtures, "alice", "bob", "carol")
+
+	_, err := store.add(storedGame{ID: "pgn:scholars-mate", Source: GameSourcePgnImport, Pgn: scholarsMatePgn})
+	if err != nil {
+		t.Fatalf("could not add game to the store: %s", err)
+	}
+
+	rec := httptest.NewRecorder()
+	getOpeningsHTML(rec, httptest.NewRequest(http.MethodGet, "/openings?line=e4+e5+Qh5", nil))
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("GET /openings = %d: %s", rec.Code, rec.Body.String())
+	}
+	if !strings.Contains(rec.Body.String(), `<a href="openings?line=e4%20e5%20Qh5%20Nc6">Nc6</a>`) {
+		t.Errorf("openings page does not link to the next move of the line")
+	}
+	if !strings.Contains(rec.Body.String(), `href="game?id=pgn%3ascholars-mate"`) {
+		t.Errorf("openings page does not link to the example game")
+	}
+
+	rec = httptest.NewRecorder()
+	getOpeningsHTML(rec, httptest.NewRequest(http.MethodGet, "/openings?line=d4", nil))
+
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("GET /openings for a line no game went through = %d, want %d", rec.Code, http.StatusNotFound)
+	}
+}
+
+func TestGetTerminationsHTML(t *testing.T) {
+	newFakeChessCom(t, fakeChessComFixtures, "alice", "bob", "carol")
+
+	_, err := store.add(storedGame{ID: "pgn:scholars-mate", Source: GameSourcePgnImport, Pgn: scholarsMatePgn})
+	if err != nil {
+		t.Fatalf("could not add game to the store: %s", err)
+	}
+
+	// A game from another season, won by a draw-only termination.
+	const agreedPgn = `[Date "2019.03.02"]
+[White "carol"]
+[Black "alice"]
+[Result "1-0"]
+[Termination "carol won by agreement"]
+
+1. e4 e5 1-0`
+	_, err = store.add(storedGame{ID: "pgn:agreed", Source: GameSourcePgnImport, Pgn: agreedPgn})
+	if err != nil {
+		t.Fatalf("could not add game to the store: %s", err)
+	}
+
+	rec := httptest.NewRecorder()
+	getTerminationsHTML(rec, httptest.NewRequest(http.MethodGet, "/terminations", nil))
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("GET /terminations = %d: %s", rec.Code, rec.Body.String())
+	}
+
+	body := rec.Body.String()
+	if !strings.Contains(body, "All time, 2 games.") {
+		t.Errorf("terminations page does not count every game in the store")
+	}
+	for _, row := range []string{
+		"<td>alice</td>\n                <td>1 checkmate</td>\n                <td>1 other</td>",
+		"<td>carol</td>\n                <td>1 other</td>",
+	} {
+		if !strings.Contains(body, row) {
+			t.Errorf("terminations page does not contain %q", row)
+		}
+	}
+}
+
+func TestGetGamePositionImage(t *testing.T) {
+	newFakeChessCom(t, fakeChessComFixtures, "alice", "bob", "carol")
+
+	_, err := store.add(storedGame{ID: "pgn:scholars-mate", Source: GameSourcePgnImport, Pgn: scholarsMatePgn})
+	if err != nil {
+		t.Fatalf("could not add game to the store: %s", err)
+	}
+
+	tests := []struct {
+		query    string
+		wantCode int
+	}{
+		{query: "id=pgn:scholars-mate&ply=6", wantCode: http.StatusOK},
+		{query: "id=pgn:scholars-mate&ply=0", wantCode: http.StatusOK},
+		{query: "id=pgn:scholars-mate", wantCode: http.StatusOK},
+		{query: "id=pgn:scholars-mate&ply=8", wantCode: http.StatusBadRequest},
+		{query: "id=pgn:missing&ply=1", wantCode: http.StatusNotFound},
+	}
+
+	for _, tt := range tests {
+		rec := httptest.NewRecorder()
+		getGamePositionImage(rec, httptest.NewRequest(http.MethodGet, "/game/position?"+tt.query, nil))
+
+		if rec.Code != tt.wantCode {
+			t.Errorf("GET /game/position?%s = %d, want %d", tt.query, rec.Code, tt.wantCode)
+			continue
+		}
+		if tt.wantCode != http.StatusOK {
+			continue
+		}
+
+		if contentType := rec.Header().Get("Content-Type"); contentType != "image/svg+xml" {
+			t.Errorf("GET /game/position?%s Content-Type = %q, want image/svg+xml", tt.query, contentType)
+		}
+		if !strings.HasPrefix(rec.Body.String(), "<svg") && !strings.HasPrefix(rec.Body.String(), "<?xml") {
+			t.Errorf("GET /game/position?%s is not an svg: %.50s", tt.query, rec.Body.String())
+		}
+	}
+}
+
+// useAdminPassword sets the admin password until the test ends.
+func useAdminPassword(t *testing.T, password string) {
+	t.Helper()
+
+	old := appConfig.AdminPassword
+	appConfig.AdminPassword = password
+	t.Cleanup(func() { appConfig.AdminPassword = old })
+}
+
+// serveRouter serves a request for method and path with the router
+// of the server, authenticated as the admin with password if set.
+func serveRouter(method, path, password string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, nil)
+	if password != "" {
+		req.SetBasicAuth(adminUsername, password)
+	}
+
+	rec := httptest.NewRecorder()
+	newRouter(time.Second).ServeHTTP(rec, req)
+
+	return rec
+}
+
+func TestSensitiveRoutesAreAdminOnly(t *testing.T) {
+	newFakeChessCom(t, fakeChessComFixtures, "alice", "bob", "carol")
+	useAdminPassword(t, "secret")
+
+	sensitive := []struct {
+		method string
+		path   string
+	}{
+		{method: http.MethodGet, path: "/config"},
+		{method: http.MethodGet, path: "/cache/stats"},
+		{method: http.MethodGet, path: "/diagnostics"},
+		{method: http.MethodGet, path: "/metrics"},
+		{method: http.MethodPost, path: "/games/import"},
+		{method: http.MethodGet, path: "/otb"},
+		{method: http.MethodPost, path: "/otb"},
+	}
+
+	for _, s := range sensitive {
+		found := false
+		for _, r := range routes {
+			if r.method == s.method && r.pattern == s.path {
+				found = true
+				if !r.adminOnly {
+					t.Errorf("%s %s is not admin only", s.method, s.path)
+				}
+			}
+		}
+		if !found {
+			t.Errorf("%s %s has no route", s.method, s.path)
+		}
+
+		for _, password := range []string{"", "wrong"} {
+			if rec := serveRouter(s.method, s.path, password); rec.Code != http.StatusUnauthorized {
+				t.Errorf("%s %s with password %q = %d, want %d", s.method, s.path, password, rec.Code, http.StatusUnauthorized)
+			}
+		}
+	}
+}
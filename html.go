@@ -15,6 +15,24 @@ var (
 	//go:embed website/gamesForMonth.html
 	gamesForMonthHTMLTemplate string
 
+	//go:embed website/otb.html
+	otbHTMLTemplate string
+
+	//go:embed website/diagnostics.html
+	diagnosticsHTMLTemplate string
+
+	//go:embed website/game.html
+	gameHTMLTemplate string
+
+	//go:embed website/openings.html
+	openingsHTMLTemplate string
+
+	//go:embed website/search.html
+	searchHTMLTemplate string
+
+	//go:embed website/terminations.html
+	terminationsHTMLTemplate string
+
 	//go:embed website/images/favicon.ico
 	faviconFile []byte
 )
@@ -26,16 +44,23 @@ var (
 type htmlData struct {
 	CurrGameGroups     []gameGroup
 	FinishedGameGroups []gameGroup
+
+	// MemberStatuses are shown in a banner when a member's games
+	// are stale or missing.
+	MemberStatuses    []memberStatus
+	HasMemberProblems bool
 }
 
 // getIndexHTMLBytes takes a slice of games and returns an HTML
 // webpage using index.html as a template file.
-func getIndexHTMLBytes(currentGameGroups []gameGroup) ([]byte, error) {
+func getIndexHTMLBytes(currentGameGroups []gameGroup, memberStatuses []memberStatus) ([]byte, error) {
 
 	// Initialize the gameSlices object which will be passed
 	// into the html template file
 	data := htmlData{
-		CurrGameGroups: currentGameGroups,
+		CurrGameGroups:    currentGameGroups,
+		MemberStatuses:    memberStatuses,
+		HasMemberProblems: hasMemberProblems(memberStatuses),
 	}
 
 	funcs := template.FuncMap{
@@ -64,12 +89,14 @@ func getIndexHTMLBytes(currentGameGroups []gameGroup) ([]byte, error) {
 
 // getGamesForMonthHTMLBytes takes a slice of games and returns an HTML
 // webpage using gamesForMonth.html as a template file.
-func getGamesForMonthHTMLBytes(finishedGameGroups []gameGroup) ([]byte, error) {
+func getGamesForMonthHTMLBytes(finishedGameGroups []gameGroup, memberStatuses []memberStatus) ([]byte, error) {
 
 	// Initialize the gameSlices object which will be passed
 	// into the html template file
 	data := htmlData{
 		FinishedGameGroups: finishedGameGroups,
+		MemberStatuses:     memberStatuses,
+		HasMemberProblems:  hasMemberProblems(memberStatuses),
 	}
 
 	funcs := template.FuncMap{
@@ -77,6 +104,7 @@ func getGamesForMonthHTMLBytes(finishedGameGroups []gameGroup) ([]byte, error) {
 		"subtract":    subtract,
 		"getIndexes":  getIndexes,
 		"monthString": monthString,
+		"monthCursor": monthCursor,
 	}
 
 	// Parse the HTML template file
@@ -96,6 +124,188 @@ func getGamesForMonthHTMLBytes(finishedGameGroups []gameGroup) ([]byte, error) {
 	return outputParsed.Bytes(), nil
 }
 
+// otbFormData has all the data needed to build out the
+// over the board game form.
+type otbFormData struct {
+	Members []string
+	Game    otbGame
+	Saved   bool
+	Error   string
+}
+
+// getOTBFormHTMLBytes returns the over the board game form
+// using otb.html as a template file.
+func getOTBFormHTMLBytes(data otbFormData) ([]byte, error) {
+
+	// Parse the HTML template file
+	tmplt, err := template.New("otb").Parse(otbHTMLTemplate)
+	if err != nil {
+		return nil, fmt.Errorf("could not parse file template: %w", err)
+	}
+
+	// Pass in the data
+	outputParsed := bytes.Buffer{}
+	err = tmplt.Execute(&outputParsed, data)
+	if err != nil {
+		return nil, fmt.Errorf("could not execute file template: %w", err)
+	}
+
+	// Return the bytes of the webpage
+	return outputParsed.Bytes(), nil
+}
+
+// diagnosticsData has all the data needed to build out
+// the diagnostics page.
+type diagnosticsData struct {
+	ParseFailures []parseFailure
+}
+
+// getDiagnosticsHTMLBytes returns the diagnostics page using
+// diagnostics.html as a template file.
+func getDiagnosticsHTMLBytes(data diagnosticsData) ([]byte, error) {
+
+	// Parse the HTML template file
+	tmplt, err := template.New("diagnostics").Parse(diagnosticsHTMLTemplate)
+	if err != nil {
+		return nil, fmt.Errorf("could not parse file template: %w", err)
+	}
+
+	// Pass in the data
+	outputParsed := bytes.Buffer{}
+	err = tmplt.Execute(&outputParsed, data)
+	if err != nil {
+		return nil, fmt.Errorf("could not execute file template: %w", err)
+	}
+
+	// Return the bytes of the webpage
+	return outputParsed.Bytes(), nil
+}
+
+// getGameHTMLBytes returns the page of a single game using
+// game.html as a template file.
+func getGameHTMLBytes(data gameData) ([]byte, error) {
+
+	funcs := template.FuncMap{
+		"add":      add,
+		"subtract": subtract,
+	}
+
+	// Parse the HTML template file
+	tmplt, err := template.New("game").Funcs(funcs).Parse(gameHTMLTemplate)
+	if err != nil {
+		return nil, fmt.Errorf("could not parse file template: %w", err)
+	}
+
+	// Pass in the data
+	outputParsed := bytes.Buffer{}
+	err = tmplt.Execute(&outputParsed, data)
+	if err != nil {
+		return nil, fmt.Errorf("could not execute file template: %w", err)
+	}
+
+	// Return the bytes of the webpage
+	return outputParsed.Bytes(), nil
+}
+
+// openingsData has all the data needed to build out the openings
+// page. Line is the line of the opening tree being browsed, from the
+// starting position to the move it ends with.
+type openingsData struct {
+	Report openingsReport
+	Line   []*openingNode
+}
+
+// Node returns the last move of the line being browsed.
+func (d openingsData) Node() *openingNode {
+	return d.Line[len(d.Line)-1]
+}
+
+// getOpeningsHTMLBytes returns the openings page using
+// openings.html as a template file.
+func getOpeningsHTMLBytes(data openingsData) ([]byte, error) {
+
+	funcs := template.FuncMap{
+		"add": add,
+	}
+
+	// Parse the HTML template file
+	tmplt, err := template.New("openings").Funcs(funcs).Parse(openingsHTMLTemplate)
+	if err != nil {
+		return nil, fmt.Errorf("could not parse file template: %w", err)
+	}
+
+	// Pass in the data
+	outputParsed := bytes.Buffer{}
+	err = tmplt.Execute(&outputParsed, data)
+	if err != nil {
+		return nil, fmt.Errorf("could not execute file template: %w", err)
+	}
+
+	// Return the bytes of the webpage
+	return outputParsed.Bytes(), nil
+}
+
+// searchData has all the data needed to build out the position
+// search page. Searched is set once a position has been searched.
+type searchData struct {
+	FEN      string
+	Moves    string
+	Error    string
+	Searched bool
+	Matches  []positionMatch
+}
+
+// getSearchHTMLBytes returns the position search page using
+// search.html as a template file.
+func getSearchHTMLBytes(data searchData) ([]byte, error) {
+
+	// Parse the HTML template file
+	tmplt, err := template.New("search").Parse(searchHTMLTemplate)
+	if err != nil {
+		return nil, fmt.Errorf("could not parse file template: %w", err)
+	}
+
+	// Pass in the data
+	outputParsed := bytes.Buffer{}
+	err = tmplt.Execute(&outputParsed, data)
+	if err != nil {
+		return nil, fmt.Errorf("could not execute file template: %w", err)
+	}
+
+	// Return the bytes of the webpage
+	return outputParsed.Bytes(), nil
+}
+
+// terminationsData has all the data needed to build out the page
+// of how the games of Period ended, with the stats of every player
+// who played in it.
+type terminationsData struct {
+	Period         period
+	Games          int
+	UserStatistics []userStats
+}
+
+// getTerminationsHTMLBytes returns the page of how games ended using
+// terminations.html as a template file.
+func getTerminationsHTMLBytes(data terminationsData) ([]byte, error) {
+
+	// Parse the HTML template file
+	tmplt, err := template.New("terminations").Parse(terminationsHTMLTemplate)
+	if err != nil {
+		return nil, fmt.Errorf("could not parse file template: %w", err)
+	}
+
+	// Pass in the data
+	outputParsed := bytes.Buffer{}
+	err = tmplt.Execute(&outputParsed, data)
+	if err != nil {
+		return nil, fmt.Errorf("could not execute file template: %w", err)
+	}
+
+	// Return the bytes of the webpage
+	return outputParsed.Bytes(), nil
+}
+
 func add(x, y int) int {
 	return x + y
 }
@@ -115,3 +325,12 @@ func getIndexes(interval int, max int) []int {
 func monthString(month time.Month) string {
 	return month.String()
 }
+
+// monthCursor returns the month cursor of t, empty if t is not set.
+func monthCursor(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+
+	return t.Format("2006-01")
+}
@@ -0,0 +1,375 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"flag"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+var update = flag.Bool("update", false, "update the golden files in testdata/golden")
+
+// assertGolden compares got to the golden file name in testdata/golden,
+// or writes got to it when the tests are run with -update.
+func assertGolden(t *testing.T, name string, got []byte) {
+	t.Helper()
+
+	path := filepath.Join("testdata", "golden", name)
+
+	if *update {
+		err := os.MkdirAll(filepath.Dir(path), 0755)
+		if err == nil {
+			err = ioutil.WriteFile(path, got, 0644)
+		}
+		if err != nil {
+			t.Fatalf("could not update golden file: %s", err)
+		}
+		return
+	}
+
+	want, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatalf("could not read golden file, run the tests with -update to create it: %s", err)
+	}
+
+	if bytes.Equal(got, want) {
+		return
+	}
+
+	gotLines := strings.Split(string(got), "\n")
+	wantLines := strings.Split(string(want), "\n")
+	for i := 0; i < len(gotLines) || i < len(wantLines); i++ {
+		gotLine, wantLine := "", ""
+		if i < len(gotLines) {
+			gotLine = gotLines[i]
+		}
+		if i < len(wantLines) {
+			wantLine = wantLines[i]
+		}
+		if gotLine != wantLine {
+			t.Errorf("%s differs from %s at line %d, run the tests with -update and review the diff\ngot:  %.200s\nwant: %.200s", name, path, i+1, gotLine, wantLine)
+			return
+		}
+	}
+}
+
+// loadFixtureFinishedGames returns the games of a monthly archive
+// fixture in testdata/chesscom.
+func loadFixtureFinishedGames(t *testing.T, path string) []chessGame {
+	t.Helper()
+
+	fileBytes, err := ioutil.ReadFile(filepath.Join(fakeChessComFixtures, path))
+	if err != nil {
+		t.Fatalf("could not read fixture: %s", err)
+	}
+
+	archive := chessComFinishedUserGames{}
+	err = json.Unmarshal(fileBytes, &archive)
+	if err != nil {
+		t.Fatalf("could not unmarshal fixture %s: %s", path, err)
+	}
+
+	games := []chessGame{}
+	for i := range archive.Games {
+		game, err := chessGameFromChessComFinishedGame("", &archive.Games[i])
+		if err != nil {
+			t.Fatalf("could not read game %s: %s", archive.Games[i].URL, err)
+		}
+		games = append(games, game)
+	}
+
+	return games
+}
+
+// loadFixtureCurrentGames returns the games of a current games
+// fixture in testdata/chesscom.
+func loadFixtureCurrentGames(t *testing.T, path string) []chessGame {
+	t.Helper()
+
+	fileBytes, err := ioutil.ReadFile(filepath.Join(fakeChessComFixtures, path))
+	if err != nil {
+		t.Fatalf("could not read fixture: %s", err)
+	}
+
+	current := chessComCurrentUserGames{}
+	err = json.Unmarshal(fileBytes, &current)
+	if err != nil {
+		t.Fatalf("could not unmarshal fixture %s: %s", path, err)
+	}
+
+	games := []chessGame{}
+	for _, currentGame := range current.Games {
+		game, err := chessGameFromChessComCurrentGame("", currentGame)
+		if err != nil {
+			t.Fatalf("could not read game %s: %s", currentGame.URL, err)
+		}
+		games = append(games, game)
+	}
+
+	return games
+}
+
+func findGame(t *testing.T, games []chessGame, url string) chessGame {
+	t.Helper()
+
+	for _, game := range games {
+		if game.URL == url {
+			return game
+		}
+	}
+
+	t.Fatalf("no game %s in fixtures", url)
+	return chessGame{}
+}
+
+var goldenMembers = []string{"alice", "bob", "carol"}
+
+func TestGetIndexHTMLBytesGolden(t *testing.T) {
+	currentGames := append(loadFixtureCurrentGames(t, "alice/games.json"), loadFixtureCurrentGames(t, "carol/games.json")...)
+	currentGameGroups := groupGamesForUsersByMonth(context.Background(), goldenMembers, currentGames)
+
+	staleSince := time.Date(2021, 5, 25, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		golden         string
+		gameGroups     []gameGroup
+		memberStatuses []memberStatus
+	}{
+		{
+			golden:     "index.html",
+			gameGroups: currentGameGroups,
+			memberStatuses: []memberStatus{
+				{User: "alice", Status: MemberStatusOK},
+				{User: "bob", Status: MemberStatusOK},
+				{User: "carol", Status: MemberStatusOK},
+			},
+		},
+		{
+			golden:     "index_member_problems.html",
+			gameGroups: []gameGroup{},
+			memberStatuses: []memberStatus{
+				{User: "alice", Status: MemberStatusOK},
+				{User: "bob", Status: MemberStatusStale, Reason: "chess.com could not be reached (chess.com returned status 503), showing games as of May 25 12:00 UTC", StaleSince: &staleSince},
+				{User: "carol", Status: MemberStatusFailed, Reason: "could not get current games for username carol: chess.com returned status 500"},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.golden, func(t *testing.T) {
+			got, err := getIndexHTMLBytes(tt.gameGroups, tt.memberStatuses)
+			if err != nil {
+				t.Fatalf("getIndexHTMLBytes() error = %s", err)
+			}
+
+			assertGolden(t, tt.golden, got)
+		})
+	}
+}
+
+func TestGetGamesForMonthHTMLBytesGolden(t *testing.T) {
+	games := append(loadFixtureFinishedGames(t, "bob/2021/05.json"), loadFixtureFinishedGames(t, "alice/2021/05.json")...)
+	mayGameGroups := groupGamesForUsersByMonth(context.Background(), goldenMembers, games)
+
+	useAnalyses(t, scholarsMateAnalysis)
+	analyzedGameGroups := groupGamesForUsersByMonth(context.Background(), goldenMembers, append(games, scholarsMateGame(t)))
+
+	tests := []struct {
+		golden         string
+		gameGroups     []gameGroup
+		memberStatuses []memberStatus
+	}{
+		{
+			golden:     "gamesForMonth.html",
+			gameGroups: mayGameGroups,
+		},
+		{
+			golden:     "gamesForMonth_analysis.html",
+			gameGroups: analyzedGameGroups,
+		},
+		{
+			golden:     "gamesForMonth_no_games.html",
+			gameGroups: []gameGroup{{OverallNoGamesFound: true}},
+		},
+		{
+			golden:     "gamesForMonth_member_problems.html",
+			gameGroups: mayGameGroups,
+			memberStatuses: []memberStatus{
+				{User: "alice", Status: MemberStatusFailed, Reason: "could not get finished games with url alice: chess.com returned status 503"},
+				{User: "bob", Status: MemberStatusOK},
+				{User: "carol", Status: MemberStatusOK},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.golden, func(t *testing.T) {
+			got, err := getGamesForMonthHTMLBytes(tt.gameGroups, tt.memberStatuses)
+			if err != nil {
+				t.Fatalf("getGamesForMonthHTMLBytes() error = %s", err)
+			}
+
+			assertGolden(t, tt.golden, got)
+		})
+	}
+}
+
+func TestGetGamesForMonthHTMLBytesEmptyPage(t *testing.T) {
+	// A page without a month with games, such as one which ran out of
+	// months to scan, must be blank for the website to load the next.
+	got, err := getGamesForMonthHTMLBytes([]gameGroup{}, []memberStatus{{User: "alice", Status: MemberStatusOK}})
+	if err != nil {
+		t.Fatalf("getGamesForMonthHTMLBytes() error = %s", err)
+	}
+
+	if strings.TrimSpace(string(got)) != "" {
+		t.Errorf("empty page is not blank: %q", got)
+	}
+}
+
+func TestGetGameHTMLBytesGolden(t *testing.T) {
+	game := scholarsMateGame(t)
+
+	image, err := getGameImage(game)
+	if err != nil {
+		t.Fatalf("getGameImage() error = %s", err)
+	}
+	game.Image = image
+
+	analyzedGame := game
+	analyzedGame.Analysis = &scholarsMateAnalysis
+
+	missedMateGame, err := getChessGame("1. e4 e5 2. Bc4 Nc6 3. Qh5 Nf6 4. Qf3 *")
+	if err != nil {
+		t.Fatalf("could not parse pgn: %s", err)
+	}
+	missedMateGame.URL = "pgn:missed-mate"
+
+	tests := []struct {
+		golden string
+		game   chessGame
+	}{
+		{golden: "game.html", game: game},
+		{golden: "game_analysis.html", game: analyzedGame},
+		{golden: "game_highlights.html", game: missedMateGame},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.golden, func(t *testing.T) {
+			got, err := getGameHTMLBytes(getGameData(tt.game, len(tt.game.ChessGame.Moves())))
+			if err != nil {
+				t.Fatalf("getGameHTMLBytes() error = %s", err)
+			}
+
+			assertGolden(t, tt.golden, got)
+		})
+	}
+}
+
+func TestGetOpeningsHTMLBytesGolden(t *testing.T) {
+	games := append(loadFixtureFinishedGames(t, "bob/2021/05.json"), loadFixtureFinishedGames(t, "alice/2021/05.json")...)
+	report := getOpeningsReport(goldenMembers, games)
+
+	tests := []struct {
+		golden string
+		report openingsReport
+		line   []string
+	}{
+		{golden: "openings.html", report: report},
+		{golden: "openings_line.html", report: report, line: []string{"e4", "e5"}},
+		{golden: "openings_no_games.html", report: getOpeningsReport(goldenMembers, nil)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.golden, func(t *testing.T) {
+			line := tt.report.Tree.find(tt.line)
+			if line == nil {
+				t.Fatalf("no game went through %v", tt.line)
+			}
+
+			got, err := getOpeningsHTMLBytes(openingsData{Report: tt.report, Line: line})
+			if err != nil {
+				t.Fatalf("getOpeningsHTMLBytes() error = %s", err)
+			}
+
+			assertGolden(t, tt.golden, got)
+		})
+	}
+}
+
+func TestGetTerminationsHTMLBytesGolden(t *testing.T) {
+	// Games between alice and bob are in both archives.
+	games, seen := []chessGame{}, map[string]bool{}
+	for _, game := range append(loadFixtureFinishedGames(t, "bob/2021/05.json"), loadFixtureFinishedGames(t, "alice/2021/05.json")...) {
+		if isClubGame(goldenMembers, game) && !seen[game.URL] {
+			seen[game.URL] = true
+			games = append(games, game)
+		}
+	}
+	sort.Sort(chessGamesByEndTimeDesc(games))
+
+	tests := []struct {
+		golden string
+		games  []chessGame
+	}{
+		{golden: "terminations.html", games: games},
+		{golden: "terminations_no_games.html"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.golden, func(t *testing.T) {
+			got, err := getTerminationsHTMLBytes(getTerminationsData(goldenMembers, period{}, tt.games))
+			if err != nil {
+				t.Fatalf("getTerminationsHTMLBytes() error = %s", err)
+			}
+
+			assertGolden(t, tt.golden, got)
+		})
+	}
+}
+
+func TestGetGameImageGolden(t *testing.T) {
+	finishedGames := loadFixtureFinishedGames(t, "alice/2021/05.json")
+	currentGames := loadFixtureCurrentGames(t, "carol/games.json")
+
+	// A game rebuilt from its final position has no last move to mark.
+	unparsable := *findGame(t, finishedGames, "https://www.chess.com/game/live/1001").ChessComFinishedGame
+	unparsable.Pgn = "1. e4 zz9"
+	fallbackGame, err := chessGameFromChessComFinishedGame("", &unparsable)
+	if err != nil {
+		t.Fatalf("could not build fallback game: %s", err)
+	}
+
+	tests := []struct {
+		golden string
+		game   chessGame
+	}{
+		{golden: "game_checkmate.svg", game: findGame(t, finishedGames, "https://www.chess.com/game/live/1001")},
+		{golden: "game_current.svg", game: findGame(t, currentGames, "https://www.chess.com/game/daily/2002")},
+		{golden: "game_fen_fallback.svg", game: fallbackGame},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.golden, func(t *testing.T) {
+			image, err := getGameImage(tt.game)
+			if err != nil {
+				t.Fatalf("getGameImage() error = %s", err)
+			}
+
+			svg, err := base64.StdEncoding.DecodeString(image)
+			if err != nil {
+				t.Fatalf("getGameImage() is not base64: %s", err)
+			}
+
+			assertGolden(t, tt.golden, svg)
+		})
+	}
+}
@@ -0,0 +1,223 @@
+package main
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// closedMonthGracePeriod is how long after the end of a month its
+	// archive may still change (games finishing in other time zones).
+	closedMonthGracePeriod = 24 * time.Hour
+
+	currentGamesTTL  = time.Minute
+	currentMonthTTL  = 5 * time.Minute
+	archivesListTTL  = time.Hour
+	defaultHTTPCache = 5 * time.Minute
+)
+
+// cachedResponse is a chess.com response saved on disk.
+type cachedResponse struct {
+	URL          string    `json:"url"`
+	ETag         string    `json:"etag,omitempty"`
+	LastModified string    `json:"last_modified,omitempty"`
+	FetchedAt    time.Time `json:"fetched_at"`
+	Body         []byte    `json:"body"`
+}
+
+// httpCacheStats are the counters of the HTTP cache.
+type httpCacheStats struct {
+	// Hits were served from disk without asking chess.com.
+	Hits int64 `json:"hits"`
+
+	// Revalidations were answered 304 Not Modified by chess.com.
+	Revalidations int64 `json:"revalidations"`
+
+	// Misses needed the full response from chess.com.
+	Misses int64 `json:"misses"`
+
+	Entries int   `json:"entries"`
+	Bytes   int64 `json:"bytes"`
+}
+
+// httpCache is an on-disk cache of chess.com responses. Each entry
+// is kept in its own file named after the hash of its URL.
+type httpCache struct {
+	dir string
+
+	hits          int64
+	revalidations int64
+	misses        int64
+}
+
+func newHTTPCache(dir string) (*httpCache, error) {
+	err := os.MkdirAll(dir, 0755)
+	if err != nil {
+		return nil, fmt.Errorf("could not create http cache directory %s: %w", dir, err)
+	}
+
+	return &httpCache{dir: dir}, nil
+}
+
+func (c *httpCache) path(rawURL string) string {
+	hash := sha1.Sum([]byte(rawURL))
+	return filepath.Join(c.dir, hex.EncodeToString(hash[:])+".json")
+}
+
+// load returns the cached response for rawURL, if any.
+func (c *httpCache) load(rawURL string) (cachedResponse, bool) {
+	fileBytes, err := ioutil.ReadFile(c.path(rawURL))
+	if err != nil {
+		return cachedResponse{}, false
+	}
+
+	cached := cachedResponse{}
+	err = json.Unmarshal(fileBytes, &cached)
+	if err != nil || cached.URL != rawURL {
+		return cachedResponse{}, false
+	}
+
+	return cached, true
+}
+
+// save writes cached to disk, replacing any previous entry atomically.
+func (c *httpCache) save(cached cachedResponse) error {
+	fileBytes, err := json.Marshal(cached)
+	if err != nil {
+		return fmt.Errorf("could not marshal cached response: %w", err)
+	}
+
+	f, err := ioutil.TempFile(c.dir, "tmp-")
+	if err != nil {
+		return fmt.Errorf("could not create cache file: %w", err)
+	}
+
+	_, err = f.Write(fileBytes)
+	closeErr := f.Close()
+	if err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(f.Name())
+		return fmt.Errorf("could not write cache file: %w", err)
+	}
+
+	err = os.Rename(f.Name(), c.path(cached.URL))
+	if err != nil {
+		os.Remove(f.Name())
+		return fmt.Errorf("could not rename cache file: %w", err)
+	}
+
+	return nil
+}
+
+// fresh returns whether cached can be used without asking chess.com.
+func (c *httpCache) fresh(cached cachedResponse, now time.Time) bool {
+	ttl, immutable := cacheTTL(cached.URL, cached.FetchedAt)
+	if immutable {
+		return true
+	}
+
+	return now.Sub(cached.FetchedAt) < ttl
+}
+
+func (c *httpCache) recordHit() {
+	atomic.AddInt64(&c.hits, 1)
+	observeCacheLookup("http", true)
+}
+
+func (c *httpCache) recordRevalidation() {
+	atomic.AddInt64(&c.revalidations, 1)
+	observeCacheLookup("http", true)
+}
+
+func (c *httpCache) recordMiss() {
+	atomic.AddInt64(&c.misses, 1)
+	observeCacheLookup("http", false)
+}
+
+// stats returns the counters of the cache along with its size on disk.
+func (c *httpCache) stats() httpCacheStats {
+	stats := httpCacheStats{
+		Hits:          atomic.LoadInt64(&c.hits),
+		Revalidations: atomic.LoadInt64(&c.revalidations),
+		Misses:        atomic.LoadInt64(&c.misses),
+	}
+
+	files, err := ioutil.ReadDir(c.dir)
+	if err != nil {
+		return stats
+	}
+
+	for _, file := range files {
+		if strings.HasSuffix(file.Name(), ".json") {
+			stats.Entries++
+			stats.Bytes += file.Size()
+		}
+	}
+
+	return stats
+}
+
+// cacheTTL returns how long a response for rawURL fetched at fetchedAt
+// stays fresh. Archives of closed months never change so they are
+// immutable, but only when they were fetched after the month closed:
+// an archive fetched before is missing the rest of the month.
+func cacheTTL(rawURL string, fetchedAt time.Time) (time.Duration, bool) {
+	switch chessComEndpoint(rawURL) {
+	case "games":
+		return currentGamesTTL, false
+	case "archives":
+		return archivesListTTL, false
+	case "monthly_archive":
+		year, month, ok := archiveYearMonth(rawURL)
+		if !ok {
+			return currentMonthTTL, false
+		}
+
+		monthEnd := time.Date(year, time.Month(month)+1, 1, 0, 0, 0, 0, time.UTC)
+		if fetchedAt.After(monthEnd.Add(closedMonthGracePeriod)) {
+			return 0, true
+		}
+
+		return currentMonthTTL, false
+	default:
+		return defaultHTTPCache, false
+	}
+}
+
+// archiveYearMonth returns the year and month of a monthly archive URL
+// such as https://api.chess.com/pub/player/user/games/2021/05.
+func archiveYearMonth(rawURL string) (int, int, bool) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return 0, 0, false
+	}
+
+	urlSplit := strings.Split(strings.TrimSuffix(u.Path, "/"), "/")
+	if len(urlSplit) < 2 {
+		return 0, 0, false
+	}
+
+	year, err := strconv.Atoi(urlSplit[len(urlSplit)-2])
+	if err != nil {
+		return 0, 0, false
+	}
+
+	month, err := strconv.Atoi(urlSplit[len(urlSplit)-1])
+	if err != nil || month < 1 || month > 12 {
+		return 0, 0, false
+	}
+
+	return year, month, true
+}
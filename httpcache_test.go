@@ -0,0 +1,135 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestHTTPCacheFresh(t *testing.T) {
+	const (
+		base           = "https://api.chess.com/pub/player/alice/games"
+		mayArchive     = base + "/2021/05"
+		juneStart      = "2021-06-01T00:00:00Z"
+		afterClose     = "2021-06-03T00:00:00Z"
+		withinGrace    = "2021-06-01T12:00:00Z"
+		midMay         = "2021-05-15T12:00:00Z"
+		longAfterwards = "2022-01-01T00:00:00Z"
+	)
+
+	at := func(value string) time.Time {
+		parsed, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			t.Fatalf("invalid time %q: %s", value, err)
+		}
+		return parsed
+	}
+
+	tests := []struct {
+		name          string
+		url           string
+		fetchedAt     time.Time
+		now           time.Time
+		wantTTL       time.Duration
+		wantImmutable bool
+		wantFresh     bool
+	}{
+		{
+			name:      "current games just fetched",
+			url:       base,
+			fetchedAt: at(midMay),
+			now:       at(midMay).Add(30 * time.Second),
+			wantTTL:   currentGamesTTL,
+			wantFresh: true,
+		},
+		{
+			name:      "current games fetched a while ago",
+			url:       base,
+			fetchedAt: at(midMay),
+			now:       at(midMay).Add(2 * time.Minute),
+			wantTTL:   currentGamesTTL,
+		},
+		{
+			name:      "archives list",
+			url:       base + "/archives",
+			fetchedAt: at(midMay),
+			now:       at(midMay).Add(30 * time.Minute),
+			wantTTL:   archivesListTTL,
+			wantFresh: true,
+		},
+		{
+			name:      "current month just fetched",
+			url:       mayArchive,
+			fetchedAt: at(midMay),
+			now:       at(midMay).Add(time.Minute),
+			wantTTL:   currentMonthTTL,
+			wantFresh: true,
+		},
+		{
+			name:      "current month fetched a while ago",
+			url:       mayArchive,
+			fetchedAt: at(midMay),
+			now:       at(midMay).Add(10 * time.Minute),
+			wantTTL:   currentMonthTTL,
+		},
+		{
+			name:      "fetched mid-month, read after close",
+			url:       mayArchive,
+			fetchedAt: at(midMay),
+			now:       at(longAfterwards),
+			wantTTL:   currentMonthTTL,
+		},
+		{
+			name:      "fetched within the grace period, read after close",
+			url:       mayArchive,
+			fetchedAt: at(withinGrace),
+			now:       at(afterClose),
+			wantTTL:   currentMonthTTL,
+		},
+		{
+			name:      "fetched right when the month ended",
+			url:       mayArchive,
+			fetchedAt: at(juneStart),
+			now:       at(juneStart).Add(time.Minute),
+			wantTTL:   currentMonthTTL,
+			wantFresh: true,
+		},
+		{
+			name:          "fetched after close",
+			url:           mayArchive,
+			fetchedAt:     at(afterClose),
+			now:           at(longAfterwards),
+			wantImmutable: true,
+			wantFresh:     true,
+		},
+		{
+			name:      "unknown month",
+			url:       base + "/2021/13",
+			fetchedAt: at(afterClose),
+			now:       at(longAfterwards),
+			wantTTL:   currentMonthTTL,
+		},
+		{
+			name:      "other endpoint",
+			url:       "https://api.chess.com/pub/player/alice",
+			fetchedAt: at(midMay),
+			now:       at(midMay).Add(time.Minute),
+			wantTTL:   defaultHTTPCache,
+			wantFresh: true,
+		},
+	}
+
+	c := &httpCache{}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ttl, immutable := cacheTTL(tt.url, tt.fetchedAt)
+			if ttl != tt.wantTTL || immutable != tt.wantImmutable {
+				t.Errorf("cacheTTL() = %s, %t, want %s, %t", ttl, immutable, tt.wantTTL, tt.wantImmutable)
+			}
+
+			cached := cachedResponse{URL: tt.url, FetchedAt: tt.fetchedAt}
+			if fresh := c.fresh(cached, tt.now); fresh != tt.wantFresh {
+				t.Errorf("fresh() = %t, want %t", fresh, tt.wantFresh)
+			}
+		})
+	}
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// listenFdsStart is the first file descriptor passed by systemd
+	// when socket activating a service (SD_LISTEN_FDS_START).
+	listenFdsStart = 3
+
+	// launchdSocketName is the name of the socket in the Sockets
+	// dictionary of the launchd plist.
+	launchdSocketName = "Listeners"
+)
+
+// getListener returns the listener the server should accept connections
+// on. A socket inherited from systemd or launchd is used when present,
+// so the service manager can keep it open across restarts. Otherwise
+// addr is bound.
+func getListener(addr string) (net.Listener, error) {
+	listener, err := systemdListener()
+	if err != nil {
+		return nil, fmt.Errorf("could not use systemd socket: %w", err)
+	}
+	if listener != nil {
+		logrus.WithField("addr", listener.Addr()).Info("using socket passed by systemd")
+		return listener, nil
+	}
+
+	listener, err = launchdListener(launchdSocketName)
+	if err != nil {
+		return nil, fmt.Errorf("could not use launchd socket: %w", err)
+	}
+	if listener != nil {
+		logrus.WithField("addr", listener.Addr()).Info("using socket passed by launchd")
+		return listener, nil
+	}
+
+	listener, err = net.Listen("tcp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("could not listen on %s: %w", addr, err)
+	}
+
+	return listener, nil
+}
+
+// systemdListener returns the first socket passed with the systemd
+// socket activation protocol (LISTEN_PID and LISTEN_FDS environment
+// variables), or nil if the process was not socket activated.
+func systemdListener() (net.Listener, error) {
+	pidString := os.Getenv("LISTEN_PID")
+	fdsString := os.Getenv("LISTEN_FDS")
+	if fdsString == "" {
+		return nil, nil
+	}
+
+	// The variables are meant for this process only,
+	// make sure child processes do not pick them up.
+	os.Unsetenv("LISTEN_PID")
+	os.Unsetenv("LISTEN_FDS")
+	os.Unsetenv("LISTEN_FDNAMES")
+
+	if pidString != "" {
+		pid, err := strconv.Atoi(pidString)
+		if err != nil {
+			return nil, fmt.Errorf("invalid LISTEN_PID %q: %w", pidString, err)
+		}
+
+		if pid != os.Getpid() {
+			return nil, nil
+		}
+	}
+
+	fds, err := strconv.Atoi(fdsString)
+	if err != nil {
+		return nil, fmt.Errorf("invalid LISTEN_FDS %q: %w", fdsString, err)
+	}
+
+	if fds < 1 {
+		return nil, nil
+	}
+
+	if fds > 1 {
+		logrus.WithField("fds", fds).Warn("more than one socket passed by systemd, only the first one is used")
+	}
+
+	return fileListener(listenFdsStart, "LISTEN_FD_3")
+}
+
+// fileListener returns a listener for the socket in file descriptor fd.
+func fileListener(fd uintptr, name string) (net.Listener, error) {
+	f := os.NewFile(fd, name)
+	if f == nil {
+		return nil, fmt.Errorf("invalid file descriptor %d", fd)
+	}
+
+	// net.FileListener duplicates the file descriptor,
+	// so the original can be closed.
+	defer f.Close()
+
+	listener, err := net.FileListener(f)
+	if err != nil {
+		return nil, fmt.Errorf("file descriptor %d is not a listening socket: %w", fd, err)
+	}
+
+	return listener, nil
+}
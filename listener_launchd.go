@@ -0,0 +1,52 @@
+//go:build darwin && cgo
+// +build darwin,cgo
+
+package main
+
+/*
+#include <launch.h>
+#include <stdlib.h>
+*/
+import "C"
+
+import (
+	"fmt"
+	"net"
+	"syscall"
+	"unsafe"
+)
+
+// launchdListener returns the socket named name in the Sockets
+// dictionary of the launchd plist, or nil if the process was not
+// started by launchd with such a socket.
+func launchdListener(name string) (net.Listener, error) {
+	cName := C.CString(name)
+	defer C.free(unsafe.Pointer(cName))
+
+	var fds *C.int
+	var count C.size_t
+
+	errno := C.launch_activate_socket(cName, &fds, &count)
+	if errno != 0 {
+		// ESRCH: not managed by launchd, ENOENT: no socket with that name.
+		if syscall.Errno(errno) == syscall.ESRCH || syscall.Errno(errno) == syscall.ENOENT {
+			return nil, nil
+		}
+
+		return nil, fmt.Errorf("launch_activate_socket: %w", syscall.Errno(errno))
+	}
+	defer C.free(unsafe.Pointer(fds))
+
+	if count == 0 {
+		return nil, nil
+	}
+
+	fdSlice := (*[1 << 20]C.int)(unsafe.Pointer(fds))[:count:count]
+
+	// Only the first socket is used, close the others.
+	for _, fd := range fdSlice[1:] {
+		syscall.Close(int(fd))
+	}
+
+	return fileListener(uintptr(fdSlice[0]), "launchd-"+name)
+}
@@ -0,0 +1,169 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// systemdChildEnv is set when the test binary is run by
+// TestGetListenerSystemd as a socket activated child process.
+const systemdChildEnv = "CHESS_CLUB_TEST_SYSTEMD_CHILD"
+
+// unsetListenEnv clears the socket activation environment variables
+// and restores them when the test ends.
+func unsetListenEnv(t *testing.T) {
+	t.Helper()
+
+	old := make(map[string]string)
+	for _, name := range []string{"LISTEN_PID", "LISTEN_FDS", "LISTEN_FDNAMES"} {
+		if value, ok := os.LookupEnv(name); ok {
+			old[name] = value
+		}
+		os.Unsetenv(name)
+	}
+
+	t.Cleanup(func() {
+		for _, name := range []string{"LISTEN_PID", "LISTEN_FDS", "LISTEN_FDNAMES"} {
+			os.Unsetenv(name)
+		}
+		for name, value := range old {
+			os.Setenv(name, value)
+		}
+	})
+}
+
+// TestSystemdChild runs in the child process started by
+// TestGetListenerSystemd. It serves one connection on the listener
+// returned by getListener with the address it listens on.
+func TestSystemdChild(t *testing.T) {
+	if os.Getenv(systemdChildEnv) == "" {
+		t.Skip("only run as the child of TestGetListenerSystemd")
+	}
+
+	// systemd sets LISTEN_PID to the pid of the service it starts.
+	os.Setenv("LISTEN_PID", strconv.Itoa(os.Getpid()))
+
+	listener, err := getListener("127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("getListener() error = %v", err)
+	}
+	defer listener.Close()
+
+	if _, ok := os.LookupEnv("LISTEN_FDS"); ok {
+		t.Errorf("LISTEN_FDS was left in the environment")
+	}
+
+	conn, err := listener.Accept()
+	if err != nil {
+		t.Fatalf("Accept() error = %v", err)
+	}
+	defer conn.Close()
+
+	fmt.Fprintf(conn, "%s\n", listener.Addr())
+}
+
+func TestGetListenerSystemd(t *testing.T) {
+	parent, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("could not listen: %s", err)
+	}
+	defer parent.Close()
+
+	f, err := parent.(*net.TCPListener).File()
+	if err != nil {
+		t.Fatalf("could not get listener file: %s", err)
+	}
+	defer f.Close()
+
+	// The first extra file is fd 3 in the child.
+	cmd := exec.Command(os.Args[0], "-test.run=^TestSystemdChild$", "-test.v")
+	cmd.Env = append(os.Environ(), systemdChildEnv+"=1", "LISTEN_FDS=1")
+	cmd.ExtraFiles = []*os.File{f}
+
+	output := &strings.Builder{}
+	cmd.Stdout = output
+	cmd.Stderr = output
+	if err := cmd.Start(); err != nil {
+		t.Fatalf("could not start child: %s", err)
+	}
+
+	// The child accepts on the socket it inherited, the parent never does.
+	conn, err := net.Dial("tcp", parent.Addr().String())
+	if err != nil {
+		t.Fatalf("could not dial: %s", err)
+	}
+	defer conn.Close()
+
+	line, err := bufio.NewReader(conn).ReadString('\n')
+	if err != nil {
+		t.Errorf("could not read from child: %s", err)
+	}
+
+	if err := cmd.Wait(); err != nil {
+		t.Fatalf("child failed: %s\n%s", err, output)
+	}
+	if !strings.Contains(output.String(), "--- PASS: TestSystemdChild") {
+		t.Fatalf("child did not run:\n%s", output)
+	}
+
+	if got := strings.TrimSpace(line); got != parent.Addr().String() {
+		t.Errorf("child listened on %s, want the socket passed on fd 3 (%s)", got, parent.Addr())
+	}
+}
+
+func TestGetListenerFallback(t *testing.T) {
+	tests := []struct {
+		name string
+		env  map[string]string
+	}{
+		{name: "no fds passed"},
+		{name: "fds passed to another process", env: map[string]string{"LISTEN_PID": "1", "LISTEN_FDS": "1"}},
+		{name: "zero fds", env: map[string]string{"LISTEN_FDS": "0"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			unsetListenEnv(t)
+			for name, value := range tt.env {
+				os.Setenv(name, value)
+			}
+
+			listener, err := getListener("127.0.0.1:0")
+			if err != nil {
+				t.Fatalf("getListener() error = %v", err)
+			}
+			defer listener.Close()
+
+			addr, ok := listener.Addr().(*net.TCPAddr)
+			if !ok || !addr.IP.IsLoopback() || addr.Port == 0 {
+				t.Errorf("getListener() listens on %s, want a port bound on 127.0.0.1", listener.Addr())
+			}
+		})
+	}
+}
+
+func TestGetListenerInvalidEnv(t *testing.T) {
+	tests := []map[string]string{
+		{"LISTEN_FDS": "one"},
+		{"LISTEN_PID": "me", "LISTEN_FDS": "1"},
+	}
+
+	for _, env := range tests {
+		unsetListenEnv(t)
+		for name, value := range env {
+			os.Setenv(name, value)
+		}
+
+		listener, err := getListener("127.0.0.1:0")
+		if err == nil {
+			listener.Close()
+			t.Errorf("getListener() with %v did not return an error", env)
+		}
+	}
+}
@@ -0,0 +1,12 @@
+//go:build !darwin || !cgo
+// +build !darwin !cgo
+
+package main
+
+import "net"
+
+// launchdListener always returns nil, launchd socket activation
+// needs cgo on darwin.
+func launchdListener(name string) (net.Listener, error) {
+	return nil, nil
+}
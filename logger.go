@@ -1,7 +1,9 @@
 package main
 
 import (
+	"context"
 	"net/http"
+	"strconv"
 	"time"
 
 	"github.com/google/uuid"
@@ -33,11 +35,77 @@ func (o *responseObserver) WriteHeader(code int) {
 	o.status = code
 }
 
+// requestIDHeader is the header used to receive and return the request ID.
+const requestIDHeader = "X-Request-ID"
+
+type contextKey string
+
+// requestIDKey is the context key of the request ID.
+const requestIDKey contextKey = "requestID"
+
+// withRequestID returns a copy of ctx carrying requestID.
+func withRequestID(ctx context.Context, requestID string) context.Context {
+	return context.WithValue(ctx, requestIDKey, requestID)
+}
+
+// requestIDFromContext returns the request ID in ctx, if any.
+func requestIDFromContext(ctx context.Context) string {
+	requestID, _ := ctx.Value(requestIDKey).(string)
+	return requestID
+}
+
+// loggerFromContext returns a logger which adds the request ID
+// in ctx to every line.
+func loggerFromContext(ctx context.Context) *logrus.Entry {
+	entry := logrus.NewEntry(logrus.StandardLogger())
+
+	if requestID := requestIDFromContext(ctx); requestID != "" {
+		entry = entry.WithField("requestID", requestID)
+	}
+
+	return entry
+}
+
+// validRequestID returns whether an incoming request ID is safe to
+// reuse in logs and headers.
+func validRequestID(requestID string) bool {
+	if requestID == "" || len(requestID) > 128 {
+		return false
+	}
+
+	for _, c := range requestID {
+		if c < '!' || c > '~' {
+			return false
+		}
+	}
+
+	return true
+}
+
+// withRequestBudget cancels the context of each request once budget
+// has elapsed, so chess.com fetches for it stop.
+func withRequestBudget(inner http.Handler, budget time.Duration) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx, cancel := context.WithTimeout(r.Context(), budget)
+		defer cancel()
+
+		inner.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
 func logger(inner http.Handler, name string) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 
-		requestUUID, _ := uuid.NewRandom()
-		requestID := requestUUID.String()
+		// Reuse the request ID of the caller (a proxy for instance)
+		// so log lines can be correlated across services.
+		requestID := r.Header.Get(requestIDHeader)
+		if !validRequestID(requestID) {
+			requestUUID, _ := uuid.NewRandom()
+			requestID = requestUUID.String()
+		}
+
+		w.Header().Set(requestIDHeader, requestID)
+		r = r.WithContext(withRequestID(r.Context(), requestID))
 
 		fields := logrus.Fields{
 			"requestID": requestID,
@@ -52,6 +120,15 @@ func logger(inner http.Handler, name string) http.Handler {
 		inner.ServeHTTP(o, r)
 		duration := time.Since(start)
 
+		// net/http replies 200 when the handler writes nothing
+		status := o.status
+		if !o.wroteHeader {
+			status = http.StatusOK
+		}
+
+		httpRequestsTotal.WithLabelValues(name, strconv.Itoa(status)).Inc()
+		httpRequestDuration.WithLabelValues(name).Observe(duration.Seconds())
+
 		logrus.WithFields(fields).WithFields(logrus.Fields{
 			"duration": duration,
 			"status":   o.status,
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
+	"github.com/sirupsen/logrus/hooks/test"
+)
+
+// useLogHook records the entries logged by the standard logger
+// until the test ends.
+func useLogHook(t *testing.T) *test.Hook {
+	t.Helper()
+
+	oldHooks := logrus.StandardLogger().ReplaceHooks(make(logrus.LevelHooks))
+	t.Cleanup(func() { logrus.StandardLogger().ReplaceHooks(oldHooks) })
+
+	return test.NewLocal(logrus.StandardLogger())
+}
+
+func TestLoggerRequestID(t *testing.T) {
+	tests := []struct {
+		name     string
+		incoming string
+		wantSame bool
+	}{
+		{name: "valid", incoming: "proxy-42.abc", wantSame: true},
+		{name: "missing"},
+		{name: "with spaces", incoming: "proxy 42"},
+		{name: "with a newline", incoming: "proxy-42\nlevel=error"},
+		{name: "too long", incoming: strings.Repeat("a", 129)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake := newFakeChessCom(t, fakeChessComFixtures, "alice", "bob", "carol")
+			hook := useLogHook(t)
+
+			// The retry is logged by the fetch, away from the handler.
+			fake.setFault("/pub/player/alice/games/2021/05", fakeFault{Status: http.StatusTooManyRequests, RetryAfter: "0", Times: 1})
+
+			req := httptest.NewRequest(http.MethodGet, "/monthgames?cursor=2021-05", nil)
+			if tt.incoming != "" {
+				req.Header.Set(requestIDHeader, tt.incoming)
+			}
+
+			rec := httptest.NewRecorder()
+			logger(http.HandlerFunc(getGamesForMonthHTML), "getGamesForMonthHTML").ServeHTTP(rec, req)
+
+			if rec.Code != http.StatusOK {
+				t.Fatalf("GET /monthgames = %d: %s", rec.Code, rec.Body.String())
+			}
+
+			requestID := rec.Header().Get(requestIDHeader)
+			if tt.wantSame {
+				if requestID != tt.incoming {
+					t.Errorf("response request ID = %q, want the incoming %q", requestID, tt.incoming)
+				}
+			} else if _, err := uuid.Parse(requestID); err != nil {
+				t.Errorf("response request ID = %q, want a new UUID", requestID)
+			}
+
+			messages := map[string]bool{}
+			for _, entry := range hook.AllEntries() {
+				messages[entry.Message] = true
+				if got := entry.Data["requestID"]; got != requestID {
+					t.Errorf("%q logged with request ID %v, want %q", entry.Message, got, requestID)
+				}
+			}
+
+			for _, message := range []string{"request received", "chess.com request failed, retrying", "request completed"} {
+				if !messages[message] {
+					t.Errorf("%q was not logged", message)
+				}
+			}
+		})
+	}
+}
+
+func TestValidRequestID(t *testing.T) {
+	tests := []struct {
+		requestID string
+		want      bool
+	}{
+		{requestID: "", want: false},
+		{requestID: "0f8c5c3e-6c1b-4c53-9d1a-2f0a3f1b8c4d", want: true},
+		{requestID: "Root=1-5759e988-bd862e3fe1be46a994272793", want: true},
+		{requestID: strings.Repeat("a", 128), want: true},
+		{requestID: strings.Repeat("a", 129), want: false},
+		{requestID: "two words", want: false},
+		{requestID: "tab\there", want: false},
+		{requestID: "café", want: false},
+	}
+
+	for _, tt := range tests {
+		if got := validRequestID(tt.requestID); got != tt.want {
+			t.Errorf("validRequestID(%q) = %t, want %t", tt.requestID, got, tt.want)
+		}
+	}
+}
+
+func TestRequestBudget(t *testing.T) {
+	fake := newFakeChessCom(t, fakeChessComFixtures, "alice", "bob", "carol")
+
+	// chess.com never answers for alice's archive.
+	const path = "/pub/player/alice/games/2021/05"
+	fake.setLatency(path, time.Minute)
+
+	const budget = 100 * time.Millisecond
+	handler := withRequestBudget(http.HandlerFunc(getGamesForMonthHTML), budget)
+
+	start := time.Now()
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/monthgames?cursor=2021-05", nil))
+
+	if elapsed := time.Since(start); elapsed > budget+500*time.Millisecond {
+		t.Errorf("handler returned after %s, want about %s", elapsed, budget)
+	}
+	if rec.Code != http.StatusOK {
+		t.Errorf("GET /monthgames = %d: %s", rec.Code, rec.Body.String())
+	}
+
+	// The request to chess.com is cancelled along with the handler.
+	deadline := time.Now().Add(time.Second)
+	for fake.cancelledCount(path) == 0 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if got := fake.cancelledCount(path); got != 1 {
+		t.Errorf("%d requests for alice's archive were cancelled, want 1", got)
+	}
+}
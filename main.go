@@ -2,22 +2,46 @@ package main
 
 import (
 	"context"
+	"flag"
+	"net"
 	"net/http"
 	"os"
 	"os/signal"
 	"syscall"
+	"time"
 
 	"github.com/gorilla/mux"
 	"github.com/sirupsen/logrus"
 )
 
+const (
+	// shutdownGracePeriod is how long outstanding requests are given
+	// to complete on shutdown before their fetches are cancelled.
+	shutdownGracePeriod = 10 * time.Second
+
+	// shutdownCancelPeriod is how long requests are given to return
+	// once their fetches have been cancelled.
+	shutdownCancelPeriod = 5 * time.Second
+)
+
 func main() {
+	runCommand(os.Args[1:])
+}
 
+// newRouter returns the router serving routes and the website assets.
+// Each request gets budget to fetch what it needs from chess.com.
+func newRouter(budget time.Duration) *mux.Router {
 	router := mux.NewRouter().StrictSlash(true)
 
 	for _, r := range routes {
 
-		handler := logger(r.handlerFunc, r.name)
+		var handler http.Handler = r.handlerFunc
+		if r.adminOnly {
+			handler = requireAdmin(handler)
+		}
+
+		handler = withRequestBudget(handler, budget)
+		handler = logger(handler, r.name)
 
 		router.
 			Methods(r.method).
@@ -28,21 +52,47 @@ func main() {
 
 	router.PathPrefix("/website/").Handler(http.StripPrefix("/website/", getAsset("website")))
 
-	port := ":8889"
+	return router
+}
+
+// runServe starts the HTTP server and blocks until a termination
+// signal is received.
+func runServe(args []string) {
+	flags := flag.NewFlagSet("serve", flag.ExitOnError)
+	cfgFlags := addConfigFlags(flags)
+	cfg := loadConfig(flags, cfgFlags, args)
+
+	router := newRouter(time.Duration(cfg.RequestBudget))
+
+	baseCtx, cancelBaseCtx := context.WithCancel(context.Background())
+	defer cancelBaseCtx()
+
 	server := &http.Server{
-		Addr: port,
+		Addr: cfg.ListenAddr,
 		// Good practice to set timeouts to avoid Slowloris attacks.
-		// WriteTimeout: time.Second * 15,
-		// ReadTimeout:  time.Second * 15,
-		// IdleTimeout:  time.Second * 60,
+		WriteTimeout: time.Duration(cfg.WriteTimeout),
+		ReadTimeout:  time.Duration(cfg.ReadTimeout),
+		IdleTimeout:  time.Duration(cfg.IdleTimeout),
 
 		// Pass our instance of gorilla/mux in
 		Handler: router,
+
+		// Every request context derives from baseCtx,
+		// cancelling it stops their chess.com fetches.
+		BaseContext: func(net.Listener) context.Context { return baseCtx },
+	}
+
+	listener, err := getListener(cfg.ListenAddr)
+	if err != nil {
+		logrus.WithError(err).Fatal("failed to start server")
 	}
 
 	go func() {
-		logrus.Infof("server started on port %s", port)
-		logrus.WithError(server.ListenAndServe()).Fatal("failed to start server")
+		logrus.Infof("server started on %s", listener.Addr())
+		err := server.Serve(listener)
+		if err != http.ErrServerClosed {
+			logrus.WithError(err).Fatal("failed to start server")
+		}
 	}()
 
 	// graceful shutdown when termination signals received
@@ -52,8 +102,24 @@ func main() {
 	sig := <-sigquit
 	logrus.WithField("signal", sig).Info("caught interrupt signal, gracefully shutting down server")
 
+	// Give outstanding requests a grace period to complete, then cancel
+	// their chess.com fetches so they return with what they have.
+	graceTimer := time.AfterFunc(shutdownGracePeriod, cancelBaseCtx)
+	defer graceTimer.Stop()
+
 	// shutdown the API server, waiting for any outstanding requests to complete
-	server.Shutdown(context.Background())
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownGracePeriod+shutdownCancelPeriod)
+	defer cancel()
+
+	err = server.Shutdown(shutdownCtx)
+	if err != nil {
+		logrus.WithError(err).Warn("requests still in flight after shutdown timeout")
+	}
+
+	// The game store is written on every add, analyses in batches.
+	err = analyses.save()
+	if err != nil {
+		logrus.WithError(err).Error("could not save analyses")
+	}
 	logrus.Info("graceful server shutdown complete, exiting")
-	os.Exit(0)
 }
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+const (
+	MemberStatusOK     = "ok"
+	MemberStatusStale  = "stale-from-cache"
+	MemberStatusFailed = "failed"
+)
+
+// memberStatus reports whether the games of a club member could be
+// fetched from chess.com, so a member missing from the standings is
+// not mistaken for a member who did not play.
+type memberStatus struct {
+	User   string `json:"user"`
+	Status string `json:"status"`
+
+	// Reason explains a stale or failed status.
+	Reason string `json:"reason,omitempty"`
+
+	// StaleSince is when the cached data shown for a stale member
+	// was fetched from chess.com.
+	StaleSince *time.Time `json:"stale_since,omitempty"`
+}
+
+// staleReport collects the stale responses served to a fetch.
+type staleReport struct {
+	mutex  sync.Mutex
+	since  time.Time
+	reason string
+}
+
+// staleReportKey is the context key of the staleReport.
+const staleReportKey contextKey = "staleReport"
+
+// withStaleReport returns a copy of ctx which records stale responses
+// served by chessComClient in the returned staleReport.
+func withStaleReport(ctx context.Context) (context.Context, *staleReport) {
+	report := &staleReport{}
+	return context.WithValue(ctx, staleReportKey, report), report
+}
+
+// recordStale records in the staleReport of ctx, if any, that a
+// response fetched at since was served because of reason.
+func recordStale(ctx context.Context, since time.Time, reason string) {
+	report, ok := ctx.Value(staleReportKey).(*staleReport)
+	if !ok {
+		return
+	}
+
+	report.mutex.Lock()
+	defer report.mutex.Unlock()
+
+	// Keep the oldest response, it is how stale the data can be.
+	if report.since.IsZero() || since.Before(report.since) {
+		report.since = since
+		report.reason = reason
+	}
+}
+
+// getMemberStatus returns the status of user after a fetch which
+// returned err and recorded its stale responses in report.
+func getMemberStatus(user string, report *staleReport, err error) memberStatus {
+	if err != nil {
+		return memberStatus{
+			User:   user,
+			Status: MemberStatusFailed,
+			Reason: err.Error(),
+		}
+	}
+
+	report.mutex.Lock()
+	defer report.mutex.Unlock()
+
+	if report.since.IsZero() {
+		return memberStatus{
+			User:   user,
+			Status: MemberStatusOK,
+		}
+	}
+
+	since := report.since
+	return memberStatus{
+		User:       user,
+		Status:     MemberStatusStale,
+		Reason:     fmt.Sprintf("chess.com could not be reached (%s), showing games as of %s", report.reason, since.Format("Jan 2 15:04 MST")),
+		StaleSince: &since,
+	}
+}
+
+// hasMemberProblems returns whether any member is not ok.
+func hasMemberProblems(statuses []memberStatus) bool {
+	for _, status := range statuses {
+		if status.Status != MemberStatusOK {
+			return true
+		}
+	}
+
+	return false
+}
+
+// hasFailedMembers returns whether the fetch failed for any member.
+func hasFailedMembers(statuses []memberStatus) bool {
+	for _, status := range statuses {
+		if status.Status == MemberStatusFailed {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+const metricsNamespace = "chess_club"
+
+var (
+	httpRequestsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "http_requests_total",
+		Help:      "HTTP requests served, by route name and status code.",
+	}, []string{"route", "status"})
+
+	httpRequestDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: metricsNamespace,
+		Name:      "http_request_duration_seconds",
+		Help:      "Latency of HTTP requests served, by route name.",
+		Buckets:   []float64{.01, .05, .1, .25, .5, 1, 2.5, 5, 10, 30},
+	}, []string{"route"})
+
+	chessComRequestsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "chesscom_requests_total",
+		Help:      "Requests made to the chess.com API, by endpoint type.",
+	}, []string{"endpoint"})
+
+	chessComRequestErrorsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "chesscom_request_errors_total",
+		Help:      "Failed requests to the chess.com API, by endpoint type.",
+	}, []string{"endpoint"})
+
+	chessComRequestDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: metricsNamespace,
+		Name:      "chesscom_request_duration_seconds",
+		Help:      "Latency of requests to the chess.com API, by endpoint type.",
+		Buckets:   []float64{.05, .1, .25, .5, 1, 2.5, 5, 10},
+	}, []string{"endpoint"})
+
+	chessComRequestsCoalescedTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "chesscom_requests_coalesced_total",
+		Help:      "Requests to the chess.com API which shared a fetch already in flight, by endpoint type.",
+	}, []string{"endpoint"})
+
+	pgnParseFailuresTotal = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "pgn_parse_failures_total",
+		Help:      "PGNs of games fetched from chess.com which could not be parsed.",
+	})
+
+	cacheLookupsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "cache_lookups_total",
+		Help:      "Cache lookups by cache name and result (hit or miss). The hit ratio is hits over all lookups.",
+	}, []string{"cache", "result"})
+
+	chessComRetriesTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "chesscom_retries_total",
+		Help:      "Requests to the chess.com API retried after a failure, by endpoint type.",
+	}, []string{"endpoint"})
+
+	// Games are fetched from chess.com when a page needs them rather
+	// than by a poller, so the lag behind chess.com is the age of the
+	// data pages are built from: 0 for a response just fetched, the
+	// time since it was fetched for a cached or a stale copy.
+	chessComDataAge = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: metricsNamespace,
+		Name:      "chesscom_data_age_seconds",
+		Help:      "Age of the chess.com data served, by endpoint type.",
+		Buckets:   []float64{1, 10, 60, 300, 900, 3600, 6 * 3600, 24 * 3600, 7 * 24 * 3600},
+	}, []string{"endpoint"})
+)
+
+// chessComEndpoint returns the endpoint type of a chess.com API URL
+// to be used as a metric label: games, archives or monthly_archive.
+func chessComEndpoint(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return "unknown"
+	}
+
+	path := strings.TrimSuffix(u.Path, "/")
+	switch {
+	case strings.HasSuffix(path, "/games/archives"):
+		return "archives"
+	case strings.HasSuffix(path, "/games"):
+		return "games"
+	case strings.Contains(path, "/games/"):
+		return "monthly_archive"
+	default:
+		return "unknown"
+	}
+}
+
+// observeChessComRequest records the metrics of one chess.com request.
+func observeChessComRequest(rawURL string, duration time.Duration, err error) {
+	endpoint := chessComEndpoint(rawURL)
+
+	chessComRequestsTotal.WithLabelValues(endpoint).Inc()
+	chessComRequestDuration.WithLabelValues(endpoint).Observe(duration.Seconds())
+
+	if err != nil {
+		chessComRequestErrorsTotal.WithLabelValues(endpoint).Inc()
+	}
+}
+
+// observeChessComDataAge records the age of chess.com data
+// fetched at fetchedAt when it is served.
+func observeChessComDataAge(rawURL string, fetchedAt time.Time) {
+	chessComDataAge.WithLabelValues(chessComEndpoint(rawURL)).Observe(time.Since(fetchedAt).Seconds())
+}
+
+// observeCacheLookup records a hit or a miss in the named cache.
+func observeCacheLookup(cache string, hit bool) {
+	result := "miss"
+	if hit {
+		result = "hit"
+	}
+
+	cacheLookupsTotal.WithLabelValues(cache, result).Inc()
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// scrapeMetric returns the value of the sample name with labels, such
+// as `{endpoint="games"}`, served by the metrics handler, 0 if there
+// is none yet.
+func scrapeMetric(t *testing.T, name, labels string) float64 {
+	t.Helper()
+
+	rec := httptest.NewRecorder()
+	promhttp.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("GET /metrics = %d: %s", rec.Code, rec.Body.String())
+	}
+
+	scanner := bufio.NewScanner(rec.Body)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if !strings.HasPrefix(line, name+labels+" ") {
+			continue
+		}
+
+		value, err := strconv.ParseFloat(strings.TrimPrefix(line, name+labels+" "), 64)
+		if err != nil {
+			t.Fatalf("invalid sample %q: %s", line, err)
+		}
+		return value
+	}
+
+	return 0
+}
+
+// unparsableArchive returns the fixture archive at path with
+// the PGN of every game replaced by one which cannot be parsed.
+func unparsableArchive(t *testing.T, path string) string {
+	t.Helper()
+
+	fileBytes, err := ioutil.ReadFile(fakeChessComFixtures + "/" + path)
+	if err != nil {
+		t.Fatalf("could not read fixture: %s", err)
+	}
+
+	archive := map[string][]map[string]interface{}{}
+	err = json.Unmarshal(fileBytes, &archive)
+	if err != nil {
+		t.Fatalf("could not unmarshal fixture: %s", err)
+	}
+	for _, game := range archive["games"] {
+		game["pgn"] = "1. e4 zz9"
+	}
+
+	body, err := json.Marshal(archive)
+	if err != nil {
+		t.Fatalf("could not marshal archive: %s", err)
+	}
+
+	return string(body)
+}
+
+func TestChessComMetrics(t *testing.T) {
+	fake := newFakeChessCom(t, fakeChessComFixtures, "alice", "bob", "carol")
+	useParseFailureLog(t)
+
+	// alice's archive is rate limited once, bob's has games
+	// which cannot be parsed.
+	fake.setFault("/pub/player/alice/games/2021/05", fakeFault{Status: http.StatusTooManyRequests, RetryAfter: "0", Times: 1})
+	fake.setFault("/pub/player/bob/games/2021/05", fakeFault{Body: unparsableArchive(t, "bob/2021/05.json")})
+
+	const archive = `{endpoint="monthly_archive"}`
+	requests := scrapeMetric(t, "chess_club_chesscom_requests_total", archive)
+	requestErrors := scrapeMetric(t, "chess_club_chesscom_request_errors_total", archive)
+	retries := scrapeMetric(t, "chess_club_chesscom_retries_total", archive)
+	parseFailures := scrapeMetric(t, "chess_club_pgn_parse_failures_total", "")
+	dataAges := scrapeMetric(t, "chess_club_chesscom_data_age_seconds_count", archive)
+
+	getMonthGames(t, "cursor=2021-05")
+
+	archiveRequests := fake.requestCount("/pub/player/alice/games/2021/05") + fake.requestCount("/pub/player/bob/games/2021/05")
+
+	if got := scrapeMetric(t, "chess_club_chesscom_requests_total", archive) - requests; got != float64(archiveRequests) {
+		t.Errorf("monthly archive requests went up by %g, want %d", got, archiveRequests)
+	}
+	if got := scrapeMetric(t, "chess_club_chesscom_request_errors_total", archive) - requestErrors; got != 1 {
+		t.Errorf("monthly archive request errors went up by %g, want 1", got)
+	}
+	if got := scrapeMetric(t, "chess_club_chesscom_retries_total", archive) - retries; got != 1 {
+		t.Errorf("monthly archive retries went up by %g, want 1", got)
+	}
+	if got := scrapeMetric(t, "chess_club_pgn_parse_failures_total", "") - parseFailures; got < 1 {
+		t.Errorf("pgn parse failures went up by %g, want at least 1", got)
+	}
+	if got := scrapeMetric(t, "chess_club_chesscom_data_age_seconds_count", archive) - dataAges; got != 2 {
+		t.Errorf("%g monthly archives were served, want 2", got)
+	}
+}
+
+func TestMetricsRequireAdmin(t *testing.T) {
+	newFakeChessCom(t, fakeChessComFixtures, "alice", "bob", "carol")
+
+	// Disabled without an admin password.
+	if rec := serveRouter(http.MethodGet, "/metrics", ""); rec.Code != http.StatusForbidden {
+		t.Errorf("GET /metrics without an admin password configured = %d, want %d", rec.Code, http.StatusForbidden)
+	}
+
+	useAdminPassword(t, "secret")
+
+	for _, password := range []string{"", "wrong"} {
+		if rec := serveRouter(http.MethodGet, "/metrics", password); rec.Code != http.StatusUnauthorized {
+			t.Errorf("GET /metrics with password %q = %d, want %d", password, rec.Code, http.StatusUnauthorized)
+		}
+	}
+
+	rec := serveRouter(http.MethodGet, "/metrics", "secret")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("GET /metrics as the admin = %d: %s", rec.Code, rec.Body.String())
+	}
+	if !strings.Contains(rec.Body.String(), "chess_club_http_requests_total") {
+		t.Errorf("metrics do not have the HTTP request counts")
+	}
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+// monthGroupCacheTTL is how long an assembled month is reused before
+// it is built again from chess.com and the game store.
+const monthGroupCacheTTL = 30 * time.Second
+
+// monthGroupResult is what getFinishedGamesForUsersForYearMonth returns.
+type monthGroupResult struct {
+	// group is nil when there are no games between users.
+	group *gameGroup
+
+	memberStatuses []memberStatus
+}
+
+type monthGroupCacheEntry struct {
+	result    monthGroupResult
+	expiresAt time.Time
+}
+
+// monthGroupCache is a short-lived in memory cache of assembled months,
+// so page loads close together do not rebuild the same month.
+type monthGroupCache struct {
+	mutex   sync.Mutex
+	entries map[string]monthGroupCacheEntry
+}
+
+var monthGroups = &monthGroupCache{
+	entries: make(map[string]monthGroupCacheEntry),
+}
+
+func monthGroupKey(users []string, year, month int, onlineOnly bool) string {
+	return fmt.Sprintf("%04d%02d/%t/%s", year, month, onlineOnly, strings.ToLower(strings.Join(users, ",")))
+}
+
+// get returns the cached result for key if it has not expired.
+func (c *monthGroupCache) get(key string) (monthGroupResult, bool) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	entry, ok := c.entries[key]
+	if !ok || time.Now().After(entry.expiresAt) {
+		observeCacheLookup("month", false)
+		return monthGroupResult{}, false
+	}
+
+	observeCacheLookup("month", true)
+	return entry.result, true
+}
+
+// set caches result under key, dropping expired entries.
+func (c *monthGroupCache) set(key string, result monthGroupResult) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	now := time.Now()
+	for k, entry := range c.entries {
+		if now.After(entry.expiresAt) {
+			delete(c.entries, k)
+		}
+	}
+
+	c.entries[key] = monthGroupCacheEntry{
+		result:    result,
+		expiresAt: now.Add(monthGroupCacheTTL),
+	}
+}
+
+// clear drops every cached month. It is called when games are added
+// to the game store so they show up straight away.
+func (c *monthGroupCache) clear() {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.entries = make(map[string]monthGroupCacheEntry)
+}
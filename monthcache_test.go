@@ -0,0 +1,127 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestChessComClientSharesConcurrentFetches(t *testing.T) {
+	fake := newFakeChessCom(t, fakeChessComFixtures, "alice", "bob", "carol")
+
+	const path = "/pub/player/alice/games/2021/05"
+	fake.setLatency(path, 100*time.Millisecond)
+
+	const callers = 10
+	bodies := make([]string, callers)
+
+	var wg sync.WaitGroup
+	for i := 0; i < callers; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+
+			body, err := chessComClient.get(context.Background(), chessComBaseURL+path)
+			if err != nil {
+				t.Errorf("get() error = %v", err)
+				return
+			}
+			bodies[i] = string(body)
+		}(i)
+	}
+	wg.Wait()
+
+	if got := fake.requestCount(path); got != 1 {
+		t.Errorf("%d concurrent callers made %d requests, want 1", callers, got)
+	}
+
+	for i, body := range bodies {
+		if body == "" || body != bodies[0] {
+			t.Errorf("caller %d got a different body", i)
+		}
+	}
+
+	// Once the fetch is done, the next call fetches again.
+	if _, err := chessComClient.get(context.Background(), chessComBaseURL+path); err != nil {
+		t.Fatalf("get() error = %v", err)
+	}
+	if got := fake.requestCount(path); got != 2 {
+		t.Errorf("archive was requested %d times after a later call, want 2", got)
+	}
+}
+
+func TestChessComClientCallerCancelDoesNotCancelSharedFetch(t *testing.T) {
+	fake := newFakeChessCom(t, fakeChessComFixtures, "alice", "bob", "carol")
+
+	const path = "/pub/player/alice/games/2021/05"
+	fake.setLatency(path, 100*time.Millisecond)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	done := make(chan error)
+	go func() {
+		_, err := chessComClient.get(context.Background(), chessComBaseURL+path)
+		done <- err
+	}()
+
+	if _, err := chessComClient.get(ctx, chessComBaseURL+path); err == nil {
+		t.Errorf("get() with a cancelled context did not return an error")
+	}
+
+	if err := <-done; err != nil {
+		t.Errorf("get() sharing the fetch error = %v", err)
+	}
+	if got := fake.requestCount(path); got != 1 {
+		t.Errorf("archive was requested %d times, want 1", got)
+	}
+}
+
+func TestMonthGroupCache(t *testing.T) {
+	fake := newFakeChessCom(t, fakeChessComFixtures, "alice", "bob", "carol")
+
+	const path = "/pub/player/alice/games/2021/05"
+
+	first := getMonthGames(t, "cursor=2021-05")
+	requests := fake.requestCount(path)
+	if requests != 1 {
+		t.Fatalf("archive was requested %d times, want 1", requests)
+	}
+
+	// The assembled month is reused.
+	second := getMonthGames(t, "cursor=2021-05")
+	if got := fake.requestCount(path); got != requests {
+		t.Errorf("cached month requested the archive again (%d requests, want %d)", got, requests)
+	}
+	if second.HTML != first.HTML {
+		t.Errorf("cached month renders differently")
+	}
+
+	// Clearing the cache rebuilds the month.
+	monthGroups.clear()
+	getMonthGames(t, "cursor=2021-05")
+	if got := fake.requestCount(path); got != requests+1 {
+		t.Errorf("archive was requested %d times after clear(), want %d", got, requests+1)
+	}
+
+	// Adding a game to the store clears the cache so it shows up straight away.
+	_, err := addOTBGame(otbGame{
+		White:  "carol",
+		Black:  "alice",
+		Date:   "2021-05-20",
+		Result: PgnResultBlackWin,
+	}, club.Members)
+	if err != nil {
+		t.Fatalf("addOTBGame() error = %v", err)
+	}
+
+	third := getMonthGames(t, "cursor=2021-05")
+	if got := fake.requestCount(path); got != requests+2 {
+		t.Errorf("archive was requested %d times after adding a game, want %d", got, requests+2)
+	}
+	if strings.Count(third.HTML, "w3-third") != strings.Count(first.HTML, "w3-third")+1 {
+		t.Errorf("month does not show the game added to the store")
+	}
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"context"
+	"sync"
+)
+
+// monthIndex knows, from the chess.com archive listings of the club
+// members and the game store, which months may have games between
+// members and which members have games in each of them, so only
+// their archives are fetched.
+type monthIndex struct {
+	// archiveURLs maps a "YYYYMM" month to the members with a chess.com
+	// archive for it and the URL of that archive.
+	archiveURLs map[string]map[string]string
+
+	// archiveYearMonthsByUser has the archive months of each member.
+	archiveYearMonthsByUser map[string][]string
+
+	storeYearMonths []string
+
+	// memberStatuses has the status of the archive listing of each
+	// member, in the order of the users the index was built for.
+	memberStatuses []memberStatus
+}
+
+// getMonthIndex builds the month index of users. Archive listings
+// are fetched through chessComClient, so they are usually cached.
+func getMonthIndex(ctx context.Context, users []string, onlineOnly bool) *monthIndex {
+	index := &monthIndex{
+		archiveURLs:             make(map[string]map[string]string),
+		archiveYearMonthsByUser: make(map[string][]string),
+		storeYearMonths:         store.yearMonths(onlineOnly),
+		memberStatuses:          make([]memberStatus, len(users)),
+	}
+
+	wg := sync.WaitGroup{}
+	mutex := sync.Mutex{}
+	for i, user := range users {
+		wg.Add(1)
+
+		go func(i int, u string) {
+			defer wg.Done()
+			userCtx, report := withStaleReport(ctx)
+			archives, err := getUserArchivalURLs(userCtx, u)
+			index.memberStatuses[i] = getMemberStatus(u, report, err)
+			if err != nil {
+				loggerFromContext(ctx).WithError(err).WithField("user", u).Warn("could not get archive months")
+				return
+			}
+
+			mutex.Lock()
+			defer mutex.Unlock()
+
+			for _, archiveURL := range archives.Archives {
+				year, month, ok := archiveYearMonth(archiveURL)
+				if !ok {
+					continue
+				}
+
+				yearMonth := yearMonthString(year, month)
+				if index.archiveURLs[yearMonth] == nil {
+					index.archiveURLs[yearMonth] = make(map[string]string)
+				}
+				index.archiveURLs[yearMonth][u] = archiveURL
+				index.archiveYearMonthsByUser[u] = append(index.archiveYearMonthsByUser[u], yearMonth)
+			}
+		}(i, user)
+	}
+
+	wg.Wait()
+
+	return index
+}
+
+// yearMonths returns the months up to yearMonth which may have games
+// between members, most recent first. See clubYearMonths.
+func (idx *monthIndex) yearMonths(yearMonth string) []string {
+	return clubYearMonths(idx.archiveYearMonthsByUser, idx.storeYearMonths, yearMonth)
+}
+
+// membersToFetch returns the members whose archive for yearMonth must
+// be fetched to get every game between members that month, in users
+// order, and the member who can be left out.
+//
+// A game between two members is in both their archives, so with n
+// members having an archive, fetching n-1 of them finds every game.
+// The spare member is only fetched if another one fails, in which
+// case no game is missing if only one did.
+func (idx *monthIndex) membersToFetch(users []string, yearMonth string) ([]string, string) {
+	members := []string{}
+	for _, user := range users {
+		if _, ok := idx.archiveURLs[yearMonth][user]; ok {
+			members = append(members, user)
+		}
+	}
+
+	if len(members) < 2 {
+		// A lone member's archive cannot have games with other members.
+		return []string{}, ""
+	}
+
+	return members[:len(members)-1], members[len(members)-1]
+}
+
+// archiveURL returns the URL of the archive of user for yearMonth.
+func (idx *monthIndex) archiveURL(user, yearMonth string) string {
+	return idx.archiveURLs[yearMonth][user]
+}
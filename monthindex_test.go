@@ -0,0 +1,37 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestMonthIndexMembersToFetch(t *testing.T) {
+	index := &monthIndex{
+		archiveURLs: map[string]map[string]string{
+			"202105": {"alice": "a/2021/05", "bob": "b/2021/05", "carol": "c/2021/05"},
+			"202104": {"alice": "a/2021/04", "carol": "c/2021/04"},
+			"202103": {"bob": "b/2021/03"},
+		},
+	}
+	users := []string{"alice", "bob", "carol"}
+
+	tests := []struct {
+		yearMonth   string
+		wantMembers []string
+		wantSpare   string
+	}{
+		{yearMonth: "202105", wantMembers: []string{"alice", "bob"}, wantSpare: "carol"},
+		{yearMonth: "202104", wantMembers: []string{"alice"}, wantSpare: "carol"},
+		{yearMonth: "202103", wantMembers: []string{}, wantSpare: ""},
+		{yearMonth: "202102", wantMembers: []string{}, wantSpare: ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.yearMonth, func(t *testing.T) {
+			members, spare := index.membersToFetch(users, tt.yearMonth)
+			if !reflect.DeepEqual(members, tt.wantMembers) || spare != tt.wantSpare {
+				t.Errorf("membersToFetch(%q) = %v, %q, want %v, %q", tt.yearMonth, members, spare, tt.wantMembers, tt.wantSpare)
+			}
+		})
+	}
+}
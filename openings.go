@@ -0,0 +1,335 @@
+package main
+
+import (
+	"net/url"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/notnil/chess"
+)
+
+const (
+	// openingTreePlies is how many moves of every game
+	// the opening tree is built from.
+	openingTreePlies = 12
+
+	// openingExamples is how many games, most recent first,
+	// are linked from each move of the opening tree.
+	openingExamples = 3
+
+	// openingsPerPlayer is how many openings are listed
+	// for each player and color.
+	openingsPerPlayer = 10
+)
+
+// openingRecord is the score of one side in the games
+// played with an opening.
+type openingRecord struct {
+	ECO  string
+	Name string
+
+	// URL is the chess.com page of the opening, if known.
+	URL string
+
+	Games  int
+	Wins   int
+	Losses int
+	Draws  int
+
+	// Score is the percentage of the points won.
+	Score float64
+}
+
+// add adds a game won, lost or drawn to r.
+func (r *openingRecord) add(win, loss, draw int) {
+	r.Games++
+	r.Wins += win
+	r.Losses += loss
+	r.Draws += draw
+	r.Score = 100 * (float64(r.Wins) + float64(r.Draws)/2) / float64(r.Games)
+}
+
+// playerOpenings are the openings played by Player with each color.
+type playerOpenings struct {
+	Player string
+	White  []openingRecord
+	Black  []openingRecord
+}
+
+// openingNode is a move of the opening tree along with
+// the results of the games which went through it.
+type openingNode struct {
+	// Move is empty for the starting position. Line is every
+	// move from the starting position up to Move, space separated.
+	Move string
+	Line string
+
+	Games     int
+	WhiteWins int
+	BlackWins int
+	Draws     int
+
+	// Examples are the IDs of the most recent games
+	// which went through the move.
+	Examples []string
+
+	// Children are the moves played next, most played first.
+	Children []*openingNode
+}
+
+// child returns the child of n for move, adding it if needed.
+func (n *openingNode) child(move string) *openingNode {
+	for _, child := range n.Children {
+		if child.Move == move {
+			return child
+		}
+	}
+
+	line := move
+	if n.Line != "" {
+		line = n.Line + " " + move
+	}
+
+	child := &openingNode{Move: move, Line: line}
+	n.Children = append(n.Children, child)
+
+	return child
+}
+
+// add adds the result of game to n.
+func (n *openingNode) add(game chessGame) {
+	n.Games++
+	switch game.PgnParsed.Result {
+	case PgnResultWhiteWin:
+		n.WhiteWins++
+	case PgnResultBlackWin:
+		n.BlackWins++
+	case PgnResultDraw:
+		n.Draws++
+	}
+
+	if len(n.Examples) < openingExamples {
+		n.Examples = append(n.Examples, game.URL)
+	}
+}
+
+// sortChildren orders the children of n and their own children
+// by the number of games played, then by move.
+func (n *openingNode) sortChildren() {
+	sort.Slice(n.Children, func(i, j int) bool {
+		if n.Children[i].Games != n.Children[j].Games {
+			return n.Children[i].Games > n.Children[j].Games
+		}
+		return n.Children[i].Move < n.Children[j].Move
+	})
+
+	for _, child := range n.Children {
+		child.sortChildren()
+	}
+}
+
+// find returns the nodes from n down to the end of line,
+// nil if no game went through line.
+func (n *openingNode) find(line []string) []*openingNode {
+	nodes := []*openingNode{n}
+	for _, move := range line {
+		var next *openingNode
+		for _, child := range nodes[len(nodes)-1].Children {
+			if child.Move == move {
+				next = child
+			}
+		}
+
+		if next == nil {
+			return nil
+		}
+		nodes = append(nodes, next)
+	}
+
+	return nodes
+}
+
+// openingsReport has the openings played in club games.
+type openingsReport struct {
+	// Club has every opening with its score for White,
+	// most played first.
+	Club    []openingRecord
+	Players []playerOpenings
+	Tree    *openingNode
+}
+
+// openingNameFromURL returns the name of the opening of a chess.com
+// opening page, such as "Italian Game Two Knights Defense" for
+// https://www.chess.com/openings/Italian-Game-Two-Knights-Defense-4.Ng5.
+// The moves some pages end with are left out.
+func openingNameFromURL(openingURL string) string {
+	parsedURL, err := url.Parse(openingURL)
+	if err != nil || parsedURL.Path == "" {
+		return ""
+	}
+
+	words := []string{}
+	for _, word := range strings.Split(path.Base(parsedURL.Path), "-") {
+		if word == "" {
+			continue
+		}
+		if word[0] >= '0' && word[0] <= '9' {
+			break
+		}
+		words = append(words, word)
+	}
+
+	return strings.Join(words, " ")
+}
+
+// openingKey identifies the opening of a game, empty
+// when the game has neither an ECO code nor an opening name.
+func openingKey(game chessGame) string {
+	if game.PgnParsed.ECO == "" && game.PgnParsed.Opening == "" {
+		return ""
+	}
+
+	return game.PgnParsed.ECO + "|" + game.PgnParsed.Opening
+}
+
+// sortOpeningRecords orders records by the number of games,
+// then score, then ECO code and name.
+func sortOpeningRecords(records []openingRecord) {
+	sort.Slice(records, func(i, j int) bool {
+		if records[i].Games != records[j].Games {
+			return records[i].Games > records[j].Games
+		}
+		if records[i].Score != records[j].Score {
+			return records[i].Score > records[j].Score
+		}
+		if records[i].ECO != records[j].ECO {
+			return records[i].ECO < records[j].ECO
+		}
+		return records[i].Name < records[j].Name
+	})
+}
+
+// openingRecordsSlice returns the records of recordMap sorted
+// by sortOpeningRecords, keeping the first max if max is not 0.
+func openingRecordsSlice(recordMap map[string]openingRecord, max int) []openingRecord {
+	records := make([]openingRecord, 0, len(recordMap))
+	for _, record := range recordMap {
+		records = append(records, record)
+	}
+
+	sortOpeningRecords(records)
+
+	if max > 0 && len(records) > max {
+		records = records[:max]
+	}
+
+	return records
+}
+
+// getOpeningsReport returns the openings played in the finished
+// games between users, and the tree of their first moves.
+func getOpeningsReport(users []string, games []chessGame) openingsReport {
+	// Games are counted once even if they come from both players.
+	gameIDMap := make(map[string]struct{})
+	clubGames := []chessGame{}
+	for _, game := range games {
+		if _, ok := gameIDMap[game.URL]; ok {
+			continue
+		}
+		gameIDMap[game.URL] = struct{}{}
+
+		if isClubGame(users, game) && game.PgnParsed.Result != PgnResultInProgress {
+			clubGames = append(clubGames, game)
+		}
+	}
+
+	// Most recent first, so the most recent games are the examples.
+	sort.Stable(chessGamesByEndTimeDesc(clubGames))
+
+	club := make(map[string]openingRecord)
+	whiteRecords := make(map[string]map[string]openingRecord)
+	blackRecords := make(map[string]map[string]openingRecord)
+	for _, user := range users {
+		whiteRecords[strings.ToLower(user)] = make(map[string]openingRecord)
+		blackRecords[strings.ToLower(user)] = make(map[string]openingRecord)
+	}
+
+	tree := &openingNode{}
+	startingPosition := chess.StartingPosition().String()
+
+	for _, game := range clubGames {
+		whiteWin, blackWin, draw := 0, 0, 0
+		switch game.PgnParsed.Result {
+		case PgnResultWhiteWin:
+			whiteWin = 1
+		case PgnResultBlackWin:
+			blackWin = 1
+		case PgnResultDraw:
+			draw = 1
+		}
+
+		if key := openingKey(game); key != "" {
+			record := func(records map[string]openingRecord, win, loss int) {
+				r, ok := records[key]
+				if !ok {
+					r = openingRecord{
+						ECO:  game.PgnParsed.ECO,
+						Name: game.PgnParsed.Opening,
+						URL:  game.PgnParsed.ECOUrl,
+					}
+				}
+				r.add(win, loss, draw)
+				records[key] = r
+			}
+
+			record(club, whiteWin, blackWin)
+			record(whiteRecords[strings.ToLower(game.PgnParsed.White)], whiteWin, blackWin)
+			record(blackRecords[strings.ToLower(game.PgnParsed.Black)], blackWin, whiteWin)
+		}
+
+		// Games set up from another position are left out of the tree.
+		positions := game.ChessGame.Positions()
+		if positions[0].String() != startingPosition {
+			continue
+		}
+
+		node := tree
+		node.add(game)
+		for i, move := range game.ChessGame.Moves() {
+			if i == openingTreePlies {
+				break
+			}
+
+			node = node.child(chess.AlgebraicNotation{}.Encode(positions[i], move))
+			node.add(game)
+		}
+	}
+
+	tree.sortChildren()
+
+	report := openingsReport{
+		Club: openingRecordsSlice(club, 0),
+		Tree: tree,
+	}
+
+	for _, user := range users {
+		white := openingRecordsSlice(whiteRecords[strings.ToLower(user)], openingsPerPlayer)
+		black := openingRecordsSlice(blackRecords[strings.ToLower(user)], openingsPerPlayer)
+		if len(white) == 0 && len(black) == 0 {
+			continue
+		}
+
+		report.Players = append(report.Players, playerOpenings{
+			Player: user,
+			White:  white,
+			Black:  black,
+		})
+	}
+
+	sort.Slice(report.Players, func(i, j int) bool {
+		return strings.ToLower(report.Players[i].Player) < strings.ToLower(report.Players[j].Player)
+	})
+
+	return report
+}
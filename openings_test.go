@@ -0,0 +1,118 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestOpeningNameFromURL(t *testing.T) {
+	tests := []struct {
+		url  string
+		want string
+	}{
+		{url: "https://www.chess.com/openings/Italian-Game", want: "Italian Game"},
+		{url: "https://www.chess.com/openings/Italian-Game-Two-Knights-Defense-4.Ng5", want: "Italian Game Two Knights Defense"},
+		{url: "https://www.chess.com/openings/Sicilian-Defense-Najdorf-Variation-6.Be3-e5-7.Nb3", want: "Sicilian Defense Najdorf Variation"},
+		{url: "", want: ""},
+	}
+
+	for _, tt := range tests {
+		if got := openingNameFromURL(tt.url); got != tt.want {
+			t.Errorf("openingNameFromURL(%q) = %q, want %q", tt.url, got, tt.want)
+		}
+	}
+}
+
+func TestGetOpeningsReport(t *testing.T) {
+	pgns := []string{
+		`[White "alice"]
+[Black "bob"]
+[Date "2021.05.01"]
+[Result "1-0"]
+[ECO "C50"]
+[Opening "Italian Game"]
+
+1. e4 e5 2. Nf3 Nc6 3. Bc4 1-0`,
+		`[White "alice"]
+[Black "bob"]
+[Date "2021.05.02"]
+[Result "1/2-1/2"]
+[ECO "C50"]
+[Opening "Italian Game"]
+
+1. e4 e5 2. Nf3 Nc6 3. Bc4 Bc5 1/2-1/2`,
+		`[White "bob"]
+[Black "alice"]
+[Date "2021.05.03"]
+[Result "0-1"]
+[ECO "B20"]
+[ECOUrl "https://www.chess.com/openings/Sicilian-Defense"]
+
+1. e4 c5 0-1`,
+		// Games against players outside the club are left out.
+		`[White "alice"]
+[Black "mallory"]
+[Date "2021.05.04"]
+[Result "1-0"]
+[ECO "A00"]
+
+1. g4 1-0`,
+	}
+
+	games := []chessGame{}
+	for i, pgn := range pgns {
+		game, err := getChessGame(pgn)
+		if err != nil {
+			t.Fatalf("could not parse pgn %d: %s", i, err)
+		}
+		game.URL = string(rune('a' + i))
+		games = append(games, game)
+	}
+
+	report := getOpeningsReport([]string{"alice", "bob", "carol"}, games)
+
+	italian := openingRecord{ECO: "C50", Name: "Italian Game", Games: 2, Wins: 1, Draws: 1, Score: 75}
+	sicilian := openingRecord{ECO: "B20", Name: "Sicilian Defense", URL: "https://www.chess.com/openings/Sicilian-Defense", Games: 1, Losses: 1, Score: 0}
+	if want := []openingRecord{italian, sicilian}; !reflect.DeepEqual(report.Club, want) {
+		t.Errorf("club openings = %+v, want %+v", report.Club, want)
+	}
+
+	sicilianForBlack := sicilian
+	sicilianForBlack.Wins, sicilianForBlack.Losses, sicilianForBlack.Score = 1, 0, 100
+	italianForBlack := italian
+	italianForBlack.Wins, italianForBlack.Losses, italianForBlack.Score = 0, 1, 25
+
+	wantPlayers := []playerOpenings{
+		{Player: "alice", White: []openingRecord{italian}, Black: []openingRecord{sicilianForBlack}},
+		{Player: "bob", White: []openingRecord{sicilian}, Black: []openingRecord{italianForBlack}},
+	}
+	if !reflect.DeepEqual(report.Players, wantPlayers) {
+		t.Errorf("player openings = %+v, want %+v", report.Players, wantPlayers)
+	}
+
+	if report.Tree.Games != 3 {
+		t.Errorf("tree has %d games, want 3", report.Tree.Games)
+	}
+
+	line := report.Tree.find([]string{"e4", "e5", "Nf3"})
+	if line == nil {
+		t.Fatalf("tree has no 1. e4 e5 2. Nf3")
+	}
+
+	nf3 := line[len(line)-1]
+	if nf3.Line != "e4 e5 Nf3" || nf3.Games != 2 || nf3.WhiteWins != 1 || nf3.Draws != 1 {
+		t.Errorf("Nf3 = %+v, want 2 games with a White win and a draw", nf3)
+	}
+	if !reflect.DeepEqual(nf3.Examples, []string{"b", "a"}) {
+		t.Errorf("Nf3 examples = %v, want the most recent game first", nf3.Examples)
+	}
+
+	e4 := report.Tree.Children[0]
+	if e4.Move != "e4" || len(e4.Children) != 2 || e4.Children[0].Move != "e5" {
+		t.Errorf("e4 = %+v, want e5 then c5", e4)
+	}
+
+	if report.Tree.find([]string{"d4"}) != nil {
+		t.Errorf("tree has a line no game went through")
+	}
+}
@@ -0,0 +1,175 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/notnil/chess"
+)
+
+// otbGame is an over the board game between two members of the club.
+type otbGame struct {
+	White  string `json:"white"`
+	Black  string `json:"black"`
+	Date   string `json:"date"`
+	Result string `json:"result"`
+
+	// Moves is optional move text in standard algebraic notation.
+	Moves string `json:"moves"`
+}
+
+// pgnResults are the results move text can end with.
+var pgnResults = []string{PgnResultWhiteWin, PgnResultBlackWin, PgnResultDraw, PgnResultInProgress}
+
+// splitMovesResult returns moves without the result
+// they may end with, and that result.
+func splitMovesResult(moves string) (string, string) {
+	moves = strings.TrimSpace(moves)
+
+	fields := strings.Fields(moves)
+	if len(fields) == 0 {
+		return "", ""
+	}
+
+	last := fields[len(fields)-1]
+	for _, result := range pgnResults {
+		if last == result {
+			return strings.TrimSpace(strings.TrimSuffix(moves, last)), last
+		}
+	}
+
+	return moves, ""
+}
+
+// findMember returns the username of the club member matching
+// username, ignoring case.
+func findMember(members []string, username string) (string, bool) {
+	for _, member := range members {
+		if strings.EqualFold(member, strings.TrimSpace(username)) {
+			return member, true
+		}
+	}
+
+	return "", false
+}
+
+// validate checks that the game is between two different club
+// members, with a valid date and result.
+// White and Black are set to the club member usernames.
+func (g *otbGame) validate(members []string) error {
+	white, ok := findMember(members, g.White)
+	if !ok {
+		return fmt.Errorf("white player %q is not a member of the club", g.White)
+	}
+
+	black, ok := findMember(members, g.Black)
+	if !ok {
+		return fmt.Errorf("black player %q is not a member of the club", g.Black)
+	}
+
+	if white == black {
+		return fmt.Errorf("white and black must be different players")
+	}
+
+	g.White = white
+	g.Black = black
+
+	_, err := time.Parse("2006-01-02", g.Date)
+	if err != nil {
+		return fmt.Errorf("invalid date %q, expected YYYY-MM-DD", g.Date)
+	}
+
+	if g.Result != PgnResultWhiteWin && g.Result != PgnResultBlackWin && g.Result != PgnResultDraw {
+		return fmt.Errorf("invalid result %q, expected one of %s, %s or %s", g.Result, PgnResultWhiteWin, PgnResultBlackWin, PgnResultDraw)
+	}
+
+	_, movesResult := splitMovesResult(g.Moves)
+	if movesResult != "" && movesResult != PgnResultInProgress && movesResult != g.Result {
+		return fmt.Errorf("the moves end with %s but the result is %s", movesResult, g.Result)
+	}
+
+	return nil
+}
+
+// pgn returns the game in PGN format. A result the moves
+// end with is replaced by the result of the game.
+func (g otbGame) pgn() string {
+	date, _ := time.Parse("2006-01-02", g.Date)
+
+	pgnBuilder := strings.Builder{}
+	fmt.Fprintf(&pgnBuilder, "[Event \"Over the board\"]\n")
+	fmt.Fprintf(&pgnBuilder, "[Site \"Over the board\"]\n")
+	fmt.Fprintf(&pgnBuilder, "[Date \"%s\"]\n", date.Format("2006.01.02"))
+	fmt.Fprintf(&pgnBuilder, "[White \"%s\"]\n", g.White)
+	fmt.Fprintf(&pgnBuilder, "[Black \"%s\"]\n", g.Black)
+	fmt.Fprintf(&pgnBuilder, "[Result \"%s\"]\n", g.Result)
+
+	moves, _ := splitMovesResult(g.Moves)
+	if moves == "" {
+		fmt.Fprintf(&pgnBuilder, "\n%s\n", g.Result)
+	} else {
+		fmt.Fprintf(&pgnBuilder, "\n%s %s\n", moves, g.Result)
+	}
+
+	return pgnBuilder.String()
+}
+
+// checkFinalPosition returns an error if the result of the game
+// contradicts a checkmate or stalemate at the end of its moves.
+func (g otbGame) checkFinalPosition(game chessGame) error {
+	pos := game.ChessGame.Position()
+
+	switch pos.Status() {
+	case chess.Checkmate:
+		winnerResult := PgnResultWhiteWin
+		if pos.Turn() == chess.White {
+			winnerResult = PgnResultBlackWin
+		}
+
+		if g.Result != winnerResult {
+			return fmt.Errorf("the moves end in checkmate but the result is %s", g.Result)
+		}
+	case chess.Stalemate:
+		if g.Result != PgnResultDraw {
+			return fmt.Errorf("the moves end in stalemate but the result is %s", g.Result)
+		}
+	}
+
+	return nil
+}
+
+// addOTBGame validates the over the board game and adds it
+// to the game store.
+func addOTBGame(g otbGame, members []string) (storedGame, error) {
+	err := g.validate(members)
+	if err != nil {
+		return storedGame{}, err
+	}
+
+	record := storedGame{
+		ID:      "otb:" + uuid.New().String(),
+		Source:  GameSourceOTB,
+		Pgn:     g.pgn(),
+		AddedAt: time.Now(),
+	}
+
+	// Make sure the moves are legal before storing the game.
+	game, err := record.chessGame()
+	if err != nil {
+		return storedGame{}, fmt.Errorf("invalid moves: %w", err)
+	}
+
+	err = g.checkFinalPosition(game)
+	if err != nil {
+		return storedGame{}, err
+	}
+
+	_, err = store.add(record)
+	if err != nil {
+		return storedGame{}, fmt.Errorf("could not store over the board game: %w", err)
+	}
+
+	return record, nil
+}
@@ -0,0 +1,173 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+// stalemateMoves is the shortest known stalemate, after 10. Qe6.
+const stalemateMoves = "1. e3 a5 2. Qh5 Ra6 3. Qxa5 h5 4. h4 Rah6 5. Qxc7 f6 6. Qxd7+ Kf7 7. Qxb7 Qd3 8. Qxb8 Qh7 9. Qxc8 Kg6 10. Qe6"
+
+const scholarsMateMoves = "1. e4 e5 2. Qh5 Nc6 3. Bc4 Nf6 4. Qxf7#"
+
+func TestOTBGameValidate(t *testing.T) {
+	members := []string{"alice", "Bob"}
+
+	tests := []struct {
+		name    string
+		game    otbGame
+		wantErr string
+	}{
+		{
+			name: "valid",
+			game: otbGame{White: "ALICE", Black: "bob", Date: "2021-05-30", Result: PgnResultDraw},
+		},
+		{
+			name:    "white not a member",
+			game:    otbGame{White: "zed", Black: "bob", Date: "2021-05-30", Result: PgnResultDraw},
+			wantErr: "white player",
+		},
+		{
+			name:    "black not a member",
+			game:    otbGame{White: "alice", Black: "zed", Date: "2021-05-30", Result: PgnResultDraw},
+			wantErr: "black player",
+		},
+		{
+			name:    "same player",
+			game:    otbGame{White: "alice", Black: "Alice", Date: "2021-05-30", Result: PgnResultDraw},
+			wantErr: "different players",
+		},
+		{
+			name:    "invalid date",
+			game:    otbGame{White: "alice", Black: "bob", Date: "30/05/2021", Result: PgnResultDraw},
+			wantErr: "invalid date",
+		},
+		{
+			name:    "game in progress",
+			game:    otbGame{White: "alice", Black: "bob", Date: "2021-05-30", Result: PgnResultInProgress},
+			wantErr: "invalid result",
+		},
+		{
+			name: "moves end with the same result",
+			game: otbGame{White: "alice", Black: "bob", Date: "2021-05-30", Result: PgnResultWhiteWin, Moves: scholarsMateMoves + " 1-0"},
+		},
+		{
+			name: "moves end with an unknown result",
+			game: otbGame{White: "alice", Black: "bob", Date: "2021-05-30", Result: PgnResultWhiteWin, Moves: scholarsMateMoves + " *"},
+		},
+		{
+			name:    "moves end with another result",
+			game:    otbGame{White: "alice", Black: "bob", Date: "2021-05-30", Result: PgnResultWhiteWin, Moves: "1. e4 e5 1/2-1/2"},
+			wantErr: "the moves end with 1/2-1/2",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.game.validate(members)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("validate() error = %v", err)
+				}
+				if tt.game.White != "alice" || tt.game.Black != "Bob" {
+					t.Errorf("validate() set players to %s and %s, want alice and Bob", tt.game.White, tt.game.Black)
+				}
+				return
+			}
+
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("validate() error = %v, want it to contain %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestOTBGamePgn(t *testing.T) {
+	tests := []struct {
+		name  string
+		moves string
+		want  string
+	}{
+		{name: "no moves", moves: "", want: "\n1-0\n"},
+		{name: "moves", moves: " 1. e4 e5 ", want: "\n1. e4 e5 1-0\n"},
+		{name: "moves ending with the result", moves: "1. e4 e5 1-0", want: "\n1. e4 e5 1-0\n"},
+		{name: "moves ending with an unknown result", moves: "1. e4 e5\n*\n", want: "\n1. e4 e5 1-0\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := otbGame{White: "alice", Black: "bob", Date: "2021-05-30", Result: PgnResultWhiteWin, Moves: tt.moves}
+
+			pgn := g.pgn()
+			if !strings.HasSuffix(pgn, tt.want) {
+				t.Errorf("pgn() = %q, want it to end with %q", pgn, tt.want)
+			}
+			if !strings.Contains(pgn, "[Date \"2021.05.30\"]") {
+				t.Errorf("pgn() = %q, want a Date tag of 2021.05.30", pgn)
+			}
+
+			if _, err := getChessGame(pgn); err != nil {
+				t.Errorf("getChessGame(pgn()) error = %v", err)
+			}
+		})
+	}
+}
+
+func TestAddOTBGame(t *testing.T) {
+	members := []string{"alice", "bob"}
+
+	tests := []struct {
+		name    string
+		result  string
+		moves   string
+		wantErr string
+	}{
+		{name: "no moves", result: PgnResultDraw},
+		{name: "checkmate", result: PgnResultWhiteWin, moves: scholarsMateMoves},
+		{name: "checkmate with the result", result: PgnResultWhiteWin, moves: scholarsMateMoves + " 1-0"},
+		{name: "stalemate", result: PgnResultDraw, moves: stalemateMoves},
+		{name: "illegal move", result: PgnResultDraw, moves: "1. e4 e5 2. Ke3", wantErr: "invalid moves"},
+		{name: "checkmate recorded as a draw", result: PgnResultDraw, moves: scholarsMateMoves, wantErr: "checkmate"},
+		{name: "checkmate recorded as a loss", result: PgnResultBlackWin, moves: scholarsMateMoves, wantErr: "checkmate"},
+		{name: "stalemate recorded as a win", result: PgnResultWhiteWin, moves: stalemateMoves, wantErr: "stalemate"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := useTestGameStore(t)
+
+			record, err := addOTBGame(otbGame{
+				White:  "alice",
+				Black:  "bob",
+				Date:   "2021-05-30",
+				Result: tt.result,
+				Moves:  tt.moves,
+			}, members)
+
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Errorf("addOTBGame() error = %v, want it to contain %q", err, tt.wantErr)
+				}
+				if len(s.allGames()) != 0 {
+					t.Errorf("addOTBGame() stored a game it rejected")
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("addOTBGame() error = %v", err)
+			}
+
+			game, ok := s.get(record.ID)
+			if !ok {
+				t.Fatalf("addOTBGame() did not store game %s", record.ID)
+			}
+			if game.Source != GameSourceOTB || game.PgnParsed.Result != tt.result {
+				t.Errorf("stored game has source %s and result %s, want %s and %s", game.Source, game.PgnParsed.Result, GameSourceOTB, tt.result)
+			}
+			if strings.Count(record.Pgn, tt.result) != 2 {
+				t.Errorf("stored pgn does not have its result once in the tags and once after the moves: %q", record.Pgn)
+			}
+		})
+	}
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+)
+
+// maxMonthsScannedPerPage bounds how many months without club games
+// a single /monthgames request goes through before handing a cursor
+// back, so long empty stretches do not exhaust the request budget.
+const maxMonthsScannedPerPage = 6
+
+// monthGamesPage is a page of /monthgames: the first month at or
+// before the cursor with games between club members.
+type monthGamesPage struct {
+	monthGroupResult
+
+	// nextCursor is the month to ask for next as "YYYYMM",
+	// empty when there are no more months.
+	nextCursor string
+}
+
+// parseMonthCursor parses a /monthgames cursor in the YYYY-MM format.
+func parseMonthCursor(cursor string) (int, int, error) {
+	t, err := time.Parse("2006-01", cursor)
+	if err != nil {
+		return 0, 0, fmt.Errorf("invalid cursor %q, expected YYYY-MM", cursor)
+	}
+
+	return t.Year(), int(t.Month()), nil
+}
+
+// formatMonthCursor returns the "YYYYMM" yearMonth as a cursor.
+func formatMonthCursor(yearMonth string) string {
+	if yearMonth == "" {
+		return ""
+	}
+
+	return yearMonth[:4] + "-" + yearMonth[4:]
+}
+
+// clubYearMonths returns, most recent first, the months up to
+// yearMonth which may have games between club members: those two
+// or more members have an archive for, and those with games in
+// storeYearMonths.
+func clubYearMonths(archiveYearMonthsByUser map[string][]string, storeYearMonths []string, yearMonth string) []string {
+	counts := make(map[string]int)
+	for _, yearMonths := range archiveYearMonthsByUser {
+		for _, ym := range yearMonths {
+			counts[ym]++
+		}
+	}
+
+	yearMonthMap := make(map[string]struct{})
+	for ym, count := range counts {
+		if count > 1 {
+			yearMonthMap[ym] = struct{}{}
+		}
+	}
+
+	for _, ym := range storeYearMonths {
+		yearMonthMap[ym] = struct{}{}
+	}
+
+	candidates := []string{}
+	for ym := range yearMonthMap {
+		if ym <= yearMonth {
+			candidates = append(candidates, ym)
+		}
+	}
+
+	sort.Sort(sort.Reverse(sort.StringSlice(candidates)))
+
+	return candidates
+}
+
+// getMonthGamesPage returns the first month at or before the passed
+// year and month with games between users, skipping months without
+// any. Up to maxMonthsScannedPerPage months are looked at, if none
+// of them has games the page has no group and a cursor to go on from.
+func getMonthGamesPage(ctx context.Context, users []string, year, month int, onlineOnly bool) monthGamesPage {
+	index := getMonthIndex(ctx, users, onlineOnly)
+	yearMonths := index.yearMonths(yearMonthString(year, month))
+
+	page := monthGamesPage{}
+	for i, ym := range yearMonths {
+		if i == maxMonthsScannedPerPage || ctx.Err() != nil {
+			page.nextCursor = ym
+			return page
+		}
+
+		// yearMonths only has valid months
+		y, m, _ := parseYearMonthString(ym)
+
+		page.monthGroupResult = getFinishedGamesForUsersForYearMonth(ctx, index, users, y, m, onlineOnly)
+
+		// Stop at a month with games, and at a month which looks
+		// empty because a member's games could not be fetched so
+		// it is reported rather than skipped.
+		if page.group != nil || hasFailedMembers(page.memberStatuses) {
+			if i+1 < len(yearMonths) {
+				page.nextCursor = yearMonths[i+1]
+			}
+			return page
+		}
+	}
+
+	return page
+}
@@ -0,0 +1,158 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseMonthCursor(t *testing.T) {
+	tests := []struct {
+		cursor    string
+		wantYear  int
+		wantMonth int
+		wantErr   bool
+	}{
+		{cursor: "2021-05", wantYear: 2021, wantMonth: 5},
+		{cursor: "2021-01", wantYear: 2021, wantMonth: 1},
+		{cursor: "2020-12", wantYear: 2020, wantMonth: 12},
+		{cursor: "2021-00", wantErr: true},
+		{cursor: "2021-13", wantErr: true},
+		{cursor: "202105", wantErr: true},
+		{cursor: "", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.cursor, func(t *testing.T) {
+			year, month, err := parseMonthCursor(tt.cursor)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseMonthCursor(%q) error = %v, want error %t", tt.cursor, err, tt.wantErr)
+			}
+			if year != tt.wantYear || month != tt.wantMonth {
+				t.Errorf("parseMonthCursor(%q) = %d, %d, want %d, %d", tt.cursor, year, month, tt.wantYear, tt.wantMonth)
+			}
+		})
+	}
+}
+
+func TestParseYearMonthString(t *testing.T) {
+	tests := []struct {
+		yearMonth string
+		wantYear  int
+		wantMonth int
+		wantErr   bool
+	}{
+		{yearMonth: "202105", wantYear: 2021, wantMonth: 5},
+		{yearMonth: "202012", wantYear: 2020, wantMonth: 12},
+		{yearMonth: "202101", wantYear: 2021, wantMonth: 1},
+		{yearMonth: "202100", wantErr: true},
+		{yearMonth: "202113", wantErr: true},
+		{yearMonth: "2021-05", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.yearMonth, func(t *testing.T) {
+			year, month, err := parseYearMonthString(tt.yearMonth)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseYearMonthString(%q) error = %v, want error %t", tt.yearMonth, err, tt.wantErr)
+			}
+			if year != tt.wantYear || month != tt.wantMonth {
+				t.Errorf("parseYearMonthString(%q) = %d, %d, want %d, %d", tt.yearMonth, year, month, tt.wantYear, tt.wantMonth)
+			}
+			if !tt.wantErr && yearMonthString(year, month) != tt.yearMonth {
+				t.Errorf("yearMonthString(%d, %d) = %q, want %q", year, month, yearMonthString(year, month), tt.yearMonth)
+			}
+		})
+	}
+}
+
+func TestGetPreviousMonth(t *testing.T) {
+	tests := []struct {
+		year, month         int
+		wantYear, wantMonth int
+	}{
+		{year: 2021, month: 5, wantYear: 2021, wantMonth: 4},
+		{year: 2021, month: 2, wantYear: 2021, wantMonth: 1},
+		{year: 2021, month: 1, wantYear: 2020, wantMonth: 12},
+		{year: 2000, month: 1, wantYear: 1999, wantMonth: 12},
+	}
+
+	for _, tt := range tests {
+		year, month := getPreviousMonth(tt.year, tt.month)
+		if year != tt.wantYear || month != tt.wantMonth {
+			t.Errorf("getPreviousMonth(%d, %d) = %d, %d, want %d, %d", tt.year, tt.month, year, month, tt.wantYear, tt.wantMonth)
+		}
+	}
+}
+
+func TestClubYearMonths(t *testing.T) {
+	tests := []struct {
+		name            string
+		archives        map[string][]string
+		storeYearMonths []string
+		yearMonth       string
+		want            []string
+	}{
+		{
+			name: "crosses year boundary",
+			archives: map[string][]string{
+				"alice": {"202011", "202012", "202101", "202102"},
+				"bob":   {"202011", "202012", "202101", "202102"},
+			},
+			yearMonth: "202101",
+			want:      []string{"202101", "202012", "202011"},
+		},
+		{
+			name: "skips empty stretch across years",
+			archives: map[string][]string{
+				"alice": {"201906", "202103"},
+				"bob":   {"201906", "202103"},
+			},
+			yearMonth: "202102",
+			want:      []string{"201906"},
+		},
+		{
+			name: "members with different latest months",
+			archives: map[string][]string{
+				"alice": {"202010", "202012"},
+				"bob":   {"202010", "202011"},
+				"carol": {"202011", "202012"},
+			},
+			yearMonth: "202101",
+			want:      []string{"202012", "202011", "202010"},
+		},
+		{
+			name: "month only one member played",
+			archives: map[string][]string{
+				"alice": {"202012", "202101"},
+				"bob":   {"202012"},
+			},
+			yearMonth: "202101",
+			want:      []string{"202012"},
+		},
+		{
+			name: "store games in a month without archives",
+			archives: map[string][]string{
+				"alice": {"202012"},
+				"bob":   {"202012"},
+			},
+			storeYearMonths: []string{"202101", "201912"},
+			yearMonth:       "202101",
+			want:            []string{"202101", "202012", "201912"},
+		},
+		{
+			name:      "no archives",
+			archives:  map[string][]string{},
+			yearMonth: "202101",
+			want:      []string{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := clubYearMonths(tt.archives, tt.storeYearMonths, tt.yearMonth)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("clubYearMonths() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
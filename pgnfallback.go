@@ -0,0 +1,177 @@
+package main
+
+import (
+	"fmt"
+	"path"
+	"sync"
+	"time"
+
+	"github.com/notnil/chess"
+)
+
+// maxParseFailures is how many PGN parse failures are kept
+// for the diagnostics page.
+const maxParseFailures = 100
+
+// parseFailure is a game whose PGN could not be parsed.
+type parseFailure struct {
+	URL    string
+	User   string
+	Error  string
+	Pgn    string
+	LastAt time.Time
+	Count  int
+
+	// Fallback is set when the game was built from the position and
+	// result reported by chess.com, so it still counts in the stats.
+	Fallback bool
+}
+
+// parseFailureLog keeps the most recent parse failures, one per game.
+type parseFailureLog struct {
+	mutex    sync.Mutex
+	failures map[string]*parseFailure
+	order    []string
+}
+
+var parseFailures = &parseFailureLog{
+	failures: make(map[string]*parseFailure),
+}
+
+// record adds a failure for the game at url, or updates the failure
+// already recorded for it. The oldest game is dropped once
+// maxParseFailures games are kept.
+func (l *parseFailureLog) record(url, user, pgn string, err error, fallback bool) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	failure, ok := l.failures[url]
+	if !ok {
+		if len(l.order) >= maxParseFailures {
+			delete(l.failures, l.order[0])
+			l.order = l.order[1:]
+		}
+
+		failure = &parseFailure{URL: url}
+		l.failures[url] = failure
+		l.order = append(l.order, url)
+	}
+
+	failure.User = user
+	failure.Error = err.Error()
+	failure.Pgn = pgn
+	failure.Fallback = fallback
+	failure.LastAt = time.Now()
+	failure.Count++
+}
+
+// recent returns the recorded failures, most recent first.
+func (l *parseFailureLog) recent() []parseFailure {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	failures := make([]parseFailure, 0, len(l.order))
+	for i := len(l.order) - 1; i >= 0; i-- {
+		failures = append(failures, *l.failures[l.order[i]])
+	}
+
+	return failures
+}
+
+// chessGameFromChessComFinishedGame builds a chessGame from a finished
+// chess.com game fetched for user. If its PGN cannot be parsed, the game
+// is built from the final position and the results reported by
+// chess.com instead and the failure is recorded in parseFailures.
+func chessGameFromChessComFinishedGame(user string, finishedGame *chessComFinishedGame) (chessGame, error) {
+	game, pgnErr, err := buildChessComFinishedGame(finishedGame)
+	if pgnErr != nil {
+		pgnParseFailuresTotal.Inc()
+		parseFailures.record(finishedGame.URL, user, finishedGame.Pgn, pgnErr, err == nil)
+	}
+
+	return game, err
+}
+
+// buildChessComFinishedGame builds a chessGame from a finished chess.com
+// game like chessGameFromChessComFinishedGame, without recording parse
+// failures. pgnErr is set when the PGN could not be parsed. It is used
+// for games loaded from the game store, whose failures were recorded
+// when they were fetched.
+func buildChessComFinishedGame(finishedGame *chessComFinishedGame) (game chessGame, pgnErr error, err error) {
+	game, pgnErr = getChessGame(finishedGame.Pgn)
+	if pgnErr != nil {
+		game, err = chessGameFromFEN(finishedGame.Fen, pgnErr)
+		if err != nil {
+			return chessGame{}, pgnErr, err
+		}
+
+		game.PgnParsed.White = finishedGame.White.Username
+		game.PgnParsed.Black = finishedGame.Black.Username
+		game.PgnParsed.WhiteElo = fmt.Sprint(finishedGame.White.Rating)
+		game.PgnParsed.BlackElo = fmt.Sprint(finishedGame.Black.Rating)
+		game.PgnParsed.TimeControl = finishedGame.TimeControl
+		game.PgnParsed.Link = finishedGame.URL
+		game.PgnParsed.ParsedEndtime = time.Unix(int64(finishedGame.EndTime), 0).UTC()
+
+		if finishedGame.White.Result == ChessComResultWin {
+			game.PgnParsed.Result = PgnResultWhiteWin
+			game.PgnParsed.WhiteWon = true
+		} else if finishedGame.Black.Result == ChessComResultWin {
+			game.PgnParsed.Result = PgnResultBlackWin
+			game.PgnParsed.BlackWon = true
+		} else {
+			// A finished game nobody won is a draw.
+			game.PgnParsed.Result = PgnResultDraw
+			game.PgnParsed.Draw = true
+		}
+	}
+
+	setChessComResults(&game, finishedGame)
+
+	game.URL = finishedGame.URL
+	game.Source = GameSourceChessCom
+
+	return game, pgnErr, nil
+}
+
+// chessGameFromChessComCurrentGame builds a chessGame from a current
+// chess.com game, falling back to its current position when its PGN
+// cannot be parsed.
+func chessGameFromChessComCurrentGame(user string, currentGame chessComCurrentGame) (chessGame, error) {
+	game, pgnErr := getChessGame(currentGame.Pgn)
+	if pgnErr != nil {
+		var err error
+		game, err = chessGameFromFEN(currentGame.Fen, pgnErr)
+		pgnParseFailuresTotal.Inc()
+		parseFailures.record(currentGame.URL, user, currentGame.Pgn, pgnErr, err == nil)
+		if err != nil {
+			return chessGame{}, err
+		}
+
+		// Players of current games are given as profile URLs.
+		game.PgnParsed.White = path.Base(currentGame.White)
+		game.PgnParsed.Black = path.Base(currentGame.Black)
+		game.PgnParsed.TimeControl = currentGame.TimeControl
+		game.PgnParsed.Link = currentGame.URL
+		game.PgnParsed.Result = PgnResultInProgress
+	}
+
+	game.URL = currentGame.URL
+	game.Source = GameSourceChessCom
+
+	return game, nil
+}
+
+// chessGameFromFEN returns a game in the position fen, with
+// PgnError set to pgnErr.
+func chessGameFromFEN(fen string, pgnErr error) (chessGame, error) {
+	fenOption, err := chess.FEN(fen)
+	if err != nil {
+		return chessGame{}, fmt.Errorf("could not read pgn (%s) nor fen: %w", pgnErr, err)
+	}
+
+	return chessGame{
+		ChessGame: chess.NewGame(fenOption),
+		PgnError:  pgnErr.Error(),
+	}, nil
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+// useParseFailureLog replaces parseFailures with an empty log
+// until the test ends.
+func useParseFailureLog(t *testing.T) {
+	t.Helper()
+
+	old := parseFailures
+	parseFailures = &parseFailureLog{
+		failures: make(map[string]*parseFailure),
+	}
+	t.Cleanup(func() { parseFailures = old })
+}
+
+func TestParseFailuresRecordedWhenFetched(t *testing.T) {
+	useParseFailureLog(t)
+	s := useTestGameStore(t)
+
+	finishedGames := loadFixtureFinishedGames(t, "alice/2021/05.json")
+	unparsable := *findGame(t, finishedGames, "https://www.chess.com/game/live/1001").ChessComFinishedGame
+	unparsable.Pgn = "1. e4 zz9"
+
+	metricFailures := scrapeMetric(t, "chess_club_pgn_parse_failures_total", "")
+
+	// Fetching the game records the failure.
+	game, err := chessGameFromChessComFinishedGame("alice", &unparsable)
+	if err != nil {
+		t.Fatalf("chessGameFromChessComFinishedGame() error = %v", err)
+	}
+	if game.PgnError == "" {
+		t.Errorf("game was not built from its final position")
+	}
+
+	// Storing and loading it back does not.
+	_, err = s.add(storedGame{
+		ID:                   unparsable.URL,
+		Source:               GameSourceChessCom,
+		Pgn:                  unparsable.Pgn,
+		ChessComFinishedGame: &unparsable,
+	})
+	if err != nil {
+		t.Fatalf("add() error = %v", err)
+	}
+
+	reloaded, err := newGameStore(filepath.Join(filepath.Dir(s.path), "games.json"))
+	if err != nil {
+		t.Fatalf("newGameStore() error = %v", err)
+	}
+	if stored, ok := reloaded.get(unparsable.URL); !ok || stored.PgnError == "" {
+		t.Errorf("reloaded game store does not have the game built from its final position")
+	}
+
+	failures := parseFailures.recent()
+	if len(failures) != 1 {
+		t.Fatalf("%d parse failures were recorded, want 1", len(failures))
+	}
+	if failures[0].URL != unparsable.URL || failures[0].User != "alice" || failures[0].Count != 1 || !failures[0].Fallback {
+		t.Errorf("parse failure = %+v, want one fallback for alice's game %s", failures[0], unparsable.URL)
+	}
+	if got := scrapeMetric(t, "chess_club_pgn_parse_failures_total", "") - metricFailures; got != 1 {
+		t.Errorf("pgn parse failures went up by %g, want 1", got)
+	}
+}
@@ -0,0 +1,161 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// importResult summarizes the outcome of importing PGN games.
+type importResult struct {
+	Added      int      `json:"added"`
+	Duplicates int      `json:"duplicates"`
+	Errors     []string `json:"errors"`
+}
+
+// splitPgnGames reads a PGN file which may contain several games
+// and returns the PGN of each game as a separate string.
+// A new game starts whenever a tag pair follows move text.
+func splitPgnGames(r io.Reader) ([]string, error) {
+	pgnStrings := []string{}
+
+	current := strings.Builder{}
+	inMoveText := false
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := scanner.Text()
+		trimmed := strings.TrimSpace(line)
+
+		if strings.HasPrefix(trimmed, "[") && inMoveText {
+			pgnStrings = append(pgnStrings, current.String())
+			current.Reset()
+			inMoveText = false
+		}
+
+		if trimmed != "" && !strings.HasPrefix(trimmed, "[") {
+			inMoveText = true
+		}
+
+		current.WriteString(line)
+		current.WriteString("\n")
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("could not read pgn: %w", err)
+	}
+
+	if strings.TrimSpace(current.String()) != "" {
+		pgnStrings = append(pgnStrings, current.String())
+	}
+
+	return pgnStrings, nil
+}
+
+// importPgnFile imports the games of an uploaded PGN file like
+// importPgnGames, closing the file once they are read.
+func importPgnFile(fileHeader *multipart.FileHeader, source string) (importResult, error) {
+	f, err := fileHeader.Open()
+	if err != nil {
+		return importResult{Errors: []string{}}, fmt.Errorf("could not open uploaded file %s: %w", fileHeader.Filename, err)
+	}
+	defer f.Close()
+
+	return importPgnGames(f, source)
+}
+
+// importPgnGames reads every game in r and adds it to the game store
+// tagged with the passed source. Games which cannot be parsed are
+// reported in the result and do not stop the rest from being imported.
+func importPgnGames(r io.Reader, source string) (importResult, error) {
+	result := importResult{
+		Errors: []string{},
+	}
+
+	pgnStrings, err := splitPgnGames(r)
+	if err != nil {
+		return result, err
+	}
+
+	records := []storedGame{}
+	seenIDs := make(map[string]struct{})
+	for i, pgnString := range pgnStrings {
+		game, err := getChessGame(pgnString)
+		if err != nil {
+			result.Errors = append(result.Errors, fmt.Sprintf("game %d: %s", i+1, err))
+			continue
+		}
+
+		id := pgnGameID(game, pgnString)
+
+		_, seen := seenIDs[id]
+		if seen || store.has(id) {
+			result.Duplicates++
+			continue
+		}
+		seenIDs[id] = struct{}{}
+
+		records = append(records, storedGame{
+			ID:     id,
+			Source: source,
+			Pgn:    pgnString,
+		})
+	}
+
+	added, err := store.add(records...)
+	result.Added = added
+	if err != nil {
+		return result, fmt.Errorf("could not add imported games to game store: %w", err)
+	}
+
+	return result, nil
+}
+
+// importPgnPath imports the PGN file in path. If path is a directory,
+// every .pgn file in it (and its subdirectories) is imported.
+func importPgnPath(path, source string) (importResult, error) {
+	total := importResult{
+		Errors: []string{},
+	}
+
+	err := filepath.Walk(path, func(filePath string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if info.IsDir() {
+			return nil
+		}
+
+		// Only filter on the extension when walking a directory,
+		// a file passed explicitly is always imported.
+		if filePath != path && !strings.EqualFold(filepath.Ext(filePath), ".pgn") {
+			return nil
+		}
+
+		f, err := os.Open(filePath)
+		if err != nil {
+			return fmt.Errorf("could not open pgn file %s: %w", filePath, err)
+		}
+		defer f.Close()
+
+		result, err := importPgnGames(f, source)
+		total.Added += result.Added
+		total.Duplicates += result.Duplicates
+		for _, importErr := range result.Errors {
+			total.Errors = append(total.Errors, fmt.Sprintf("%s: %s", filePath, importErr))
+		}
+		if err != nil {
+			return fmt.Errorf("could not import pgn file %s: %w", filePath, err)
+		}
+
+		return nil
+	})
+
+	return total, err
+}
@@ -0,0 +1,272 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const (
+	importGameA = `[Event "Club night"]
+[White "alice"]
+[Black "bob"]
+[Result "1-0"]
+
+1. e4 e5 2. Qh5 Nc6 3. Bc4 Nf6 4. Qxf7# 1-0
+`
+	importGameB = `[Event "Club night"]
+[White "bob"]
+[Black "carol"]
+[Result "1/2-1/2"]
+
+1. d4 d5 2. c4 e6 1/2-1/2
+`
+	// importGameIllegal has an illegal second move.
+	importGameIllegal = `[Event "Club night"]
+[White "carol"]
+[Black "alice"]
+[Result "0-1"]
+
+1. e4 e5 2. Ke3 0-1
+`
+)
+
+// useTestGameStore replaces the game store with an empty one saved
+// in a temporary directory until the test ends.
+func useTestGameStore(t *testing.T) *gameStore {
+	t.Helper()
+
+	s, err := newGameStore(filepath.Join(t.TempDir(), "games.json"))
+	if err != nil {
+		t.Fatalf("newGameStore() error = %v", err)
+	}
+
+	oldStore := store
+	store = s
+	t.Cleanup(func() { store = oldStore })
+
+	return s
+}
+
+func TestSplitPgnGames(t *testing.T) {
+	tests := []struct {
+		name string
+		pgn  string
+		want int
+	}{
+		{name: "empty", pgn: "", want: 0},
+		{name: "blank lines only", pgn: "\n\n  \n", want: 0},
+		{name: "one game", pgn: importGameA, want: 1},
+		{name: "two games", pgn: importGameA + "\n" + importGameB, want: 2},
+		{name: "no blank line between games", pgn: importGameA + importGameB, want: 2},
+		{name: "three games", pgn: importGameA + "\n" + importGameIllegal + "\n" + importGameB, want: 3},
+		{name: "moves over several lines", pgn: "[White \"alice\"]\n\n1. e4 e5\n2. Nf3 Nc6 *\n", want: 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			games, err := splitPgnGames(strings.NewReader(tt.pgn))
+			if err != nil {
+				t.Fatalf("splitPgnGames() error = %v", err)
+			}
+
+			if len(games) != tt.want {
+				t.Fatalf("splitPgnGames() returned %d games, want %d: %q", len(games), tt.want, games)
+			}
+
+			for i, game := range games {
+				if !strings.HasPrefix(strings.TrimSpace(game), "[") {
+					t.Errorf("game %d does not start with its tags: %q", i+1, game)
+				}
+			}
+		})
+	}
+}
+
+func TestImportPgnGames(t *testing.T) {
+	linked := func(pgn, link string) string {
+		return `[Link "` + link + `"]` + "\n" + pgn
+	}
+
+	tests := []struct {
+		name           string
+		files          []string
+		wantAdded      []int
+		wantDuplicates []int
+		wantErrors     []string
+		wantStored     int
+	}{
+		{
+			name:       "bad game in the middle",
+			files:      []string{importGameA + "\n" + importGameIllegal + "\n" + importGameB},
+			wantAdded:  []int{2},
+			wantErrors: []string{"game 2: "},
+			wantStored: 2,
+		},
+		{
+			name:           "same game twice in a file",
+			files:          []string{importGameA + "\n" + importGameA},
+			wantAdded:      []int{1},
+			wantDuplicates: []int{1},
+			wantStored:     1,
+		},
+		{
+			name:           "file imported twice",
+			files:          []string{importGameA + "\n" + importGameB, importGameB + "\n" + importGameA},
+			wantAdded:      []int{2, 0},
+			wantDuplicates: []int{0, 2},
+			wantStored:     2,
+		},
+		{
+			name: "different pgn with the same link",
+			files: []string{
+				linked(importGameA, "https://example.com/game/1"),
+				linked(strings.Replace(importGameA, "Club night", "Rapid", 1), "https://example.com/game/1"),
+			},
+			wantAdded:      []int{1, 0},
+			wantDuplicates: []int{0, 1},
+			wantStored:     1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := useTestGameStore(t)
+
+			errors := []string{}
+			for i, file := range tt.files {
+				result, err := importPgnGames(strings.NewReader(file), GameSourcePgnImport)
+				if err != nil {
+					t.Fatalf("importPgnGames() error = %v", err)
+				}
+
+				if result.Added != tt.wantAdded[i] {
+					t.Errorf("file %d: added %d games, want %d", i+1, result.Added, tt.wantAdded[i])
+				}
+
+				wantDuplicates := 0
+				if tt.wantDuplicates != nil {
+					wantDuplicates = tt.wantDuplicates[i]
+				}
+				if result.Duplicates != wantDuplicates {
+					t.Errorf("file %d: %d duplicates, want %d", i+1, result.Duplicates, wantDuplicates)
+				}
+
+				errors = append(errors, result.Errors...)
+			}
+
+			if len(errors) != len(tt.wantErrors) {
+				t.Fatalf("errors = %q, want %d", errors, len(tt.wantErrors))
+			}
+			for i, prefix := range tt.wantErrors {
+				if !strings.HasPrefix(errors[i], prefix) {
+					t.Errorf("error %d = %q, want it to start with %q", i+1, errors[i], prefix)
+				}
+			}
+
+			if got := len(s.allGames()); got != tt.wantStored {
+				t.Errorf("game store has %d games, want %d", got, tt.wantStored)
+			}
+
+			// The games are saved and loaded back.
+			reloaded, err := newGameStore(s.path)
+			if err != nil {
+				t.Fatalf("newGameStore() error = %v", err)
+			}
+			if got := len(reloaded.allGames()); got != tt.wantStored {
+				t.Errorf("reloaded game store has %d games, want %d", got, tt.wantStored)
+			}
+		})
+	}
+}
+
+func TestImportGamesHandler(t *testing.T) {
+	multipartBody := func(files ...string) (*bytes.Buffer, string) {
+		body := &bytes.Buffer{}
+		w := multipart.NewWriter(body)
+		for i, file := range files {
+			part, err := w.CreateFormFile("pgn", filepath.Join("games", string(rune('a'+i))+".pgn"))
+			if err != nil {
+				t.Fatalf("could not create form file: %s", err)
+			}
+			part.Write([]byte(file))
+		}
+		w.Close()
+
+		return body, w.FormDataContentType()
+	}
+
+	tests := []struct {
+		name        string
+		body        func() (*bytes.Buffer, string)
+		wantStatus  int
+		wantAdded   int
+		wantErrors  int
+		wantDupes   int
+		wantInError string
+	}{
+		{
+			name: "raw body",
+			body: func() (*bytes.Buffer, string) {
+				return bytes.NewBufferString(importGameA + "\n" + importGameIllegal + "\n" + importGameB), "application/x-chess-pgn"
+			},
+			wantStatus: http.StatusOK,
+			wantAdded:  2,
+			wantErrors: 1,
+		},
+		{
+			name: "several uploaded files",
+			body: func() (*bytes.Buffer, string) {
+				return multipartBody(importGameA, importGameA+"\n"+importGameB)
+			},
+			wantStatus: http.StatusOK,
+			wantAdded:  2,
+			wantDupes:  1,
+		},
+		{
+			name: "no uploaded file",
+			body: func() (*bytes.Buffer, string) {
+				return multipartBody()
+			},
+			wantStatus:  http.StatusBadRequest,
+			wantInError: "No PGN file uploaded",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			useTestGameStore(t)
+
+			body, contentType := tt.body()
+			req := httptest.NewRequest(http.MethodPost, "/import", body)
+			req.Header.Set("Content-Type", contentType)
+
+			rec := httptest.NewRecorder()
+			importGamesHandler(rec, req)
+
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("POST /import = %d, want %d: %s", rec.Code, tt.wantStatus, rec.Body.String())
+			}
+			if tt.wantStatus != http.StatusOK {
+				if !strings.Contains(rec.Body.String(), tt.wantInError) {
+					t.Errorf("POST /import body = %q, want it to contain %q", rec.Body.String(), tt.wantInError)
+				}
+				return
+			}
+
+			result := importResult{}
+			if err := json.Unmarshal(rec.Body.Bytes(), &result); err != nil {
+				t.Fatalf("could not unmarshal import result: %s", err)
+			}
+
+			if result.Added != tt.wantAdded || len(result.Errors) != tt.wantErrors || result.Duplicates != tt.wantDupes {
+				t.Errorf("import result = %+v, want %d added, %d duplicates and %d errors", result, tt.wantAdded, tt.wantDupes, tt.wantErrors)
+			}
+		})
+	}
+}
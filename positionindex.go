@@ -0,0 +1,180 @@
+package main
+
+import (
+	"fmt"
+	"math/rand"
+	"sort"
+	"strings"
+
+	"github.com/notnil/chess"
+)
+
+// zobristTable has the random numbers positions are hashed with.
+// Pieces are indexed by chess.Piece, which starts at 1.
+type zobristTable struct {
+	pieces      [13][64]uint64
+	blackToMove uint64
+	castling    [4]uint64
+}
+
+// zobrist is seeded with a constant so hashes are the same every run.
+var zobrist = newZobristTable(rand.New(rand.NewSource(20210501)))
+
+func newZobristTable(r *rand.Rand) *zobristTable {
+	t := &zobristTable{}
+	for piece := range t.pieces {
+		for sq := range t.pieces[piece] {
+			t.pieces[piece][sq] = r.Uint64()
+		}
+	}
+
+	t.blackToMove = r.Uint64()
+	for i := range t.castling {
+		t.castling[i] = r.Uint64()
+	}
+
+	return t
+}
+
+// positionHash returns the Zobrist hash of pos: the pieces, the side
+// to move and the castling rights. The move counters and en passant
+// square are left out, positions reached with different move orders
+// hash the same.
+func positionHash(pos *chess.Position) uint64 {
+	var hash uint64
+	for sq, piece := range pos.Board().SquareMap() {
+		hash ^= zobrist.pieces[piece][sq]
+	}
+
+	if pos.Turn() == chess.Black {
+		hash ^= zobrist.blackToMove
+	}
+
+	castleRights := pos.CastleRights()
+	for i, right := range []struct {
+		color chess.Color
+		side  chess.Side
+	}{
+		{chess.White, chess.KingSide},
+		{chess.White, chess.QueenSide},
+		{chess.Black, chess.KingSide},
+		{chess.Black, chess.QueenSide},
+	} {
+		if castleRights.CanCastle(right.color, right.side) {
+			hash ^= zobrist.castling[i]
+		}
+	}
+
+	return hash
+}
+
+// positionHit is a position reached in a game of the game store,
+// Ply moves after the game started.
+type positionHit struct {
+	GameID string
+	Ply    int
+}
+
+// indexGamePositions returns the hash of every position of game
+// along with the first ply it was reached at.
+func indexGamePositions(game chessGame) map[uint64]int {
+	plies := make(map[uint64]int)
+	for ply, pos := range game.ChessGame.Positions() {
+		hash := positionHash(pos)
+		if _, ok := plies[hash]; !ok {
+			plies[hash] = ply
+		}
+	}
+
+	return plies
+}
+
+// positionFromFEN returns the position of fen.
+func positionFromFEN(fen string) (*chess.Position, error) {
+	fenOption, err := chess.FEN(strings.TrimSpace(fen))
+	if err != nil {
+		return nil, fmt.Errorf("could not read fen: %w", err)
+	}
+
+	return chess.NewGame(fenOption).Position(), nil
+}
+
+// positionFromMoves returns the position reached by playing moves, in
+// algebraic notation, from the starting position. Move numbers such
+// as "1." or "12..." are skipped.
+func positionFromMoves(moves string) (*chess.Position, error) {
+	pos := chess.StartingPosition()
+	for _, field := range strings.Fields(moves) {
+		field = field[strings.LastIndex(field, ".")+1:]
+		if field == "" {
+			continue
+		}
+
+		move, err := chess.AlgebraicNotation{}.Decode(pos, field)
+		if err != nil {
+			return nil, fmt.Errorf("could not play %s: %w", field, err)
+		}
+		pos = pos.Update(move)
+	}
+
+	return pos, nil
+}
+
+// positionMatch is a game which reached the searched position Ply
+// moves after it started.
+type positionMatch struct {
+	Game chessGame
+	Ply  int
+}
+
+// Move returns the move which reached the position, such as
+// "12... Nf6", empty for the position the game started from.
+func (m positionMatch) Move() string {
+	if m.Ply == 0 {
+		return ""
+	}
+
+	positions := m.Game.ChessGame.Positions()
+	pos := positions[m.Ply-1]
+	san := chess.AlgebraicNotation{}.Encode(pos, m.Game.ChessGame.Moves()[m.Ply-1])
+
+	number := (m.Ply + 1) / 2
+	if positions[0].Turn() == chess.Black {
+		number = m.Ply/2 + 1
+	}
+
+	if pos.Turn() == chess.Black {
+		return fmt.Sprintf("%d... %s", number, san)
+	}
+
+	return fmt.Sprintf("%d. %s", number, san)
+}
+
+// searchPosition returns the club games between users in the game
+// store which reached pos, most recent first.
+func (s *gameStore) searchPosition(users []string, pos *chess.Position) []positionMatch {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	matches := []positionMatch{}
+	for _, hit := range s.positions[positionHash(pos)] {
+		game := s.parsed[hit.GameID]
+		if !isClubGame(users, game) {
+			continue
+		}
+
+		matches = append(matches, positionMatch{
+			Game: game,
+			Ply:  hit.Ply,
+		})
+	}
+
+	sort.SliceStable(matches, func(i, j int) bool {
+		if !matches[i].Game.PgnParsed.ParsedEndtime.Equal(matches[j].Game.PgnParsed.ParsedEndtime) {
+			return matches[i].Game.PgnParsed.ParsedEndtime.After(matches[j].Game.PgnParsed.ParsedEndtime)
+		}
+		return matches[i].Game.URL < matches[j].Game.URL
+	})
+
+	return matches
+}
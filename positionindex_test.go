@@ -0,0 +1,153 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/notnil/chess"
+)
+
+func TestPositionHash(t *testing.T) {
+	fenHash := func(fen string) uint64 {
+		t.Helper()
+
+		pos, err := positionFromFEN(fen)
+		if err != nil {
+			t.Fatalf("positionFromFEN(%q) error = %s", fen, err)
+		}
+		return positionHash(pos)
+	}
+	movesHash := func(moves string) uint64 {
+		t.Helper()
+
+		pos, err := positionFromMoves(moves)
+		if err != nil {
+			t.Fatalf("positionFromMoves(%q) error = %s", moves, err)
+		}
+		return positionHash(pos)
+	}
+
+	afterE4 := "rnbqkbnr/pppppppp/8/8/4P3/8/PPPP1PPP/RNBQKBNR b KQkq e3 0 1"
+
+	if movesHash("1. e4") != fenHash(afterE4) {
+		t.Errorf("1. e4 does not hash as its FEN")
+	}
+	if fenHash(afterE4) != fenHash("rnbqkbnr/pppppppp/8/8/4P3/8/PPPP1PPP/RNBQKBNR b KQkq - 12 40") {
+		t.Errorf("the move counters and en passant square change the hash")
+	}
+	if fenHash(afterE4) == fenHash("rnbqkbnr/pppppppp/8/8/4P3/8/PPPP1PPP/RNBQKBNR w KQkq - 0 1") {
+		t.Errorf("the side to move does not change the hash")
+	}
+	if fenHash(afterE4) == fenHash("rnbqkbnr/pppppppp/8/8/4P3/8/PPPP1PPP/RNBQKBNR b Kkq - 0 1") {
+		t.Errorf("the castling rights do not change the hash")
+	}
+	if movesHash("1. Nf3 Nf6 2. c4") != movesHash("1. c4 Nf6 2. Nf3") {
+		t.Errorf("transpositions do not hash the same")
+	}
+}
+
+func TestPositionFromMovesError(t *testing.T) {
+	for _, moves := range []string{"1. e5", "1. e4 e5 2. Ke3"} {
+		if _, err := positionFromMoves(moves); err == nil {
+			t.Errorf("positionFromMoves(%q) succeeded with an illegal move", moves)
+		}
+	}
+
+	if _, err := positionFromFEN("not a fen"); err == nil {
+		t.Errorf("positionFromFEN() succeeded with an invalid FEN")
+	}
+}
+
+func TestGameStoreSearchPosition(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "games.json")
+
+	s, err := newGameStore(path)
+	if err != nil {
+		t.Fatalf("newGameStore() error = %s", err)
+	}
+
+	_, err = s.add(
+		storedGame{ID: "pgn:scholars-mate", Source: GameSourcePgnImport, Pgn: scholarsMatePgn},
+		storedGame{ID: "pgn:other-order", Source: GameSourcePgnImport, Pgn: "[Date \"2021.05.31\"]\n[White \"bob\"]\n[Black \"alice\"]\n[Result \"*\"]\n\n1. e4 Nc6 2. Qh5 e5 *"},
+		storedGame{ID: "pgn:not-club", Source: GameSourcePgnImport, Pgn: "[White \"alice\"]\n[Black \"mallory\"]\n[Result \"*\"]\n\n1. e4 e5 2. Qh5 Nc6 *"},
+	)
+	if err != nil {
+		t.Fatalf("add() error = %s", err)
+	}
+
+	// The index is rebuilt when the store is loaded.
+	s, err = newGameStore(path)
+	if err != nil {
+		t.Fatalf("newGameStore() error = %s", err)
+	}
+
+	pos, err := positionFromMoves("1. e4 e5 2. Qh5 Nc6")
+	if err != nil {
+		t.Fatalf("positionFromMoves() error = %s", err)
+	}
+
+	matches := s.searchPosition([]string{"alice", "bob"}, pos)
+
+	got := []string{}
+	for _, match := range matches {
+		got = append(got, match.Game.URL+" "+match.Move())
+	}
+
+	// Most recent first, the other game transposed.
+	want := []string{"pgn:other-order 2... e5", "pgn:scholars-mate 2... Nc6"}
+	if strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Errorf("searchPosition() = %v, want %v", got, want)
+	}
+
+	if matches := s.searchPosition([]string{"alice", "bob"}, mustPositionFromMoves(t, "1. d4")); len(matches) != 0 {
+		t.Errorf("searchPosition() found %d games for a position no game reached", len(matches))
+	}
+}
+
+func mustPositionFromMoves(t *testing.T, moves string) *chess.Position {
+	t.Helper()
+
+	pos, err := positionFromMoves(moves)
+	if err != nil {
+		t.Fatalf("positionFromMoves(%q) error = %s", moves, err)
+	}
+
+	return pos
+}
+
+func TestGetSearchHTML(t *testing.T) {
+	newFakeChessCom(t, fakeChessComFixtures, "alice", "bob", "carol")
+
+	_, err := store.add(storedGame{ID: "pgn:scholars-mate", Source: GameSourcePgnImport, Pgn: scholarsMatePgn})
+	if err != nil {
+		t.Fatalf("could not add game to the store: %s", err)
+	}
+
+	tests := []struct {
+		query    string
+		wantCode int
+		wantBody string
+	}{
+		{query: "moves=1.+e4+e5+2.+Qh5", wantCode: http.StatusOK, wantBody: `<a href="game?id=pgn%3ascholars-mate&ply=3">2. Qh5</a>`},
+		{query: "fen=r1bqkb1r%2Fpppp1Qpp%2F2n2n2%2F4p3%2F2B1P3%2F8%2FPPPP1PPP%2FRNB1K1NR+b+KQkq+-+0+4", wantCode: http.StatusOK, wantBody: `<a href="game?id=pgn%3ascholars-mate&ply=7">4. Qxf7#</a>`},
+		{query: "moves=1.+d4", wantCode: http.StatusOK, wantBody: "No club game reached this position."},
+		{query: "", wantCode: http.StatusOK, wantBody: `<form method="GET" action="search">`},
+		{query: "moves=1.+e5", wantCode: http.StatusBadRequest, wantBody: "could not play e5"},
+		{query: "moves=1.+e4&fen=8%2F8%2F8%2F8%2F8%2F8%2F8%2F8+w+-+-+0+1", wantCode: http.StatusBadRequest, wantBody: "not both"},
+	}
+
+	for _, tt := range tests {
+		rec := httptest.NewRecorder()
+		getSearchHTML(rec, httptest.NewRequest(http.MethodGet, "/search?"+tt.query, nil))
+
+		if rec.Code != tt.wantCode {
+			t.Errorf("GET /search?%s = %d, want %d", tt.query, rec.Code, tt.wantCode)
+		}
+		if !strings.Contains(rec.Body.String(), tt.wantBody) {
+			t.Errorf("GET /search?%s does not contain %s", tt.query, tt.wantBody)
+		}
+	}
+}
@@ -1,12 +1,19 @@
 package main
 
-import "net/http"
+import (
+	"net/http"
+
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
 
 type route struct {
 	name        string
 	method      string
 	pattern     string
 	handlerFunc http.HandlerFunc
+
+	// adminOnly routes require the admin password. See requireAdmin.
+	adminOnly bool
 }
 
 var routes = []route{
@@ -31,6 +38,97 @@ var routes = []route{
 		handlerFunc: getGamesForMonthHTML,
 	},
 
+	{
+		name:        "getGameHTML",
+		method:      "GET",
+		pattern:     "/game",
+		handlerFunc: getGameHTML,
+	},
+
+	{
+		name:        "getGamePositionImage",
+		method:      "GET",
+		pattern:     "/game/position",
+		handlerFunc: getGamePositionImage,
+	},
+
+	{
+		name:        "getOpeningsHTML",
+		method:      "GET",
+		pattern:     "/openings",
+		handlerFunc: getOpeningsHTML,
+	},
+
+	{
+		name:        "getSearchHTML",
+		method:      "GET",
+		pattern:     "/search",
+		handlerFunc: getSearchHTML,
+	},
+
+	{
+		name:        "getTerminationsHTML",
+		method:      "GET",
+		pattern:     "/terminations",
+		handlerFunc: getTerminationsHTML,
+	},
+
+	{
+		name:        "importGamesHandler",
+		method:      "POST",
+		pattern:     "/games/import",
+		handlerFunc: importGamesHandler,
+		adminOnly:   true,
+	},
+
+	{
+		name:        "getOTBGameForm",
+		method:      "GET",
+		pattern:     "/otb",
+		handlerFunc: getOTBGameForm,
+		adminOnly:   true,
+	},
+
+	{
+		name:        "createOTBGameHandler",
+		method:      "POST",
+		pattern:     "/otb",
+		handlerFunc: createOTBGameHandler,
+		adminOnly:   true,
+	},
+
+	{
+		name:        "getConfigHandler",
+		method:      "GET",
+		pattern:     "/config",
+		handlerFunc: getConfigHandler,
+		adminOnly:   true,
+	},
+
+	{
+		name:        "getCacheStatsHandler",
+		method:      "GET",
+		pattern:     "/cache/stats",
+		handlerFunc: getCacheStatsHandler,
+		adminOnly:   true,
+	},
+
+	{
+		name:        "getDiagnosticsHTML",
+		method:      "GET",
+		pattern:     "/diagnostics",
+		handlerFunc: getDiagnosticsHTML,
+		adminOnly:   true,
+	},
+
+	{
+		name:        "metrics",
+		method:      "GET",
+		pattern:     "/metrics",
+		handlerFunc: promhttp.Handler().ServeHTTP,
+		adminOnly:   true,
+	},
+
 	{
 		name:        "getFaviconHandler",
 		method:      "GET",
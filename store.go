@@ -0,0 +1,301 @@
+package main
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	GameSourceChessCom  = "chess.com"
+	GameSourcePgnImport = "pgn-import"
+	GameSourceOTB       = "otb"
+)
+
+// storedGame is the on-disk representation of a game in the game store.
+// Only the raw PGN is persisted, the chess.Game is rebuilt on load.
+type storedGame struct {
+	ID      string    `json:"id"`
+	Source  string    `json:"source"`
+	Pgn     string    `json:"pgn"`
+	AddedAt time.Time `json:"added_at"`
+
+	ChessComFinishedGame *chessComFinishedGame `json:"chess_com_finished_game,omitempty"`
+}
+
+// gameStore keeps the games imported from PGN, the over the board
+// games and the chess.com games saved by the sync command, so they
+// can be grouped alongside the games fetched from chess.com.
+// Games are persisted as JSON to path.
+type gameStore struct {
+	path string
+
+	mutex  sync.RWMutex
+	games  map[string]storedGame
+	parsed map[string]chessGame
+
+	// positions indexes every position of the games by
+	// positionHash, to search games by position.
+	positions map[uint64][]positionHit
+}
+
+// store is the game store used by the handlers. It is initialized in main.
+var store = &gameStore{
+	games:     make(map[string]storedGame),
+	parsed:    make(map[string]chessGame),
+	positions: make(map[uint64][]positionHit),
+}
+
+// newGameStore returns a game store backed by the file in path.
+// If the file exists, all games in it are loaded and parsed.
+func newGameStore(path string) (*gameStore, error) {
+	s := &gameStore{
+		path:      path,
+		games:     make(map[string]storedGame),
+		parsed:    make(map[string]chessGame),
+		positions: make(map[uint64][]positionHit),
+	}
+
+	fileBytes, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("could not read game store %s: %w", path, err)
+	}
+
+	records := []storedGame{}
+	err = json.Unmarshal(fileBytes, &records)
+	if err != nil {
+		return nil, fmt.Errorf("could not unmarshal game store %s: %w", path, err)
+	}
+
+	for _, record := range records {
+		game, err := record.chessGame()
+		if err != nil {
+			return nil, fmt.Errorf("could not load game %s from game store: %w", record.ID, err)
+		}
+
+		s.games[record.ID] = record
+		s.parsed[record.ID] = game
+		s.indexPositionsLocked(record.ID, game)
+	}
+
+	return s, nil
+}
+
+// chessGame parses the PGN of the stored game and returns it as a chessGame.
+// Games synced from chess.com fall back to the position and results
+// reported by chess.com when their PGN cannot be parsed. Their parse
+// failures were recorded when they were fetched, not again here.
+func (g storedGame) chessGame() (chessGame, error) {
+	var game chessGame
+	var err error
+	if g.ChessComFinishedGame != nil {
+		game, _, err = buildChessComFinishedGame(g.ChessComFinishedGame)
+	} else {
+		game, err = getChessGame(g.Pgn)
+	}
+	if err != nil {
+		return chessGame{}, err
+	}
+
+	game.URL = g.ID
+	game.Source = g.Source
+
+	return game, nil
+}
+
+// pgnGameID returns the ID used to store a game built from pgnString.
+// The Link tag is used when present so the same game imported from
+// different places is only stored once.
+func pgnGameID(game chessGame, pgnString string) string {
+	if game.PgnParsed.Link != "" {
+		return game.PgnParsed.Link
+	}
+
+	hash := sha1.Sum([]byte(strings.TrimSpace(pgnString)))
+	return "pgn:" + hex.EncodeToString(hash[:])
+}
+
+// add parses the PGN of each record and adds those not already
+// in the store. The store is saved to disk if anything was added.
+// It returns the number of games added.
+func (s *gameStore) add(records ...storedGame) (int, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	added := 0
+	for _, record := range records {
+		if _, ok := s.games[record.ID]; ok {
+			continue
+		}
+
+		game, err := record.chessGame()
+		if err != nil {
+			return added, fmt.Errorf("could not add game %s to game store: %w", record.ID, err)
+		}
+
+		if record.AddedAt.IsZero() {
+			record.AddedAt = time.Now()
+		}
+
+		s.games[record.ID] = record
+		s.parsed[record.ID] = game
+		s.indexPositionsLocked(record.ID, game)
+		added++
+	}
+
+	if added == 0 {
+		return 0, nil
+	}
+
+	// Months already assembled may be missing the new games.
+	monthGroups.clear()
+
+	return added, s.saveLocked()
+}
+
+// chessComGameRecords returns the records to add to the game store
+// for the finished chess.com games between users in games.
+func chessComGameRecords(users []string, games []chessGame) []storedGame {
+	records := []storedGame{}
+	for _, game := range games {
+		if !isClubGame(users, game) || game.ChessComFinishedGame == nil {
+			continue
+		}
+
+		records = append(records, storedGame{
+			ID:                   game.URL,
+			Source:               GameSourceChessCom,
+			Pgn:                  game.ChessComFinishedGame.Pgn,
+			ChessComFinishedGame: game.ChessComFinishedGame,
+		})
+	}
+
+	return records
+}
+
+// indexPositionsLocked adds the positions of game to the position
+// index. The caller must hold the lock.
+func (s *gameStore) indexPositionsLocked(id string, game chessGame) {
+	for hash, ply := range indexGamePositions(game) {
+		s.positions[hash] = append(s.positions[hash], positionHit{
+			GameID: id,
+			Ply:    ply,
+		})
+	}
+}
+
+// has returns whether a game with the passed ID is in the store.
+func (s *gameStore) has(id string) bool {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	_, ok := s.games[id]
+	return ok
+}
+
+// get returns the game with the passed ID.
+func (s *gameStore) get(id string) (chessGame, bool) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	game, ok := s.parsed[id]
+	return game, ok
+}
+
+// allGames returns every game in the store.
+func (s *gameStore) allGames() []chessGame {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	games := make([]chessGame, 0, len(s.parsed))
+	for _, game := range s.parsed {
+		games = append(games, game)
+	}
+
+	return games
+}
+
+// gamesForYearMonth returns the games in the store that ended
+// in the passed year and month.
+func (s *gameStore) gamesForYearMonth(year, month int) []chessGame {
+	games := []chessGame{}
+	for _, game := range s.allGames() {
+		endTime := game.PgnParsed.ParsedEndtime
+		if endTime.Year() == year && int(endTime.Month()) == month {
+			games = append(games, game)
+		}
+	}
+
+	return games
+}
+
+// yearMonths returns the months with games in the store as "YYYYMM"
+// strings. If onlineOnly is set, over the board games are left out.
+func (s *gameStore) yearMonths(onlineOnly bool) []string {
+	yearMonthMap := make(map[string]struct{})
+	for _, game := range s.allGames() {
+		endTime := game.PgnParsed.ParsedEndtime
+		if endTime.IsZero() || (onlineOnly && game.Source == GameSourceOTB) {
+			continue
+		}
+
+		yearMonthMap[yearMonthString(endTime.Year(), int(endTime.Month()))] = struct{}{}
+	}
+
+	yearMonths := make([]string, 0, len(yearMonthMap))
+	for yearMonth := range yearMonthMap {
+		yearMonths = append(yearMonths, yearMonth)
+	}
+
+	return yearMonths
+}
+
+// saveLocked writes the store to disk. The caller must hold the lock.
+func (s *gameStore) saveLocked() error {
+	if s.path == "" {
+		return nil
+	}
+
+	records := make([]storedGame, 0, len(s.games))
+	for _, record := range s.games {
+		records = append(records, record)
+	}
+
+	sort.Slice(records, func(i, j int) bool { return records[i].ID < records[j].ID })
+
+	fileBytes, err := json.MarshalIndent(records, "", "  ")
+	if err != nil {
+		return fmt.Errorf("could not marshal game store: %w", err)
+	}
+
+	err = os.MkdirAll(filepath.Dir(s.path), 0755)
+	if err != nil {
+		return fmt.Errorf("could not create game store directory: %w", err)
+	}
+
+	// Write to a temporary file first so a crash never leaves
+	// a half written store behind.
+	tmpPath := s.path + ".tmp"
+	err = ioutil.WriteFile(tmpPath, fileBytes, 0644)
+	if err != nil {
+		return fmt.Errorf("could not write game store %s: %w", tmpPath, err)
+	}
+
+	err = os.Rename(tmpPath, s.path)
+	if err != nil {
+		return fmt.Errorf("could not rename game store %s: %w", tmpPath, err)
+	}
+
+	return nil
+}
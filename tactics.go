@@ -0,0 +1,310 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/notnil/chess"
+)
+
+// Tactical motifs found in games without an engine.
+const (
+	MotifMissedMate   = "missed-mate"
+	MotifHangingPiece = "hanging-piece"
+	MotifFork         = "fork"
+	MotifBackRankMate = "back-rank-mate"
+)
+
+// gameHighlight is a tactical motif found at a move of a game.
+type gameHighlight struct {
+	// Ply is the number of the move, starting at 1, and
+	// Move is the move as written in the game, such as "3... Nf6".
+	Ply   int
+	Move  string
+	Motif string
+
+	Description string
+}
+
+// pieceValues are the usual values of the pieces in pawns. Kings
+// are worth nothing, forks check whether a king is attacked first.
+var pieceValues = map[chess.PieceType]int{
+	chess.Queen:  9,
+	chess.Rook:   5,
+	chess.Bishop: 3,
+	chess.Knight: 3,
+	chess.Pawn:   1,
+}
+
+var pieceNames = map[chess.PieceType]string{
+	chess.King:   "king",
+	chess.Queen:  "queen",
+	chess.Rook:   "rook",
+	chess.Bishop: "bishop",
+	chess.Knight: "knight",
+	chess.Pawn:   "pawn",
+}
+
+var (
+	knightOffsets = [][2]int{{1, 2}, {2, 1}, {2, -1}, {1, -2}, {-1, -2}, {-2, -1}, {-2, 1}, {-1, 2}}
+	kingOffsets   = [][2]int{{1, 0}, {1, 1}, {0, 1}, {-1, 1}, {-1, 0}, {-1, -1}, {0, -1}, {1, -1}}
+	rookLines     = [][2]int{{1, 0}, {0, 1}, {-1, 0}, {0, -1}}
+	bishopLines   = [][2]int{{1, 1}, {-1, 1}, {-1, -1}, {1, -1}}
+)
+
+// offsetSquare returns the square file and rank steps away from sq,
+// false if it is off the board.
+func offsetSquare(sq chess.Square, file, rank int) (chess.Square, bool) {
+	f, r := int(sq.File())+file, int(sq.Rank())+rank
+	if f < 0 || f > 7 || r < 0 || r > 7 {
+		return 0, false
+	}
+
+	return chess.Square(r*8 + f), true
+}
+
+// attackedSquares returns the squares the piece on sq attacks,
+// whether they are empty or not. Pins are not taken into account.
+func attackedSquares(board *chess.Board, sq chess.Square) []chess.Square {
+	piece := board.Piece(sq)
+
+	squares := []chess.Square{}
+	jump := func(offsets [][2]int) {
+		for _, offset := range offsets {
+			if target, ok := offsetSquare(sq, offset[0], offset[1]); ok {
+				squares = append(squares, target)
+			}
+		}
+	}
+	slide := func(lines [][2]int) {
+		for _, line := range lines {
+			target, ok := offsetSquare(sq, line[0], line[1])
+			for ok {
+				squares = append(squares, target)
+				if board.Piece(target) != chess.NoPiece {
+					break
+				}
+				target, ok = offsetSquare(target, line[0], line[1])
+			}
+		}
+	}
+
+	switch piece.Type() {
+	case chess.Pawn:
+		forward := 1
+		if piece.Color() == chess.Black {
+			forward = -1
+		}
+		jump([][2]int{{-1, forward}, {1, forward}})
+	case chess.Knight:
+		jump(knightOffsets)
+	case chess.King:
+		jump(kingOffsets)
+	case chess.Bishop:
+		slide(bishopLines)
+	case chess.Rook:
+		slide(rookLines)
+	case chess.Queen:
+		slide(rookLines)
+		slide(bishopLines)
+	}
+
+	return squares
+}
+
+// isDefended returns whether a piece of color attacks sq.
+func isDefended(board *chess.Board, sq chess.Square, color chess.Color) bool {
+	for from, piece := range board.SquareMap() {
+		if piece.Color() != color || from == sq {
+			continue
+		}
+
+		for _, target := range attackedSquares(board, from) {
+			if target == sq {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// findMateInOne returns a move giving checkmate in pos, nil if there is none.
+func findMateInOne(pos *chess.Position) *chess.Move {
+	for _, move := range pos.ValidMoves() {
+		if !move.HasTag(chess.Check) {
+			continue
+		}
+
+		if pos.Update(move).Status() == chess.Checkmate {
+			return move
+		}
+	}
+
+	return nil
+}
+
+// isBackRankMate returns whether move, which gave checkmate in next,
+// is a rook or queen mating the king on its first rank.
+func isBackRankMate(next *chess.Position, move *chess.Move) bool {
+	board := next.Board()
+
+	mated := next.Turn()
+	backRank := chess.Rank1
+	if mated == chess.Black {
+		backRank = chess.Rank8
+	}
+
+	var kingSquare chess.Square
+	for sq, piece := range board.SquareMap() {
+		if piece.Type() == chess.King && piece.Color() == mated {
+			kingSquare = sq
+		}
+	}
+
+	mating := board.Piece(move.S2()).Type()
+	return kingSquare.Rank() == backRank &&
+		move.S2().Rank() == backRank &&
+		(mating == chess.Rook || mating == chess.Queen)
+}
+
+// forkedPieces returns the pieces forked by the piece on sq: the king,
+// and pieces worth more than the forking piece or left undefended.
+// Pawns are left out, it is a fork when at least two pieces are returned.
+func forkedPieces(board *chess.Board, sq chess.Square) []chess.PieceType {
+	forker := board.Piece(sq)
+
+	forked := []chess.PieceType{}
+	for _, target := range attackedSquares(board, sq) {
+		piece := board.Piece(target)
+		if piece == chess.NoPiece || piece.Color() == forker.Color() || piece.Type() == chess.Pawn {
+			continue
+		}
+
+		if piece.Type() == chess.King ||
+			pieceValues[piece.Type()] > pieceValues[forker.Type()] ||
+			!isDefended(board, target, piece.Color()) {
+			forked = append(forked, piece.Type())
+		}
+	}
+
+	// Name the king first, then by value.
+	sort.Slice(forked, func(i, j int) bool {
+		if forked[i] == chess.King || forked[j] == chess.King {
+			return forked[i] == chess.King
+		}
+		return pieceValues[forked[i]] > pieceValues[forked[j]]
+	})
+
+	return forked
+}
+
+// hungPiece returns the piece captured by moves[ply-1] when it was left
+// undefended by the move before it, NoPiece otherwise. Pawns and trades,
+// where the piece was left undefended by capturing as much, are left out.
+func hungPiece(positions []*chess.Position, moves []*chess.Move, ply int) chess.Piece {
+	move := moves[ply-1]
+	if ply < 2 || !move.HasTag(chess.Capture) || move.HasTag(chess.EnPassant) {
+		return chess.NoPiece
+	}
+
+	board := positions[ply-1].Board()
+	captured := board.Piece(move.S2())
+	if captured.Type() == chess.Pawn || isDefended(board, move.S2(), captured.Color()) {
+		return chess.NoPiece
+	}
+
+	// The piece was hanging before the previous move too.
+	before := positions[ply-2].Board()
+	if before.Piece(move.S2()) == captured && !isDefended(before, move.S2(), captured.Color()) {
+		return chess.NoPiece
+	}
+
+	previous := moves[ply-2]
+	if previous.HasTag(chess.Capture) && pieceValues[before.Piece(previous.S2()).Type()] >= pieceValues[captured.Type()] {
+		return chess.NoPiece
+	}
+
+	return captured
+}
+
+// joinNames returns names as "a, b and c".
+func joinNames(names []string) string {
+	if len(names) < 2 {
+		return strings.Join(names, "")
+	}
+
+	return strings.Join(names[:len(names)-1], ", ") + " and " + names[len(names)-1]
+}
+
+// fullMoveNumber returns the number of the move to be played in pos,
+// which is not 1 for games set up from a FEN.
+func fullMoveNumber(pos *chess.Position) int {
+	fields := strings.Fields(pos.String())
+	if len(fields) < 6 {
+		return 1
+	}
+
+	moveNumber, err := strconv.Atoi(fields[5])
+	if err != nil || moveNumber < 1 {
+		return 1
+	}
+
+	return moveNumber
+}
+
+// getGameHighlights finds missed mates in one, hanging pieces which
+// were taken right away, forks and back-rank mates in game, in the
+// order they were played.
+func getGameHighlights(game chessGame) []gameHighlight {
+	positions := game.ChessGame.Positions()
+	moves := game.ChessGame.Moves()
+
+	highlights := []gameHighlight{}
+	moveNumber := fullMoveNumber(positions[0])
+	for i, move := range moves {
+		pos, next := positions[i], positions[i+1]
+
+		moveString := fmt.Sprintf("%d. %s", moveNumber, chess.AlgebraicNotation{}.Encode(pos, move))
+		if pos.Turn() == chess.Black {
+			moveString = fmt.Sprintf("%d... %s", moveNumber, chess.AlgebraicNotation{}.Encode(pos, move))
+			moveNumber++
+		}
+
+		highlight := func(motif, description string) {
+			highlights = append(highlights, gameHighlight{
+				Ply:         i + 1,
+				Move:        moveString,
+				Motif:       motif,
+				Description: description,
+			})
+		}
+
+		if next.Status() == chess.Checkmate {
+			if isBackRankMate(next, move) {
+				highlight(MotifBackRankMate, "mates on the back rank")
+			}
+			continue
+		}
+
+		if mate := findMateInOne(pos); mate != nil {
+			highlight(MotifMissedMate, fmt.Sprintf("misses mate in one with %s", chess.AlgebraicNotation{}.Encode(pos, mate)))
+		}
+
+		if captured := hungPiece(positions, moves, i+1); captured != chess.NoPiece {
+			highlight(MotifHangingPiece, fmt.Sprintf("takes the %s left hanging on %s", pieceNames[captured.Type()], move.S2()))
+		}
+
+		if forked := forkedPieces(next.Board(), move.S2()); len(forked) >= 2 {
+			names := make([]string, len(forked))
+			for j, pieceType := range forked {
+				names[j] = pieceNames[pieceType]
+			}
+			highlight(MotifFork, fmt.Sprintf("forks the %s", joinNames(names)))
+		}
+	}
+
+	return highlights
+}
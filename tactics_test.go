@@ -0,0 +1,83 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestGetGameHighlights(t *testing.T) {
+	tests := []struct {
+		name string
+		pgn  string
+		want []gameHighlight
+	}{
+		{
+			name: "missed mate in one",
+			pgn:  "1. e4 e5 2. Bc4 Nc6 3. Qh5 Nf6 4. Qf3 *",
+			want: []gameHighlight{
+				{Ply: 7, Move: "4. Qf3", Motif: MotifMissedMate, Description: "misses mate in one with Qxf7#"},
+			},
+		},
+		{
+			name: "hanging piece",
+			pgn:  "1. e4 e5 2. Nf3 Nc6 3. Nxe5 Nxe5 *",
+			want: []gameHighlight{
+				{Ply: 6, Move: "3... Nxe5", Motif: MotifHangingPiece, Description: "takes the knight left hanging on e5"},
+			},
+		},
+		{
+			name: "trade",
+			pgn:  "1. e4 e5 2. Nf3 Nc6 3. Bb5 a6 4. Bxc6 dxc6 *",
+			want: []gameHighlight{},
+		},
+		{
+			name: "fork",
+			pgn: `[FEN "r3k3/8/8/3N4/8/8/8/4K3 w - - 0 1"]
+[SetUp "1"]
+
+1. Nc7+ *`,
+			want: []gameHighlight{
+				{Ply: 1, Move: "1. Nc7+", Motif: MotifFork, Description: "forks the king and rook"},
+			},
+		},
+		{
+			name: "fork with Black to move",
+			pgn: `[FEN "4k3/8/8/8/3n4/8/8/R3K3 b - - 5 23"]
+[SetUp "1"]
+
+23... Nc2+ *`,
+			want: []gameHighlight{
+				{Ply: 1, Move: "23... Nc2+", Motif: MotifFork, Description: "forks the king and rook"},
+			},
+		},
+		{
+			name: "back-rank mate",
+			pgn: `[FEN "6k1/5ppp/8/8/8/8/5PPP/3R2K1 w - - 0 31"]
+[SetUp "1"]
+
+31. Rd8# 1-0`,
+			want: []gameHighlight{
+				{Ply: 1, Move: "31. Rd8#", Motif: MotifBackRankMate, Description: "mates on the back rank"},
+			},
+		},
+		{
+			name: "scholar's mate",
+			pgn:  scholarsMatePgn,
+			want: []gameHighlight{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			game, err := getChessGame(tt.pgn)
+			if err != nil {
+				t.Fatalf("could not parse pgn: %s", err)
+			}
+
+			got := getGameHighlights(game)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("getGameHighlights() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
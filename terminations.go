@@ -0,0 +1,236 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/notnil/chess"
+)
+
+// Ways a game ended, see pgnParsed.EndedBy.
+const (
+	TerminationCheckmate    = "checkmate"
+	TerminationResignation  = "resignation"
+	TerminationTimeout      = "timeout"
+	TerminationAbandoned    = "abandoned"
+	TerminationAgreement    = "agreement"
+	TerminationRepetition   = "repetition"
+	TerminationInsufficient = "insufficient"
+	TerminationStalemate    = "stalemate"
+	TerminationFiftyMove    = "50move"
+	TerminationOther        = "other"
+)
+
+var (
+	// decisiveTerminations are the ways a game is won or lost,
+	// drawTerminations the ways it is drawn, in the order
+	// they are listed in the breakdowns.
+	decisiveTerminations = []string{
+		TerminationCheckmate,
+		TerminationResignation,
+		TerminationTimeout,
+		TerminationAbandoned,
+		TerminationOther,
+	}
+	drawTerminations = []string{
+		TerminationAgreement,
+		TerminationRepetition,
+		TerminationInsufficient,
+		TerminationStalemate,
+		TerminationFiftyMove,
+		TerminationOther,
+	}
+
+	terminationLabels = map[string]string{
+		TerminationCheckmate:    "checkmate",
+		TerminationResignation:  "resignation",
+		TerminationTimeout:      "timeout",
+		TerminationAbandoned:    "abandoned",
+		TerminationAgreement:    "agreement",
+		TerminationRepetition:   "repetition",
+		TerminationInsufficient: "insufficient material",
+		TerminationStalemate:    "stalemate",
+		TerminationFiftyMove:    "50-move rule",
+		TerminationOther:        "other",
+	}
+)
+
+// chessComTerminations maps the result chess.com reports for the
+// player who lost, or for both players of a draw, to how the game
+// ended. A draw because a player ran out of time against a lone
+// king is an insufficient material draw.
+var chessComTerminations = map[string]string{
+	ChessComResultCheckmated:         TerminationCheckmate,
+	ChessComResultResigned:           TerminationResignation,
+	ChessComResultTimeout:            TerminationTimeout,
+	ChessComResultAbandoned:          TerminationAbandoned,
+	ChessComResultAgreed:             TerminationAgreement,
+	ChessComResultRepetition:         TerminationRepetition,
+	ChessComResultInsufficient:       TerminationInsufficient,
+	ChessComResultTimeVsInsufficient: TerminationInsufficient,
+	ChessComResultStalemate:          TerminationStalemate,
+	ChessComResultFiftyMove:          TerminationFiftyMove,
+}
+
+// terminationFromChessCom returns how finishedGame ended
+// from the results chess.com reports for its players.
+func terminationFromChessCom(finishedGame *chessComFinishedGame) string {
+	result := finishedGame.White.Result
+	if result == ChessComResultWin {
+		result = finishedGame.Black.Result
+	}
+
+	if termination, ok := chessComTerminations[result]; ok {
+		return termination
+	}
+
+	return TerminationOther
+}
+
+// chessMethodTerminations maps how notnil/chess says a game ended
+// to how it is counted.
+var chessMethodTerminations = map[chess.Method]string{
+	chess.Checkmate:            TerminationCheckmate,
+	chess.Resignation:          TerminationResignation,
+	chess.DrawOffer:            TerminationAgreement,
+	chess.Stalemate:            TerminationStalemate,
+	chess.ThreefoldRepetition:  TerminationRepetition,
+	chess.FivefoldRepetition:   TerminationRepetition,
+	chess.FiftyMoveRule:        TerminationFiftyMove,
+	chess.SeventyFiveMoveRule:  TerminationFiftyMove,
+	chess.InsufficientMaterial: TerminationInsufficient,
+}
+
+// terminationTagKeywords are looked for, in order, in the Termination
+// tag of games which did not end on the board, such as
+// "alice won on time" or "Game drawn by repetition". Insufficient
+// material comes first, "timeout vs insufficient material" is a draw.
+var terminationTagKeywords = []struct {
+	keyword     string
+	termination string
+}{
+	{"insufficient", TerminationInsufficient},
+	{"checkmate", TerminationCheckmate},
+	{"resign", TerminationResignation},
+	{"abandon", TerminationAbandoned},
+	{"on time", TerminationTimeout},
+	{"time forfeit", TerminationTimeout},
+	{"timeout", TerminationTimeout},
+	{"agreement", TerminationAgreement},
+	{"repetition", TerminationRepetition},
+	{"stalemate", TerminationStalemate},
+	{"50-move", TerminationFiftyMove},
+	{"50 move", TerminationFiftyMove},
+	{"fifty", TerminationFiftyMove},
+}
+
+// terminationFromPgn returns how game ended from its final position,
+// then from its Termination tag. It is empty for games in progress.
+func terminationFromPgn(game *chess.Game, parsedPgn pgnParsed) string {
+	if parsedPgn.Result != PgnResultWhiteWin && parsedPgn.Result != PgnResultBlackWin && parsedPgn.Result != PgnResultDraw {
+		return ""
+	}
+
+	if termination, ok := chessMethodTerminations[game.Method()]; ok {
+		return termination
+	}
+
+	tag := strings.ToLower(parsedPgn.Termination)
+	for _, k := range terminationTagKeywords {
+		if strings.Contains(tag, k.keyword) {
+			return k.termination
+		}
+	}
+
+	return TerminationOther
+}
+
+// terminationStats counts the games of a player won, lost and drawn
+// by how they ended, keyed by termination.
+type terminationStats struct {
+	Wins   map[string]int
+	Losses map[string]int
+	Draws  map[string]int
+}
+
+// add counts a game which ended by termination. win, loss and draw
+// are 1 for the result of the player, 0 otherwise. A termination
+// which does not match the result, such as a game won by agreement,
+// is counted as other so it still shows in the summaries.
+func (s *terminationStats) add(termination string, win, loss, draw int) {
+	if s.Wins == nil {
+		s.Wins = make(map[string]int)
+		s.Losses = make(map[string]int)
+		s.Draws = make(map[string]int)
+	}
+
+	terminations := decisiveTerminations
+	if draw > 0 {
+		terminations = drawTerminations
+	}
+	if !hasTermination(terminations, termination) {
+		termination = TerminationOther
+	}
+
+	s.Wins[termination] += win
+	s.Losses[termination] += loss
+	s.Draws[termination] += draw
+}
+
+// hasTermination reports whether termination is one of terminations.
+func hasTermination(terminations []string, termination string) bool {
+	for _, t := range terminations {
+		if t == termination {
+			return true
+		}
+	}
+
+	return false
+}
+
+// terminationSummary returns counts as "2 checkmate, 1 timeout",
+// listed in the order of terminations, or "-" if they are all 0.
+func terminationSummary(counts map[string]int, terminations []string) string {
+	parts := []string{}
+	for _, termination := range terminations {
+		if counts[termination] > 0 {
+			parts = append(parts, fmt.Sprintf("%d %s", counts[termination], terminationLabels[termination]))
+		}
+	}
+
+	if len(parts) == 0 {
+		return "-"
+	}
+
+	return strings.Join(parts, ", ")
+}
+
+// WinSummary returns how the games won ended, such as "2 checkmate, 1 timeout".
+func (s terminationStats) WinSummary() string {
+	return terminationSummary(s.Wins, decisiveTerminations)
+}
+
+// LossSummary returns how the games lost ended.
+func (s terminationStats) LossSummary() string {
+	return terminationSummary(s.Losses, decisiveTerminations)
+}
+
+// DrawSummary returns how the games drawn ended.
+func (s terminationStats) DrawSummary() string {
+	return terminationSummary(s.Draws, drawTerminations)
+}
+
+// getTerminationsData returns how the games of users played during p
+// ended, for the players ordered as in the standings.
+func getTerminationsData(users []string, p period, games []chessGame) terminationsData {
+	userStatsMap := newUserStatsMap(users)
+	for _, game := range games {
+		addGameToUserStats(userStatsMap, game)
+	}
+
+	return terminationsData{
+		Period:         p,
+		Games:          len(games),
+		UserStatistics: userStatsSlice(userStatsMap),
+	}
+}
@@ -0,0 +1,160 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestTerminationFromChessCom(t *testing.T) {
+	tests := []struct {
+		white string
+		black string
+		want  string
+	}{
+		{ChessComResultWin, ChessComResultCheckmated, TerminationCheckmate},
+		{ChessComResultResigned, ChessComResultWin, TerminationResignation},
+		{ChessComResultTimeout, ChessComResultWin, TerminationTimeout},
+		{ChessComResultWin, ChessComResultAbandoned, TerminationAbandoned},
+		{ChessComResultAgreed, ChessComResultAgreed, TerminationAgreement},
+		{ChessComResultRepetition, ChessComResultRepetition, TerminationRepetition},
+		{ChessComResultInsufficient, ChessComResultInsufficient, TerminationInsufficient},
+		{ChessComResultTimeVsInsufficient, ChessComResultTimeVsInsufficient, TerminationInsufficient},
+		{ChessComResultStalemate, ChessComResultStalemate, TerminationStalemate},
+		{ChessComResultFiftyMove, ChessComResultFiftyMove, TerminationFiftyMove},
+		{ChessComResultWin, "lose", TerminationOther},
+	}
+
+	for _, tt := range tests {
+		finishedGame := &chessComFinishedGame{}
+		finishedGame.White.Result = tt.white
+		finishedGame.Black.Result = tt.black
+
+		if got := terminationFromChessCom(finishedGame); got != tt.want {
+			t.Errorf("terminationFromChessCom(%s, %s) = %q, want %q", tt.white, tt.black, got, tt.want)
+		}
+	}
+}
+
+func TestTerminationFromPgn(t *testing.T) {
+	tests := []struct {
+		name string
+		pgn  string
+		want string
+	}{
+		{
+			name: "checkmate on the board",
+			pgn:  scholarsMatePgn,
+			want: TerminationCheckmate,
+		},
+		{
+			name: "stalemate on the board",
+			pgn: `[SetUp "1"]
+[FEN "7k/8/6Q1/8/8/8/8/K7 w - - 0 1"]
+[Result "1/2-1/2"]
+
+1. Qf7 1/2-1/2`,
+			want: TerminationStalemate,
+		},
+		{
+			name: "won on time",
+			pgn: `[Termination "alice won on time"]
+[Result "1-0"]
+
+1. e4 e5 1-0`,
+			want: TerminationTimeout,
+		},
+		{
+			name: "drawn by repetition",
+			pgn: `[Termination "Game drawn by repetition"]
+[Result "1/2-1/2"]
+
+1. Nf3 Nf6 2. Ng1 Ng8 3. Nf3 Nf6 1/2-1/2`,
+			want: TerminationRepetition,
+		},
+		{
+			name: "timeout vs insufficient material",
+			pgn: `[Termination "Game drawn by timeout vs insufficient material"]
+[Result "1/2-1/2"]
+
+1. e4 e5 1/2-1/2`,
+			want: TerminationInsufficient,
+		},
+		{
+			name: "abandoned",
+			pgn: `[Termination "bob won - game abandoned"]
+[Result "0-1"]
+
+1. e4 e5 0-1`,
+			want: TerminationAbandoned,
+		},
+		{
+			name: "over the board without termination",
+			pgn: `[Result "0-1"]
+
+1. e4 e5 0-1`,
+			want: TerminationOther,
+		},
+		{
+			name: "in progress",
+			pgn: `[Result "*"]
+
+1. e4 e5 *`,
+			want: "",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			game, err := getChessGame(tt.pgn)
+			if err != nil {
+				t.Fatalf("getChessGame() error = %v", err)
+			}
+
+			if game.PgnParsed.EndedBy != tt.want {
+				t.Errorf("EndedBy = %q, want %q", game.PgnParsed.EndedBy, tt.want)
+			}
+		})
+	}
+}
+
+func TestUserStatsTerminations(t *testing.T) {
+	userStatsMap := newUserStatsMap([]string{"alice", "bob"})
+
+	mate := scholarsMateGame(t)
+	addGameToUserStats(userStatsMap, mate)
+	addGameToUserStats(userStatsMap, mate)
+
+	timeout := mate
+	timeout.PgnParsed.EndedBy = TerminationTimeout
+	addGameToUserStats(userStatsMap, timeout)
+
+	draw := mate
+	draw.PgnParsed.Result = PgnResultDraw
+	draw.PgnParsed.EndedBy = TerminationRepetition
+	addGameToUserStats(userStatsMap, draw)
+
+	// Terminations which do not match the result are counted as other.
+	agreed := mate
+	agreed.PgnParsed.EndedBy = TerminationAgreement
+	addGameToUserStats(userStatsMap, agreed)
+
+	drawnOnTime := draw
+	drawnOnTime.PgnParsed.EndedBy = TerminationTimeout
+	addGameToUserStats(userStatsMap, drawnOnTime)
+
+	want := map[string][3]string{
+		"alice": {"2 checkmate, 1 timeout, 1 other", "-", "1 repetition, 1 other"},
+		"bob":   {"-", "2 checkmate, 1 timeout, 1 other", "1 repetition, 1 other"},
+	}
+
+	for _, stats := range userStatsSlice(userStatsMap) {
+		got := [3]string{
+			stats.Terminations.WinSummary(),
+			stats.Terminations.LossSummary(),
+			stats.Terminations.DrawSummary(),
+		}
+
+		if got != want[stats.User] {
+			t.Errorf("%s terminations = %q, want %q", stats.User, got, want[stats.User])
+		}
+	}
+}
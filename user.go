@@ -1,5 +1,17 @@
 package main
 
+import (
+	"math"
+	"sort"
+	"strings"
+)
+
+// Orders of the standings of a month.
+const (
+	StandingsWinPercentage = "winpct"
+	StandingsAccuracy      = "accuracy"
+)
+
 type userStats struct {
 	User          string
 	Wins          int
@@ -8,10 +20,242 @@ type userStats struct {
 	Points        float64
 	WinPercentage float64
 	WinStreak     int
+
+	// AnalyzedGames is how many of the games were analyzed by an
+	// engine, Analysis sums up the moves played in them.
+	AnalyzedGames   int
+	Analysis        playerAnalysis
+	BlundersPerGame float64
+
+	// Terminations breaks the wins, losses and draws down
+	// by how the games ended.
+	Terminations terminationStats
 }
 
 type userStatsByWinPercDesc []userStats
 
-func (a userStatsByWinPercDesc) Len() int           { return len(a) }
-func (a userStatsByWinPercDesc) Swap(i, j int)      { a[i], a[j] = a[j], a[i] }
-func (a userStatsByWinPercDesc) Less(i, j int) bool { return a[i].WinPercentage > a[j].WinPercentage }
+func (a userStatsByWinPercDesc) Len() int      { return len(a) }
+func (a userStatsByWinPercDesc) Swap(i, j int) { a[i], a[j] = a[j], a[i] }
+func (a userStatsByWinPercDesc) Less(i, j int) bool {
+	// Break ties by points then username so standings are
+	// always shown in the same order.
+	if a[i].WinPercentage != a[j].WinPercentage {
+		return a[i].WinPercentage > a[j].WinPercentage
+	}
+
+	if a[i].Points != a[j].Points {
+		return a[i].Points > a[j].Points
+	}
+
+	return strings.ToLower(a[i].User) < strings.ToLower(a[j].User)
+}
+
+// userStatsByAccuracy orders players with analyzed games by their
+// average centipawn loss, then best move rate and blunders per game.
+// Players without analyzed games come last, ordered by win percentage.
+type userStatsByAccuracy []userStats
+
+func (a userStatsByAccuracy) Len() int      { return len(a) }
+func (a userStatsByAccuracy) Swap(i, j int) { a[i], a[j] = a[j], a[i] }
+func (a userStatsByAccuracy) Less(i, j int) bool {
+	analyzedI, analyzedJ := a[i].AnalyzedGames > 0, a[j].AnalyzedGames > 0
+	if analyzedI != analyzedJ {
+		return analyzedI
+	}
+
+	if analyzedI {
+		if acplI, acplJ := a[i].Analysis.ACPL(), a[j].Analysis.ACPL(); acplI != acplJ {
+			return acplI < acplJ
+		}
+
+		if rateI, rateJ := a[i].Analysis.BestMoveRate(), a[j].Analysis.BestMoveRate(); rateI != rateJ {
+			return rateI > rateJ
+		}
+
+		if a[i].BlundersPerGame != a[j].BlundersPerGame {
+			return a[i].BlundersPerGame < a[j].BlundersPerGame
+		}
+	}
+
+	return userStatsByWinPercDesc(a).Less(i, j)
+}
+
+// sortUserStatsByAccuracy returns a copy of stats ordered
+// by userStatsByAccuracy.
+func sortUserStatsByAccuracy(stats []userStats) []userStats {
+	sorted := make([]userStats, len(stats))
+	copy(sorted, stats)
+
+	sort.Sort(userStatsByAccuracy(sorted))
+
+	return sorted
+}
+
+// newUserStatsMap returns an empty userStats for each user
+// keyed by the lowercase username.
+func newUserStatsMap(users []string) map[string]userStats {
+	userStatsMap := make(map[string]userStats)
+	for _, user := range users {
+		userStatsMap[strings.ToLower(user)] = userStats{
+			User: user,
+		}
+	}
+
+	return userStatsMap
+}
+
+// addGameToUserStats updates the stats of both players of game.
+// Games are expected to be added most recent first.
+func addGameToUserStats(userStatsMap map[string]userStats, game chessGame) {
+
+	// Get usernames
+	white := game.PgnParsed.White
+	black := game.PgnParsed.Black
+
+	whiteStats := userStatsMap[strings.ToLower(white)]
+	blackStats := userStatsMap[strings.ToLower(black)]
+
+	endedBy := game.PgnParsed.EndedBy
+
+	if game.PgnParsed.Result == PgnResultWhiteWin {
+		whiteStats.Wins++
+		whiteStats.Points += 1
+		blackStats.Losses++
+		whiteStats.Terminations.add(endedBy, 1, 0, 0)
+		blackStats.Terminations.add(endedBy, 0, 1, 0)
+
+		if whiteStats.Losses == 0 {
+			whiteStats.WinStreak++
+		}
+
+	} else if game.PgnParsed.Result == PgnResultBlackWin {
+		whiteStats.Losses++
+		blackStats.Wins++
+		blackStats.Points += 1
+		whiteStats.Terminations.add(endedBy, 0, 1, 0)
+		blackStats.Terminations.add(endedBy, 1, 0, 0)
+
+		if blackStats.Losses == 0 {
+			blackStats.WinStreak++
+		}
+
+	} else if game.PgnParsed.Result == PgnResultDraw {
+		whiteStats.Draws++
+		whiteStats.Points += 0.5
+		blackStats.Draws++
+		blackStats.Points += 0.5
+		whiteStats.Terminations.add(endedBy, 0, 0, 1)
+		blackStats.Terminations.add(endedBy, 0, 0, 1)
+	}
+
+	if game.Analysis != nil {
+		whiteAnalysis, blackAnalysis := game.Analysis.playerAnalyses()
+
+		whiteStats.AnalyzedGames++
+		whiteStats.Analysis.add(whiteAnalysis)
+		blackStats.AnalyzedGames++
+		blackStats.Analysis.add(blackAnalysis)
+	}
+
+	userStatsMap[strings.ToLower(white)] = whiteStats
+	userStatsMap[strings.ToLower(black)] = blackStats
+}
+
+// userStatsSlice calculates the win percentage and blunders per
+// analyzed game of every user who played at least one game and
+// returns them sorted by win percentage.
+func userStatsSlice(userStatsMap map[string]userStats) []userStats {
+	statsSlice := make([]userStats, 0)
+	for _, stats := range userStatsMap {
+
+		totalGamesPlayed := float64(stats.Wins) + float64(stats.Losses) + float64(stats.Draws)
+
+		if totalGamesPlayed == 0 {
+			continue
+		}
+
+		wins := float64(stats.Wins)
+
+		stats.WinPercentage = math.Round(100*(wins/totalGamesPlayed)*100.0) / 100
+
+		if stats.AnalyzedGames > 0 {
+			blunders := float64(stats.Analysis.Blunders)
+			stats.BlundersPerGame = math.Round(blunders/float64(stats.AnalyzedGames)*100.0) / 100
+		}
+
+		statsSlice = append(statsSlice, stats)
+	}
+
+	sort.Sort(userStatsByWinPercDesc(statsSlice))
+
+	return statsSlice
+}
+
+// headToHeadStats is the record of Player against Opponent.
+type headToHeadStats struct {
+	Player   string
+	Opponent string
+	Wins     int
+	Losses   int
+	Draws    int
+}
+
+// getHeadToHeadStats returns the record of every user against every
+// other user they played in games, sorted by player and opponent.
+func getHeadToHeadStats(users []string, games []chessGame) []headToHeadStats {
+	type pair struct {
+		player   string
+		opponent string
+	}
+
+	headToHeadMap := make(map[pair]headToHeadStats)
+	record := func(player, opponent string, win, loss, draw int) {
+		key := pair{strings.ToLower(player), strings.ToLower(opponent)}
+		stats, ok := headToHeadMap[key]
+		if !ok {
+			stats = headToHeadStats{
+				Player:   player,
+				Opponent: opponent,
+			}
+		}
+
+		stats.Wins += win
+		stats.Losses += loss
+		stats.Draws += draw
+		headToHeadMap[key] = stats
+	}
+
+	for _, game := range games {
+		if !isClubGame(users, game) {
+			continue
+		}
+
+		white := game.PgnParsed.White
+		black := game.PgnParsed.Black
+
+		if game.PgnParsed.Result == PgnResultWhiteWin {
+			record(white, black, 1, 0, 0)
+			record(black, white, 0, 1, 0)
+		} else if game.PgnParsed.Result == PgnResultBlackWin {
+			record(white, black, 0, 1, 0)
+			record(black, white, 1, 0, 0)
+		} else if game.PgnParsed.Result == PgnResultDraw {
+			record(white, black, 0, 0, 1)
+			record(black, white, 0, 0, 1)
+		}
+	}
+
+	headToHead := make([]headToHeadStats, 0, len(headToHeadMap))
+	for _, stats := range headToHeadMap {
+		headToHead = append(headToHead, stats)
+	}
+
+	sort.Slice(headToHead, func(i, j int) bool {
+		if !strings.EqualFold(headToHead[i].Player, headToHead[j].Player) {
+			return strings.ToLower(headToHead[i].Player) < strings.ToLower(headToHead[j].Player)
+		}
+		return strings.ToLower(headToHead[i].Opponent) < strings.ToLower(headToHead[j].Opponent)
+	})
+
+	return headToHead
+}
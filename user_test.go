@@ -0,0 +1,52 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSortUserStatsByAccuracy(t *testing.T) {
+	stats := []userStats{
+		{User: "alice", WinPercentage: 100, AnalyzedGames: 2, Analysis: playerAnalysis{Moves: 40, CentipawnLoss: 2000, BestMoves: 10}},
+		{User: "bob", WinPercentage: 50, AnalyzedGames: 1, Analysis: playerAnalysis{Moves: 20, CentipawnLoss: 400, BestMoves: 8}},
+		{User: "carol", WinPercentage: 75},
+		{User: "dave", WinPercentage: 0, AnalyzedGames: 1, Analysis: playerAnalysis{Moves: 20, CentipawnLoss: 400, BestMoves: 12}},
+		{User: "erin", WinPercentage: 80},
+	}
+
+	got := []string{}
+	for _, s := range sortUserStatsByAccuracy(stats) {
+		got = append(got, s.User)
+	}
+
+	// dave and bob lost as many centipawns, dave played more
+	// best moves. Players without analyzed games come last.
+	want := []string{"dave", "bob", "alice", "erin", "carol"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("sortUserStatsByAccuracy() = %v, want %v", got, want)
+	}
+
+	if stats[0].User != "alice" {
+		t.Errorf("sortUserStatsByAccuracy() reordered the standings it was passed")
+	}
+}
+
+func TestUserStatsSliceBlundersPerGame(t *testing.T) {
+	userStatsMap := newUserStatsMap([]string{"alice", "bob"})
+
+	game := scholarsMateGame(t)
+	game.Analysis = &scholarsMateAnalysis
+	addGameToUserStats(userStatsMap, game)
+	addGameToUserStats(userStatsMap, game)
+
+	for _, stats := range userStatsSlice(userStatsMap) {
+		want := 0.0
+		if stats.User == "bob" {
+			want = 1
+		}
+
+		if stats.AnalyzedGames != 2 || stats.BlundersPerGame != want {
+			t.Errorf("%s has %d analyzed games and %g blunders per game, want 2 and %g", stats.User, stats.AnalyzedGames, stats.BlundersPerGame, want)
+		}
+	}
+}
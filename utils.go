@@ -1,5 +1,10 @@
 package main
 
+import (
+	"fmt"
+	"strconv"
+)
+
 func getPreviousMonth(year, month int) (int, int) {
 	previousMonth := month
 	previousYear := year
@@ -12,3 +17,28 @@ func getPreviousMonth(year, month int) (int, int) {
 
 	return previousYear, previousMonth
 }
+
+// yearMonthString returns year and month as a "YYYYMM" string,
+// which sort in chronological order.
+func yearMonthString(year, month int) string {
+	return fmt.Sprintf("%04d%02d", year, month)
+}
+
+// parseYearMonthString returns the year and month of a "YYYYMM" string.
+func parseYearMonthString(yearMonth string) (int, int, error) {
+	if len(yearMonth) != 6 {
+		return 0, 0, fmt.Errorf("invalid year month %q", yearMonth)
+	}
+
+	year, err := strconv.Atoi(yearMonth[:4])
+	if err != nil {
+		return 0, 0, fmt.Errorf("invalid year month %q: %w", yearMonth, err)
+	}
+
+	month, err := strconv.Atoi(yearMonth[4:])
+	if err != nil || month < 1 || month > 12 {
+		return 0, 0, fmt.Errorf("invalid year month %q", yearMonth)
+	}
+
+	return year, month, nil
+}
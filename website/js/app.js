@@ -3,9 +3,27 @@
     const monthGamesEl = document.querySelector('.monthGames');
     const loaderEl = document.querySelector('.loader');
 
+    // ?online=true on the page leaves over the board games out
+    const onlineOnly = new URLSearchParams(window.location.search).get('online') === 'true';
+
+    // ?standings=accuracy on the page orders the standings by
+    // the engine analysis of the games
+    const standings = new URLSearchParams(window.location.search).get('standings') || 'winpct';
+
+    // point the standings toggle links at this page with their order
+    document.querySelectorAll('.standingsToggle a').forEach((linkEl) => {
+        const params = new URLSearchParams(window.location.search);
+        params.set('standings', linkEl.dataset.standings);
+        linkEl.href = `?${params}`;
+        if (linkEl.dataset.standings === standings) {
+            linkEl.classList.add('w3-text-black');
+        }
+    });
+
     // get the monthGames from API
-    const getMonthGames = async (year, month) => {
-        const API_URL = `https://chess-ajc.piposplace.com/monthgames?year=${year}&month=${month}`;
+    // an empty cursor starts from the current month
+    const getMonthGames = async (cursor) => {
+        const API_URL = `https://chess-ajc.piposplace.com/monthgames?cursor=${cursor}&online=${onlineOnly}&standings=${standings}`;
         const response = await fetch(API_URL);
         // handle 404
         if (!response.ok) {
@@ -32,43 +50,49 @@
         loaderEl.classList.add('show');
     };
 
-    const hasMoreMonthGames = (year, month) => {
-        return year > 0 && month > 0;
+    const hasMoreMonthGames = (cursor) => {
+        return cursor !== null;
     };
 
     // load monthGames
-    const loadMonthGames = async (year, month) => {
+    const loadMonthGames = async (cursor) => {
 
         // show the loader
         showLoader();
 
         // 0.5 second later
         setTimeout(async () => {
+            let keepGoing = false;
             try {
                 // if having more monthGames to fetch
-                if (hasMoreMonthGames(year, month)) {
+                if (hasMoreMonthGames(cursor)) {
                     // call the API to get monthGames
-                    const response = await getMonthGames(year, month);
+                    const response = await getMonthGames(cursor);
                     // show monthGames
                     showMonthGames(response.html);
-                    // update the year and month
-                    next_year = response.next_year;
-                    next_month = response.next_month;
+                    // update the cursor, null once there are no more months
+                    next_cursor = response.next_cursor || null;
+
+                    // the server stops after a stretch of months without
+                    // games, keep going as nothing was added to scroll to
+                    keepGoing = response.html.trim() === '' && hasMoreMonthGames(next_cursor);
                 }
             } catch (error) {
                 console.log(error.message);
             } finally {
-                hideLoader();
-                gettingMore = false;
+                if (keepGoing) {
+                    loadMonthGames(next_cursor);
+                } else {
+                    hideLoader();
+                    gettingMore = false;
+                }
             }
         }, 500);
 
     };
 
     // control variables
-    var d = new Date();
-    var next_year = d.getFullYear();
-    var next_month = d.getMonth() + 1;
+    var next_cursor = '';
     var gettingMore = true
 
 
@@ -80,15 +104,15 @@
         } = document.documentElement;
 
         if (scrollTop + clientHeight >= scrollHeight - 5 &&
-            hasMoreMonthGames(next_year, next_month) && gettingMore == false) {
+            hasMoreMonthGames(next_cursor) && gettingMore == false) {
             gettingMore = true;
-            loadMonthGames(next_year, next_month);
+            loadMonthGames(next_cursor);
         }
     }, {
         passive: true
     });
 
     // initialize
-    loadMonthGames(next_year, next_month);
+    loadMonthGames(next_cursor);
 
 })();
\ No newline at end of file